@@ -13,16 +13,14 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/redis/go-redis/v9"
+	"github.com/xmualex2023/i18n-translation/internal/apiserver/bootstrap"
 	"github.com/xmualex2023/i18n-translation/internal/apiserver/config"
 	"github.com/xmualex2023/i18n-translation/internal/apiserver/controller"
-	"github.com/xmualex2023/i18n-translation/internal/apiserver/repository"
-	"github.com/xmualex2023/i18n-translation/internal/apiserver/service"
 	"github.com/xmualex2023/i18n-translation/internal/pkg/auth"
+	"github.com/xmualex2023/i18n-translation/internal/pkg/idempotency"
 	"github.com/xmualex2023/i18n-translation/internal/pkg/limiter"
-	"github.com/xmualex2023/i18n-translation/internal/pkg/llm"
 	"github.com/xmualex2023/i18n-translation/internal/pkg/metrics"
 	"github.com/xmualex2023/i18n-translation/internal/pkg/middleware"
-	"github.com/xmualex2023/i18n-translation/internal/pkg/queue"
 	"github.com/xmualex2023/i18n-translation/internal/pkg/util"
 	"github.com/xmualex2023/i18n-translation/internal/pkg/worker"
 )
@@ -41,42 +39,41 @@ func main() {
 
 	gin.SetMode(cfg.Server.Mode)
 
-	repo, err := repository.NewRepository(cfg)
+	app, err := bootstrap.New(cfg)
 	if err != nil {
-		log.Fatalf("failed to initialize storage layer: %v", err)
+		log.Fatalf("failed to initialize: %v", err)
 	}
 
-	llmClient := llm.NewClient(cfg.LLM.APIKey, cfg.LLM.Endpoint)
-
-	// initialize redis client
-	redisClient := redis.NewClient(&redis.Options{
-		Addr:     cfg.Redis.Addr,
-		Password: cfg.Redis.Password,
-		DB:       cfg.Redis.DB,
-	})
-
-	// initialize task queue
-	taskQueue := queue.NewRedisQueue(redisClient, "translation_tasks")
-
-	tokenCache := auth.NewRedisTokenCache(redisClient, "token", cfg.JWT.Expire)
-	// initialize service layer
-	svc := service.NewService(cfg, repo, llmClient, taskQueue, tokenCache)
+	queueCtx, stopQueue := context.WithCancel(context.Background())
+	defer stopQueue()
+	app.RunQueue(queueCtx)
+	app.RunWebhooks(queueCtx)
+	if err := app.RunRetention(queueCtx); err != nil {
+		log.Fatalf("failed to run retention policy: %v", err)
+	}
 
-	// initialize worker
-	worker := worker.NewWorker(taskQueue, svc.HandleTranslationTask)
-	worker.Start(cfg.Worker.Count) // 启动指定数量的工作器
-	defer worker.Stop()
+	// workers run in this process unless they are deployed as standalone i18n-worker
+	var pool *worker.Worker
+	if cfg.Worker.Standalone {
+		log.Println("in-process workers disabled, tasks are handled by standalone workers")
+	} else {
+		pool, err = app.StartWorkers(queueCtx)
+		if err != nil {
+			log.Fatalf("failed to start workers: %v", err)
+		}
+	}
 
 	// initialize controller
-	ctrl := controller.NewController(svc)
+	ctrl := controller.NewController(app.Service)
 
 	// create router
 	router := setupRouter(ctrl, cfg)
 
 	// create http server
 	srv := &http.Server{
-		Addr:    cfg.Server.HTTP.Address,
-		Handler: router,
+		Addr:         cfg.Server.HTTP.Address,
+		Handler:      router,
+		WriteTimeout: cfg.Server.HTTP.Timeout,
 	}
 
 	// graceful shutdown
@@ -95,9 +92,19 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	if err := srv.Shutdown(ctx); err != nil {
-		log.Fatal("server force shutdown:", err)
+		log.Printf("server force shutdown: %v", err)
 	}
 
+	// finish running tasks, and requeue the unfinished ones once the grace period is over
+	if pool != nil {
+		log.Println("draining workers...")
+		drainCtx, cancelDrain := context.WithTimeout(context.Background(), cfg.Worker.ShutdownTimeout)
+		defer cancelDrain()
+		pool.Shutdown(drainCtx)
+	}
+	stopQueue()
+	app.FlushQueue()
+
 	log.Println("server exited")
 }
 
@@ -106,7 +113,7 @@ func setupRouter(ctrl controller.IController, cfg *config.Config) *gin.Engine {
 
 	// install middleware
 	r.Use(gin.LoggerWithConfig(gin.LoggerConfig{
-		SkipPaths: []string{"/metrics"},
+		SkipPaths: []string{"/metrics", "/healthz"},
 		Formatter: func(param gin.LogFormatterParams) string {
 			keys := param.Keys
 			userID, ok := keys["user_id"]
@@ -160,6 +167,13 @@ func setupRouter(ctrl controller.IController, cfg *config.Config) *gin.Engine {
 	// create jwt maker
 	jwtMaker := auth.NewJWTMaker(cfg.JWT.Secret, tokenCache)
 
+	// replay responses of retried task requests, keys stay reserved for twice the write timeout
+	// so a slow first request still owns its key when it completes
+	idempotencyStore := idempotency.NewStore(redisClient, "idempotency", cfg.Idempotency.TTL, 2*cfg.Server.HTTP.Timeout)
+
+	// health check
+	r.GET("/healthz", ctrl.Health)
+
 	// api group
 	api := r.Group("/api/v1")
 	api.Use(middleware.RateLimiter(rateLimiter))
@@ -173,10 +187,41 @@ func setupRouter(ctrl controller.IController, cfg *config.Config) *gin.Engine {
 		authorized := api.Group("/tasks")
 		authorized.Use(middleware.AuthMiddleware(jwtMaker))
 		{
-			authorized.POST("", ctrl.CreateTask)
-			authorized.POST("/:taskID/translate", ctrl.ExecuteTranslation)
+			authorized.POST("", middleware.Idempotency(idempotencyStore), ctrl.CreateTask)
+			authorized.POST("/:taskID/translate", middleware.Idempotency(idempotencyStore), ctrl.ExecuteTranslation)
+			authorized.GET("", ctrl.ListTasks)
 			authorized.GET("/:taskID", ctrl.GetTaskStatus)
 			authorized.GET("/:taskID/download", ctrl.DownloadTranslation)
+			authorized.DELETE("/:taskID/schedule", ctrl.CancelSchedule)
+			authorized.POST("/:taskID/cancel", ctrl.CancelTask)
+			authorized.DELETE("/:taskID", ctrl.DeleteTask)
+		}
+
+		usage := api.Group("/usage")
+		usage.Use(middleware.AuthMiddleware(jwtMaker))
+		{
+			usage.GET("", ctrl.GetUsage)
+		}
+
+		webhooks := api.Group("/webhooks")
+		webhooks.Use(middleware.AuthMiddleware(jwtMaker))
+		{
+			webhooks.POST("", ctrl.CreateWebhook)
+			webhooks.GET("", ctrl.ListWebhooks)
+			webhooks.DELETE("/:webhookID", ctrl.DeleteWebhook)
+			webhooks.GET("/:webhookID/deliveries", ctrl.ListWebhookDeliveries)
+		}
+
+		admin := api.Group("/admin")
+		admin.Use(middleware.AdminMiddleware(cfg.Admin.Token))
+		{
+			admin.GET("/deadletters", ctrl.ListDeadLetters)
+			admin.POST("/deadletters/:taskID/requeue", ctrl.RequeueDeadLetter)
+			admin.DELETE("/deadletters", ctrl.PurgeDeadLetters)
+			admin.GET("/scheduled", ctrl.ListScheduled)
+			admin.GET("/queue/consumers", ctrl.QueueConsumers)
+			admin.GET("/workers", ctrl.WorkerPool)
+			admin.PUT("/workers", ctrl.UpdateWorkerPool)
 		}
 	}
 
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/xmualex2023/i18n-translation/internal/apiserver/bootstrap"
+	"github.com/xmualex2023/i18n-translation/internal/apiserver/config"
+	"github.com/xmualex2023/i18n-translation/internal/apiserver/controller"
+	"github.com/xmualex2023/i18n-translation/internal/pkg/metrics"
+	"github.com/xmualex2023/i18n-translation/internal/pkg/middleware"
+	"github.com/xmualex2023/i18n-translation/internal/pkg/util"
+)
+
+var (
+	configPath = flag.String("config", "configs/apiserver.yaml", "配置文件路径")
+)
+
+// i18n-worker runs only the worker pool, so workers can be scaled apart from the api server.
+// It shares the config of the api server, which should set worker.standalone to stop running
+// workers in its own process.
+func main() {
+	flag.Parse()
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatalf("failed to load config: %v", err)
+	}
+	// the queue has to be shared with the api server
+	cfg.Worker.Standalone = true
+	// distinguish metrics of workers from the ones of the api server
+	cfg.Metrics.Job += "-worker"
+
+	gin.SetMode(cfg.Server.Mode)
+
+	app, err := bootstrap.New(cfg)
+	if err != nil {
+		log.Fatalf("failed to initialize: %v", err)
+	}
+
+	queueCtx, stopQueue := context.WithCancel(context.Background())
+	defer stopQueue()
+	app.RunQueue(queueCtx)
+	app.RunWebhooks(queueCtx)
+
+	pool, err := app.StartWorkers(queueCtx)
+	if err != nil {
+		log.Fatalf("failed to start workers: %v", err)
+	}
+
+	// health, metrics and worker pool admin api
+	srv := &http.Server{
+		Addr:    cfg.Worker.Address,
+		Handler: setupRouter(controller.NewController(app.Service), cfg),
+	}
+	util.SafetyGo(func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("failed to listen: %v", err)
+		}
+	})
+	log.Printf("worker started, workers: %d, address: %s", pool.Size(), cfg.Worker.Address)
+
+	// wait for interrupt signal
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+	log.Println("shutting down worker...")
+
+	// finish running tasks, and requeue the unfinished ones once the grace period is over
+	log.Println("draining workers...")
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), cfg.Worker.ShutdownTimeout)
+	defer cancelDrain()
+	pool.Shutdown(drainCtx)
+	stopQueue()
+	app.FlushQueue()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("server force shutdown: %v", err)
+	}
+
+	log.Println("worker exited")
+}
+
+func setupRouter(ctrl controller.IController, cfg *config.Config) *gin.Engine {
+	r := gin.New()
+	r.Use(gin.Recovery())
+
+	prom, err := middleware.NewPrometheus(cfg)
+	if err != nil {
+		log.Fatalf("failed to initialize prometheus: %v", err)
+	}
+	prom.RegisterCollector(metrics.CollectorVector...)
+	util.SafetyGo(prom.Run)
+
+	r.GET("/healthz", ctrl.Health)
+	r.GET("/metrics", gin.WrapH(promhttp.HandlerFor(prom.Gatherer(), promhttp.HandlerOpts{})))
+
+	admin := r.Group("/api/v1/admin")
+	admin.Use(middleware.AdminMiddleware(cfg.Admin.Token))
+	{
+		admin.GET("/workers", ctrl.WorkerPool)
+		admin.PUT("/workers", ctrl.UpdateWorkerPool)
+	}
+
+	return r
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/xmualex2023/i18n-translation/internal/pkg/llm/llmtest"
+)
+
+var (
+	addr       = flag.String("addr", ":8089", "监听地址")
+	latency    = flag.Duration("latency", 0, "每个请求的响应延迟")
+	fault      = flag.String("fault", "", "注入的错误类型：429/500/malformed")
+	faultFirst = flag.Int("fault-first", 0, "前 N 个请求注入错误")
+	faultEvery = flag.Int("fault-every", 0, "每 N 个请求注入一次错误，1 表示全部")
+	retryAfter = flag.Int("retry-after", 0, "429 响应的 Retry-After（秒）")
+)
+
+func main() {
+	flag.Parse()
+
+	switch llmtest.Fault(*fault) {
+	case llmtest.FaultNone, llmtest.FaultRateLimit, llmtest.FaultServerError, llmtest.FaultMalformed:
+	default:
+		log.Fatalf("unknown fault: %s", *fault)
+	}
+
+	handler := llmtest.NewHandler(llmtest.Options{
+		Latency:    *latency,
+		Fault:      llmtest.Fault(*fault),
+		FaultFirst: *faultFirst,
+		FaultEvery: *faultEvery,
+		RetryAfter: *retryAfter,
+	})
+
+	log.Printf("mock llm server is running at %s, endpoint: POST /v1/chat/completions", *addr)
+	if err := http.ListenAndServe(*addr, handler); err != nil {
+		log.Fatalf("failed to listen: %v", err)
+	}
+}
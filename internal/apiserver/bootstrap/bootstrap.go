@@ -0,0 +1,243 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/xmualex2023/i18n-translation/internal/apiserver/config"
+	"github.com/xmualex2023/i18n-translation/internal/apiserver/repository"
+	"github.com/xmualex2023/i18n-translation/internal/apiserver/service"
+	"github.com/xmualex2023/i18n-translation/internal/pkg/auth"
+	"github.com/xmualex2023/i18n-translation/internal/pkg/breaker"
+	"github.com/xmualex2023/i18n-translation/internal/pkg/llm"
+	"github.com/xmualex2023/i18n-translation/internal/pkg/queue"
+	"github.com/xmualex2023/i18n-translation/internal/pkg/util"
+	"github.com/xmualex2023/i18n-translation/internal/pkg/worker"
+)
+
+// App components shared by the api server and the standalone worker
+type App struct {
+	Config    *config.Config
+	Repo      *repository.Repository
+	Redis     *redis.Client
+	Breakers  *breaker.Registry
+	LLM       *llm.Client
+	Queue     queue.Backend
+	CancelBus *worker.RedisCancelBus
+	Service   *service.Service
+}
+
+// New create storage, queue, translator and service layer by the config
+func New(cfg *config.Config) (*App, error) {
+	repo, err := repository.NewRepository(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize storage layer, error: %w", err)
+	}
+
+	// initialize redis client
+	redisClient := redis.NewClient(&redis.Options{
+		Addr:     cfg.Redis.Addr,
+		Password: cfg.Redis.Password,
+		DB:       cfg.Redis.DB,
+	})
+
+	// initialize circuit breakers of translation providers
+	breakers := breaker.NewRegistry(breaker.Settings{
+		FailureThreshold: cfg.LLM.Breaker.FailureThreshold,
+		OpenTimeout:      cfg.LLM.Breaker.OpenTimeout,
+		HalfOpenMaxCalls: cfg.LLM.Breaker.HalfOpenMaxCalls,
+	})
+
+	// initialize llm client
+	llmOpts := []llm.Option{
+		llm.WithProvider(cfg.LLM.Provider),
+		llm.WithModel(cfg.LLM.Model),
+		llm.WithBatchSize(cfg.LLM.BatchSize),
+		llm.WithRetryPolicy(llm.RetryPolicy{
+			MaxRetries: cfg.LLM.Retry.MaxRetries,
+			BaseDelay:  cfg.LLM.Retry.BaseDelay,
+			MaxDelay:   cfg.LLM.Retry.MaxDelay,
+		}),
+		llm.WithBreaker(breakers.Get(cfg.LLM.Provider)),
+	}
+	if cfg.LLM.Cache.Enabled {
+		llmOpts = append(llmOpts, llm.WithCache(llm.NewRedisCache(redisClient, "llm_cache", cfg.LLM.Cache.TTL)))
+	}
+	llmClient := llm.NewClient(cfg.LLM.APIKey, cfg.LLM.Endpoint, llmOpts...)
+
+	// initialize task queue
+	taskQueue, err := newTaskQueue(cfg, redisClient)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create task queue, error: %w", err)
+	}
+
+	tokenCache := auth.NewRedisTokenCache(redisClient, "token", cfg.JWT.Expire)
+	cancelBus := worker.NewRedisCancelBus(redisClient, cfg.Queue.Key+":cancel")
+	// initialize service layer
+	svc := service.NewService(cfg, repo, llmClient, taskQueue, tokenCache, breakers, cancelBus)
+
+	return &App{
+		Config:    cfg,
+		Repo:      repo,
+		Redis:     redisClient,
+		Breakers:  breakers,
+		LLM:       llmClient,
+		Queue:     taskQueue,
+		CancelBus: cancelBus,
+		Service:   svc,
+	}, nil
+}
+
+// RunQueue run lease reaper and delayed task scheduler of the queue until ctx is done
+func (a *App) RunQueue(ctx context.Context) {
+	util.SafetyGo(func() {
+		a.Queue.RunReaper(ctx, a.Config.Queue.ReapInterval)
+	})
+	util.SafetyGo(func() {
+		a.Queue.RunScheduler(ctx, a.Config.Queue.ScheduleInterval)
+	})
+}
+
+// FlushQueue write pending state of the queue, it's called before the process exits
+func (a *App) FlushQueue() {
+	f, ok := a.Queue.(queue.Flusher)
+	if !ok {
+		return
+	}
+	if err := f.Flush(); err != nil {
+		log.Printf("failed to flush queue, error: %v", err)
+	}
+}
+
+// RunWebhooks send webhook deliveries until ctx is done
+func (a *App) RunWebhooks(ctx context.Context) {
+	util.SafetyGo(func() {
+		a.Service.RunWebhookDispatcher(ctx)
+	})
+}
+
+// RunRetention apply the data retention policy until ctx is done, if it's enabled
+func (a *App) RunRetention(ctx context.Context) error {
+	retention := a.Config.Retention
+	if !retention.Enabled {
+		return nil
+	}
+	switch retention.Mode {
+	case service.RetentionModePurge, service.RetentionModeAnonymize:
+	default:
+		return fmt.Errorf("unknown retention mode: %s", retention.Mode)
+	}
+	if retention.Days <= 0 || retention.BatchSize <= 0 {
+		return fmt.Errorf("retention days and batch size must be positive")
+	}
+
+	util.SafetyGo(func() {
+		a.Service.RunRetention(ctx)
+	})
+	return nil
+}
+
+// StartWorkers recover unfinished tasks of this consumer and start the worker pool with its
+// autoscaler until ctx is done. The pool is also managed by the admin api of the service.
+func (a *App) StartWorkers(ctx context.Context) (*worker.Worker, error) {
+	cfg := a.Config
+	if n, err := a.Queue.Recover(ctx); err != nil {
+		return nil, fmt.Errorf("failed to recover tasks, error: %w", err)
+	} else if n > 0 {
+		log.Printf("recovered %d unfinished tasks", n)
+	}
+
+	w := worker.NewWorker(a.Queue, a.Service.HandleTranslationTask)
+	w.OnDeadLetter(a.Service.HandleDeadLetter)
+	w.OnRequeue(a.Service.HandleRequeue)
+	w.SetTaskTimeout(cfg.Worker.TaskTimeout)
+	// renew leases of running tasks several times per visibility timeout
+	w.SetLeaseRenewal(cfg.Queue.VisibilityTimeout / 3)
+
+	// scale worker pool by queue depth and latency
+	autoscaler, err := newAutoscaler(cfg, w, a.Queue, a.LLM)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create autoscaler, error: %w", err)
+	}
+	a.Service.SetWorkerPool(autoscaler)
+
+	util.SafetyGo(func() {
+		w.ListenCancel(ctx, a.CancelBus)
+	})
+	w.Start(cfg.Worker.Count) // 启动指定数量的工作器
+	util.SafetyGo(func() {
+		autoscaler.Run(ctx)
+	})
+	return w, nil
+}
+
+// newTaskQueue create task queue of the configured backend
+func newTaskQueue(cfg *config.Config, redisClient *redis.Client) (queue.Backend, error) {
+	opts := []queue.Option{
+		queue.WithRetry(cfg.Queue.MaxRetries, cfg.Queue.RetryDelay),
+		queue.WithPriorityWeights(queue.Weights{
+			High:   cfg.Queue.Weights.High,
+			Normal: cfg.Queue.Weights.Normal,
+			Low:    cfg.Queue.Weights.Low,
+		}),
+		queue.WithVisibilityTimeout(cfg.Queue.VisibilityTimeout),
+	}
+	if cfg.Queue.Fair.Enabled {
+		opts = append(opts, queue.WithFairShare(cfg.Queue.Fair.MaxRunningPerUser))
+	}
+
+	consumer := cfg.Queue.Consumer
+	if consumer == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get hostname, error: %w", err)
+		}
+		consumer = hostname
+	}
+
+	switch cfg.Queue.Backend {
+	case "list":
+		if cfg.Queue.Reliable {
+			opts = append(opts, queue.WithReliable(consumer, cfg.Queue.VisibilityTimeout))
+		}
+		return queue.NewRedisQueue(redisClient, cfg.Queue.Key, opts...), nil
+	case "stream":
+		if cfg.Queue.Fair.Enabled {
+			return nil, fmt.Errorf("fair scheduling is not supported by the stream queue backend")
+		}
+		opts = append(opts, queue.WithMaxLen(cfg.Queue.MaxLen))
+		return queue.NewStreamQueue(redisClient, cfg.Queue.Key, cfg.Queue.Group, consumer, opts...), nil
+	case "memory":
+		// the queue lives in this process, so it can't be shared with standalone workers
+		if cfg.Worker.Standalone {
+			return nil, fmt.Errorf("memory queue backend can not be used with standalone workers")
+		}
+		opts = append(opts, queue.WithCapacity(cfg.Queue.Capacity), queue.WithPersistence(cfg.Queue.PersistPath))
+		return queue.NewMemoryQueue(opts...)
+	default:
+		return nil, fmt.Errorf("unknown queue backend: %s", cfg.Queue.Backend)
+	}
+}
+
+// newAutoscaler create autoscaler of the worker pool, it also serves manual resizing when
+// autoscaling is disabled
+func newAutoscaler(cfg *config.Config, w *worker.Worker, q queue.Backend, llmClient *llm.Client) (*worker.Autoscaler, error) {
+	depth, ok := q.(worker.DepthReporter)
+	if !ok {
+		return nil, fmt.Errorf("queue backend %s does not report its depth", cfg.Queue.Backend)
+	}
+
+	autoscale := cfg.Worker.Autoscale
+	return worker.NewAutoscaler(w, depth, llmClient, worker.AutoscaleSettings{
+		Enabled:    autoscale.Enabled,
+		Min:        autoscale.Min,
+		Max:        autoscale.Max,
+		Interval:   autoscale.Interval,
+		Cooldown:   autoscale.Cooldown,
+		TargetWait: autoscale.TargetWait,
+		MaxLatency: autoscale.MaxLatency,
+	}), nil
+}
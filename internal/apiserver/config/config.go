@@ -1,6 +1,8 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"reflect"
 	"time"
@@ -8,6 +10,12 @@ import (
 	"gopkg.in/yaml.v3"
 )
 
+// ModelPrice 模型价格，单位：每 1K tokens
+type ModelPrice struct {
+	Prompt     float64 `yaml:"prompt"`
+	Completion float64 `yaml:"completion"`
+}
+
 // TODO: 后面可以同步Viper来进行配置管理
 type Config struct {
 	Server struct {
@@ -39,8 +47,26 @@ type Config struct {
 	} `yaml:"jwt"`
 
 	LLM struct {
-		APIKey   string `yaml:"api_key"`
-		Endpoint string `yaml:"endpoint"`
+		APIKey    string `yaml:"api_key"`
+		Endpoint  string `yaml:"endpoint"`
+		Provider  string `yaml:"provider"`
+		Model     string `yaml:"model"`
+		BatchSize int    `yaml:"batch_size"`
+		Cache     struct {
+			Enabled bool          `yaml:"enabled"`
+			TTL     time.Duration `yaml:"ttl"`
+		} `yaml:"cache"`
+		Retry struct {
+			MaxRetries int           `yaml:"max_retries"`
+			BaseDelay  time.Duration `yaml:"base_delay"`
+			MaxDelay   time.Duration `yaml:"max_delay"`
+		} `yaml:"retry"`
+		Breaker struct {
+			FailureThreshold int           `yaml:"failure_threshold"`
+			OpenTimeout      time.Duration `yaml:"open_timeout"`
+			HalfOpenMaxCalls int           `yaml:"half_open_max_calls"`
+		} `yaml:"breaker"`
+		Prices map[string]ModelPrice `yaml:"prices"`
 	} `yaml:"llm"`
 
 	Metrics struct {
@@ -57,9 +83,73 @@ type Config struct {
 		Duration    time.Duration `yaml:"duration"`
 	} `yaml:"rate_limit"`
 
+	Idempotency struct {
+		TTL time.Duration `yaml:"ttl"`
+	} `yaml:"idempotency"`
+
+	Webhook struct {
+		MaxAttempts int           `yaml:"max_attempts"`
+		BaseDelay   time.Duration `yaml:"base_delay"`
+		MaxDelay    time.Duration `yaml:"max_delay"`
+		Timeout     time.Duration `yaml:"timeout"`
+		Interval    time.Duration `yaml:"interval"`
+		Concurrency int           `yaml:"concurrency"`
+	} `yaml:"webhook"`
+
+	Retention struct {
+		Enabled   bool          `yaml:"enabled"`
+		Days      int           `yaml:"days"`
+		Mode      string        `yaml:"mode"`
+		Interval  time.Duration `yaml:"interval"`
+		BatchSize int           `yaml:"batch_size"`
+	} `yaml:"retention"`
+
+	Queue struct {
+		Backend           string        `yaml:"backend"`
+		Key               string        `yaml:"key"`
+		Reliable          bool          `yaml:"reliable"`
+		Consumer          string        `yaml:"consumer"`
+		VisibilityTimeout time.Duration `yaml:"visibility_timeout"`
+		ReapInterval      time.Duration `yaml:"reap_interval"`
+		Group             string        `yaml:"group"`
+		MaxLen            int64         `yaml:"max_len"`
+		Capacity          int           `yaml:"capacity"`
+		PersistPath       string        `yaml:"persist_path"`
+		MaxRetries        int           `yaml:"max_retries"`
+		RetryDelay        time.Duration `yaml:"retry_delay"`
+		ScheduleInterval  time.Duration `yaml:"schedule_interval"`
+		Weights           struct {
+			High   int `yaml:"high"`
+			Normal int `yaml:"normal"`
+			Low    int `yaml:"low"`
+		} `yaml:"weights"`
+		Fair struct {
+			Enabled           bool `yaml:"enabled"`
+			MaxRunningPerUser int  `yaml:"max_running_per_user"`
+		} `yaml:"fair"`
+	} `yaml:"queue"`
+
 	Worker struct {
-		Count int `yaml:"count"`
+		Count            int           `yaml:"count"`
+		Standalone       bool          `yaml:"standalone"`
+		Address          string        `yaml:"address"`
+		TaskTimeout      time.Duration `yaml:"task_timeout"`
+		ShutdownTimeout  time.Duration `yaml:"shutdown_timeout"`
+		ProgressInterval time.Duration `yaml:"progress_interval"`
+		Autoscale        struct {
+			Enabled    bool          `yaml:"enabled"`
+			Min        int           `yaml:"min"`
+			Max        int           `yaml:"max"`
+			Interval   time.Duration `yaml:"interval"`
+			Cooldown   time.Duration `yaml:"cooldown"`
+			TargetWait time.Duration `yaml:"target_wait"`
+			MaxLatency time.Duration `yaml:"max_latency"`
+		} `yaml:"autoscale"`
 	} `yaml:"worker"`
+
+	Admin struct {
+		Token string `yaml:"token"`
+	} `yaml:"admin"`
 }
 
 // DefaultConfig 返回默认配置
@@ -110,11 +200,62 @@ func DefaultConfig() *Config {
 			Expire: 24 * time.Hour,
 		},
 		LLM: struct {
-			APIKey   string `yaml:"api_key"`
-			Endpoint string `yaml:"endpoint"`
+			APIKey    string `yaml:"api_key"`
+			Endpoint  string `yaml:"endpoint"`
+			Provider  string `yaml:"provider"`
+			Model     string `yaml:"model"`
+			BatchSize int    `yaml:"batch_size"`
+			Cache     struct {
+				Enabled bool          `yaml:"enabled"`
+				TTL     time.Duration `yaml:"ttl"`
+			} `yaml:"cache"`
+			Retry struct {
+				MaxRetries int           `yaml:"max_retries"`
+				BaseDelay  time.Duration `yaml:"base_delay"`
+				MaxDelay   time.Duration `yaml:"max_delay"`
+			} `yaml:"retry"`
+			Breaker struct {
+				FailureThreshold int           `yaml:"failure_threshold"`
+				OpenTimeout      time.Duration `yaml:"open_timeout"`
+				HalfOpenMaxCalls int           `yaml:"half_open_max_calls"`
+			} `yaml:"breaker"`
+			Prices map[string]ModelPrice `yaml:"prices"`
 		}{
-			APIKey:   "",
-			Endpoint: "https://api.openai.com/v1",
+			APIKey:    "",
+			Endpoint:  "https://api.openai.com/v1",
+			Provider:  "openai",
+			Model:     "gpt-3.5-turbo",
+			BatchSize: 50,
+			Cache: struct {
+				Enabled bool          `yaml:"enabled"`
+				TTL     time.Duration `yaml:"ttl"`
+			}{
+				Enabled: false,
+				TTL:     7 * 24 * time.Hour,
+			},
+			Retry: struct {
+				MaxRetries int           `yaml:"max_retries"`
+				BaseDelay  time.Duration `yaml:"base_delay"`
+				MaxDelay   time.Duration `yaml:"max_delay"`
+			}{
+				MaxRetries: 3,
+				BaseDelay:  time.Second,
+				MaxDelay:   30 * time.Second,
+			},
+			Breaker: struct {
+				FailureThreshold int           `yaml:"failure_threshold"`
+				OpenTimeout      time.Duration `yaml:"open_timeout"`
+				HalfOpenMaxCalls int           `yaml:"half_open_max_calls"`
+			}{
+				FailureThreshold: 5,
+				OpenTimeout:      30 * time.Second,
+				HalfOpenMaxCalls: 1,
+			},
+			Prices: map[string]ModelPrice{
+				"gpt-3.5-turbo": {Prompt: 0.0005, Completion: 0.0015},
+				"gpt-4o-mini":   {Prompt: 0.00015, Completion: 0.0006},
+				"gpt-4o":        {Prompt: 0.0025, Completion: 0.01},
+			},
 		},
 		Metrics: struct {
 			PullHost        string    `yaml:"pull_host"`
@@ -138,10 +279,126 @@ func DefaultConfig() *Config {
 			MaxRequests: 100,
 			Duration:    time.Minute,
 		},
+		Idempotency: struct {
+			TTL time.Duration `yaml:"ttl"`
+		}{
+			TTL: 24 * time.Hour,
+		},
+		Webhook: struct {
+			MaxAttempts int           `yaml:"max_attempts"`
+			BaseDelay   time.Duration `yaml:"base_delay"`
+			MaxDelay    time.Duration `yaml:"max_delay"`
+			Timeout     time.Duration `yaml:"timeout"`
+			Interval    time.Duration `yaml:"interval"`
+			Concurrency int           `yaml:"concurrency"`
+		}{
+			MaxAttempts: 8,
+			BaseDelay:   10 * time.Second,
+			MaxDelay:    time.Hour,
+			Timeout:     10 * time.Second,
+			Interval:    5 * time.Second,
+			Concurrency: 4,
+		},
+		Retention: struct {
+			Enabled   bool          `yaml:"enabled"`
+			Days      int           `yaml:"days"`
+			Mode      string        `yaml:"mode"`
+			Interval  time.Duration `yaml:"interval"`
+			BatchSize int           `yaml:"batch_size"`
+		}{
+			Days:      90,
+			Mode:      "purge",
+			Interval:  time.Hour,
+			BatchSize: 500,
+		},
+		Queue: struct {
+			Backend           string        `yaml:"backend"`
+			Key               string        `yaml:"key"`
+			Reliable          bool          `yaml:"reliable"`
+			Consumer          string        `yaml:"consumer"`
+			VisibilityTimeout time.Duration `yaml:"visibility_timeout"`
+			ReapInterval      time.Duration `yaml:"reap_interval"`
+			Group             string        `yaml:"group"`
+			MaxLen            int64         `yaml:"max_len"`
+			Capacity          int           `yaml:"capacity"`
+			PersistPath       string        `yaml:"persist_path"`
+			MaxRetries        int           `yaml:"max_retries"`
+			RetryDelay        time.Duration `yaml:"retry_delay"`
+			ScheduleInterval  time.Duration `yaml:"schedule_interval"`
+			Weights           struct {
+				High   int `yaml:"high"`
+				Normal int `yaml:"normal"`
+				Low    int `yaml:"low"`
+			} `yaml:"weights"`
+			Fair struct {
+				Enabled           bool `yaml:"enabled"`
+				MaxRunningPerUser int  `yaml:"max_running_per_user"`
+			} `yaml:"fair"`
+		}{
+			Backend:           "list",
+			Key:               "translation_tasks",
+			Reliable:          false,
+			Consumer:          "",
+			VisibilityTimeout: 15 * time.Minute,
+			ReapInterval:      30 * time.Second,
+			Group:             "i18n-workers",
+			MaxLen:            100000,
+			Capacity:          10000,
+			MaxRetries:        3,
+			RetryDelay:        5 * time.Second,
+			ScheduleInterval:  time.Second,
+			Weights: struct {
+				High   int `yaml:"high"`
+				Normal int `yaml:"normal"`
+				Low    int `yaml:"low"`
+			}{
+				High:   6,
+				Normal: 3,
+				Low:    1,
+			},
+		},
 		Worker: struct {
-			Count int `yaml:"count"`
+			Count            int           `yaml:"count"`
+			Standalone       bool          `yaml:"standalone"`
+			Address          string        `yaml:"address"`
+			TaskTimeout      time.Duration `yaml:"task_timeout"`
+			ShutdownTimeout  time.Duration `yaml:"shutdown_timeout"`
+			ProgressInterval time.Duration `yaml:"progress_interval"`
+			Autoscale        struct {
+				Enabled    bool          `yaml:"enabled"`
+				Min        int           `yaml:"min"`
+				Max        int           `yaml:"max"`
+				Interval   time.Duration `yaml:"interval"`
+				Cooldown   time.Duration `yaml:"cooldown"`
+				TargetWait time.Duration `yaml:"target_wait"`
+				MaxLatency time.Duration `yaml:"max_latency"`
+			} `yaml:"autoscale"`
 		}{
-			Count: 5,
+			Count:            5,
+			Address:          ":8081",
+			TaskTimeout:      10 * time.Minute,
+			ShutdownTimeout:  30 * time.Second,
+			ProgressInterval: 2 * time.Second,
+			Autoscale: struct {
+				Enabled    bool          `yaml:"enabled"`
+				Min        int           `yaml:"min"`
+				Max        int           `yaml:"max"`
+				Interval   time.Duration `yaml:"interval"`
+				Cooldown   time.Duration `yaml:"cooldown"`
+				TargetWait time.Duration `yaml:"target_wait"`
+				MaxLatency time.Duration `yaml:"max_latency"`
+			}{
+				Min:        1,
+				Max:        20,
+				Interval:   15 * time.Second,
+				Cooldown:   time.Minute,
+				TargetWait: 30 * time.Second,
+			},
+		},
+		Admin: struct {
+			Token string `yaml:"token"`
+		}{
+			Token: "",
 		},
 	}
 }
@@ -190,5 +447,20 @@ func Load(path string) (*Config, error) {
 	}
 
 	mergeConfig(cfg, tmpCfg)
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
 	return cfg, nil
 }
+
+// Validate check settings which depend on each other
+func (c *Config) Validate() error {
+	// tasks running longer than the lease are delivered again if a renewal is missed
+	if c.Queue.VisibilityTimeout <= 0 {
+		return errors.New("queue.visibility_timeout must be positive")
+	}
+	if c.Worker.TaskTimeout <= 0 || c.Worker.TaskTimeout >= c.Queue.VisibilityTimeout {
+		return fmt.Errorf("worker.task_timeout must be positive and less than queue.visibility_timeout %v", c.Queue.VisibilityTimeout)
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xmualex2023/i18n-translation/internal/apiserver/model"
+	"github.com/xmualex2023/i18n-translation/internal/apiserver/service"
+	"github.com/xmualex2023/i18n-translation/internal/pkg/worker"
+)
+
+// ListDeadLetters list tasks which exhausted their retries
+func (c *Controller) ListDeadLetters(ctx *gin.Context) {
+	var req model.DeadLetterListRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp, err := c.svc.ListDeadLetters(ctx.Request.Context(), &req)
+	if err != nil {
+		c.deadLetterError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, resp)
+}
+
+// RequeueDeadLetter move dead letter back to the queue
+func (c *Controller) RequeueDeadLetter(ctx *gin.Context) {
+	taskID := ctx.Param("taskID")
+
+	if err := c.svc.RequeueDeadLetter(ctx.Request.Context(), taskID); err != nil {
+		c.deadLetterError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "task requeued"})
+}
+
+// PurgeDeadLetters remove all dead letters
+func (c *Controller) PurgeDeadLetters(ctx *gin.Context) {
+	resp, err := c.svc.PurgeDeadLetters(ctx.Request.Context())
+	if err != nil {
+		c.deadLetterError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, resp)
+}
+
+// ListScheduled list tasks waiting in the delay queue, including retries in backoff
+func (c *Controller) ListScheduled(ctx *gin.Context) {
+	var req model.ScheduledListRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp, err := c.svc.ListScheduled(ctx.Request.Context(), &req)
+	if err != nil {
+		if errors.Is(err, service.ErrScheduleUnsupported) {
+			ctx.JSON(http.StatusNotImplemented, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, resp)
+}
+
+// QueueConsumers get pending task count of each queue consumer
+func (c *Controller) QueueConsumers(ctx *gin.Context) {
+	resp, err := c.svc.QueueConsumers(ctx.Request.Context())
+	if err != nil {
+		if errors.Is(err, service.ErrConsumersUnsupported) {
+			ctx.JSON(http.StatusNotImplemented, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, resp)
+}
+
+// WorkerPool get worker pool status
+func (c *Controller) WorkerPool(ctx *gin.Context) {
+	resp, err := c.svc.WorkerPool()
+	if err != nil {
+		c.workerPoolError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, resp)
+}
+
+// UpdateWorkerPool resize worker pool or change its autoscaling bounds
+func (c *Controller) UpdateWorkerPool(ctx *gin.Context) {
+	var req model.WorkerPoolUpdateRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp, err := c.svc.UpdateWorkerPool(&req)
+	if err != nil {
+		c.workerPoolError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, resp)
+}
+
+func (c *Controller) workerPoolError(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, worker.ErrInvalidPoolSize):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrWorkerPoolUnavailable):
+		ctx.JSON(http.StatusNotImplemented, gin.H{"error": err.Error()})
+	default:
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+func (c *Controller) deadLetterError(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrDeadLetterNotFound):
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidTransition):
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrDeadLetterUnsupported):
+		ctx.JSON(http.StatusNotImplemented, gin.H{"error": err.Error()})
+	default:
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
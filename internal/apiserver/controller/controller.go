@@ -16,7 +16,32 @@ type IController interface {
 	CreateTask(ctx *gin.Context)
 	ExecuteTranslation(ctx *gin.Context)
 	GetTaskStatus(ctx *gin.Context)
+	ListTasks(ctx *gin.Context)
 	DownloadTranslation(ctx *gin.Context)
+	CancelSchedule(ctx *gin.Context)
+	CancelTask(ctx *gin.Context)
+	DeleteTask(ctx *gin.Context)
+
+	// usage related
+	GetUsage(ctx *gin.Context)
+
+	// webhook related
+	CreateWebhook(ctx *gin.Context)
+	ListWebhooks(ctx *gin.Context)
+	DeleteWebhook(ctx *gin.Context)
+	ListWebhookDeliveries(ctx *gin.Context)
+
+	// admin related
+	ListDeadLetters(ctx *gin.Context)
+	RequeueDeadLetter(ctx *gin.Context)
+	PurgeDeadLetters(ctx *gin.Context)
+	ListScheduled(ctx *gin.Context)
+	QueueConsumers(ctx *gin.Context)
+	WorkerPool(ctx *gin.Context)
+	UpdateWorkerPool(ctx *gin.Context)
+
+	// health check
+	Health(ctx *gin.Context)
 }
 
 type Controller struct {
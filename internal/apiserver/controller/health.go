@@ -0,0 +1,12 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Health health check, includes circuit breaker state of translation providers
+func (c *Controller) Health(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, c.svc.Health(ctx.Request.Context()))
+}
@@ -1,11 +1,15 @@
 package controller
 
 import (
+	"errors"
+	"io"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/xmualex2023/i18n-translation/internal/apiserver/model"
+	"github.com/xmualex2023/i18n-translation/internal/apiserver/service"
 	"github.com/xmualex2023/i18n-translation/internal/pkg/middleware"
+	"github.com/xmualex2023/i18n-translation/internal/pkg/queue"
 )
 
 // CreateTask create translation task
@@ -25,6 +29,10 @@ func (c *Controller) CreateTask(ctx *gin.Context) {
 
 	resp, err := c.svc.CreateTask(ctx.Request.Context(), &req, claims.UserID)
 	if err != nil {
+		if errors.Is(err, service.ErrInvalidTask) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -32,24 +40,167 @@ func (c *Controller) CreateTask(ctx *gin.Context) {
 	ctx.JSON(http.StatusCreated, resp)
 }
 
-// ExecuteTranslation execute translation
+// ExecuteTranslation execute translation of the current user's task, the body is optional
 func (c *Controller) ExecuteTranslation(ctx *gin.Context) {
+	claims, exists := middleware.GetCurrentUser(ctx)
+	if !exists {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
 	taskID := ctx.Param("taskID")
 
-	if err := c.svc.ExecuteTranslation(ctx.Request.Context(), taskID); err != nil {
+	var req model.ExecuteTaskRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := c.svc.ExecuteTranslation(ctx.Request.Context(), taskID, claims.UserID, &req); err != nil {
+		// tasks of other users are reported missing, like malformed ids
+		if errors.Is(err, service.ErrInvalidTask) || errors.Is(err, service.ErrTaskNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, service.ErrInvalidSchedule) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, queue.ErrFull) {
+			ctx.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, service.ErrInvalidTransition) {
+			ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	if req.RunAt != nil || req.Delay != "" {
+		ctx.JSON(http.StatusOK, gin.H{"message": "translation task scheduled"})
+		return
+	}
 	ctx.JSON(http.StatusOK, gin.H{"message": "translation task started"})
 }
 
-// GetTaskStatus get task status
+// CancelSchedule cancel scheduled translation of the current user
+func (c *Controller) CancelSchedule(ctx *gin.Context) {
+	claims, exists := middleware.GetCurrentUser(ctx)
+	if !exists {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	if err := c.svc.CancelSchedule(ctx.Request.Context(), ctx.Param("taskID"), claims.UserID); err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidTask):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrTaskNotFound):
+			ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrTaskNotScheduled), errors.Is(err, service.ErrInvalidTransition):
+			ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "scheduled translation cancelled"})
+}
+
+// CancelTask cancel waiting or running task of the current user
+func (c *Controller) CancelTask(ctx *gin.Context) {
+	claims, exists := middleware.GetCurrentUser(ctx)
+	if !exists {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	if err := c.svc.CancelTask(ctx.Request.Context(), ctx.Param("taskID"), claims.UserID); err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidTask):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrTaskNotFound):
+			ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrTaskNotCancellable), errors.Is(err, service.ErrInvalidTransition):
+			ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "task cancelled"})
+}
+
+// GetTaskStatus get status of the current user's task
 func (c *Controller) GetTaskStatus(ctx *gin.Context) {
-	taskID := ctx.Param("taskID")
+	claims, exists := middleware.GetCurrentUser(ctx)
+	if !exists {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
 
-	resp, err := c.svc.GetTaskStatus(ctx.Request.Context(), taskID)
+	resp, err := c.svc.GetTaskStatus(ctx.Request.Context(), ctx.Param("taskID"), claims.UserID)
 	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidTask), errors.Is(err, service.ErrTaskNotFound):
+			ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		default:
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, resp)
+}
+
+// DeleteTask delete finished task of the current user
+func (c *Controller) DeleteTask(ctx *gin.Context) {
+	claims, exists := middleware.GetCurrentUser(ctx)
+	if !exists {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	if err := c.svc.DeleteTask(ctx.Request.Context(), ctx.Param("taskID"), claims.UserID); err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidTask):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrTaskNotFound):
+			ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrTaskNotDeletable):
+			ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "task deleted"})
+}
+
+// ListTasks list tasks of the current user
+func (c *Controller) ListTasks(ctx *gin.Context) {
+	var req model.ListTasksRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	claims, exists := middleware.GetCurrentUser(ctx)
+	if !exists {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	resp, err := c.svc.ListTasks(ctx.Request.Context(), &req, claims.UserID)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidTaskQuery) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -57,13 +208,22 @@ func (c *Controller) GetTaskStatus(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, resp)
 }
 
-// DownloadTranslation download translation result
+// DownloadTranslation download translation result of the current user's task
 func (c *Controller) DownloadTranslation(ctx *gin.Context) {
-	taskID := ctx.Param("taskID")
+	claims, exists := middleware.GetCurrentUser(ctx)
+	if !exists {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
 
-	content, err := c.svc.GetTranslation(ctx.Request.Context(), taskID)
+	content, err := c.svc.GetTranslation(ctx.Request.Context(), ctx.Param("taskID"), claims.UserID)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		switch {
+		case errors.Is(err, service.ErrInvalidTask), errors.Is(err, service.ErrTaskNotFound):
+			ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		default:
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
 		return
 	}
 
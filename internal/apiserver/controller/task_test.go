@@ -0,0 +1,173 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmualex2023/i18n-translation/internal/apiserver/config"
+	"github.com/xmualex2023/i18n-translation/internal/apiserver/model"
+	"github.com/xmualex2023/i18n-translation/internal/apiserver/repository"
+	"github.com/xmualex2023/i18n-translation/internal/apiserver/service"
+	"github.com/xmualex2023/i18n-translation/internal/pkg/auth"
+	"github.com/xmualex2023/i18n-translation/internal/pkg/middleware"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// testServer 使用真实认证中间件的路由，任务存储在 mock 的 MongoDB 中
+type testServer struct {
+	cfg    *config.Config
+	cache  auth.TokenCache
+	maker  *auth.JWTMaker
+	userID primitive.ObjectID
+	token  string
+}
+
+func newTestServer(t *testing.T) *testServer {
+	mr, err := miniredis.Run()
+	require.NoError(t, err)
+	t.Cleanup(mr.Close)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	s := &testServer{cfg: config.DefaultConfig(), userID: primitive.NewObjectID()}
+	s.cache = auth.NewRedisTokenCache(client, "token", time.Hour)
+	s.maker = auth.NewJWTMaker(s.cfg.JWT.Secret, s.cache)
+	s.token, _, err = s.maker.CreateToken(context.Background(), s.userID, time.Hour)
+	require.NoError(t, err)
+	gin.SetMode(gin.TestMode)
+	return s
+}
+
+// router 注册 handler，服务使用 mt 的数据库
+func (s *testServer) router(mt *mtest.T, method, path string, handler func(IController) gin.HandlerFunc) *gin.Engine {
+	svc := service.NewService(s.cfg, repository.NewRepositoryWithDatabase(mt.DB), nil, nil, s.cache, nil, nil)
+	r := gin.New()
+	r.Handle(method, path, middleware.AuthMiddleware(s.maker), handler(NewController(svc)))
+	return r
+}
+
+// do 以当前用户发送请求
+func (s *testServer) do(r *gin.Engine, method, path string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set("Authorization", "Bearer "+s.token)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// taskResult find 任务的响应
+func taskResult(mt *mtest.T, task *model.Task) bson.D {
+	data, err := bson.Marshal(task)
+	require.NoError(mt, err)
+	var doc bson.D
+	require.NoError(mt, bson.Unmarshal(data, &doc))
+	return mtest.CreateCursorResponse(0, "test.tasks", mtest.FirstBatch, doc)
+}
+
+// assertOnlyFind 只读取了任务，没有修改
+func assertOnlyFind(mt *mtest.T) {
+	for _, e := range mt.GetAllStartedEvents() {
+		assert.Equal(mt, "find", e.CommandName)
+	}
+}
+
+func TestDeleteTask(t *testing.T) {
+	s := newTestServer(t)
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	tests := []struct {
+		name   string
+		owner  primitive.ObjectID
+		status model.TaskStatus
+		code   int
+	}{
+		// 其他用户的任务返回 404，不暴露任务是否存在
+		{name: "NotOwned", owner: primitive.NewObjectID(), status: model.TaskStatusCompleted, code: http.StatusNotFound},
+		// 执行中的任务不能删除
+		{name: "Running", owner: s.userID, status: model.TaskStatusProcessing, code: http.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			r := s.router(mt, http.MethodDelete, "/tasks/:taskID", func(c IController) gin.HandlerFunc { return c.DeleteTask })
+			task := &model.Task{ID: primitive.NewObjectID(), UserID: tt.owner, Status: tt.status}
+			mt.AddMockResponses(taskResult(mt, task))
+
+			w := s.do(r, http.MethodDelete, "/tasks/"+task.ID.Hex())
+			assert.Equal(mt, tt.code, w.Code)
+			assertOnlyFind(mt)
+		})
+	}
+}
+
+func TestExecuteTranslation(t *testing.T) {
+	s := newTestServer(t)
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("NotOwned", func(mt *mtest.T) {
+		r := s.router(mt, http.MethodPost, "/tasks/:taskID/translate", func(c IController) gin.HandlerFunc { return c.ExecuteTranslation })
+		task := &model.Task{ID: primitive.NewObjectID(), UserID: primitive.NewObjectID(), Status: model.TaskStatusPending}
+		mt.AddMockResponses(taskResult(mt, task))
+
+		w := s.do(r, http.MethodPost, "/tasks/"+task.ID.Hex()+"/translate")
+		assert.Equal(mt, http.StatusNotFound, w.Code)
+		assertOnlyFind(mt)
+	})
+
+	mt.Run("InvalidID", func(mt *mtest.T) {
+		r := s.router(mt, http.MethodPost, "/tasks/:taskID/translate", func(c IController) gin.HandlerFunc { return c.ExecuteTranslation })
+
+		w := s.do(r, http.MethodPost, "/tasks/invalid/translate")
+		assert.Equal(mt, http.StatusNotFound, w.Code)
+		assert.Empty(mt, mt.GetAllStartedEvents())
+	})
+}
+
+// TestReadTask 测试其他用户的任务状态和翻译结果不可读取
+func TestReadTask(t *testing.T) {
+	s := newTestServer(t)
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	tests := []struct {
+		name    string
+		path    string
+		handler func(IController) gin.HandlerFunc
+	}{
+		{name: "Status", path: "/tasks/:taskID", handler: func(c IController) gin.HandlerFunc { return c.GetTaskStatus }},
+		{name: "Download", path: "/tasks/:taskID/download", handler: func(c IController) gin.HandlerFunc { return c.DownloadTranslation }},
+	}
+
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			r := s.router(mt, http.MethodGet, tt.path, tt.handler)
+			path := func(id string) string { return strings.Replace(tt.path, ":taskID", id, 1) }
+
+			other := &model.Task{ID: primitive.NewObjectID(), UserID: primitive.NewObjectID(), Status: model.TaskStatusCompleted, ResultContent: `{"a":"b"}`}
+			own := &model.Task{ID: primitive.NewObjectID(), UserID: s.userID, Status: model.TaskStatusCompleted, ResultContent: `{"a":"b"}`}
+			mt.AddMockResponses(taskResult(mt, other), taskResult(mt, own))
+
+			w := s.do(r, http.MethodGet, path(other.ID.Hex()))
+			assert.Equal(mt, http.StatusNotFound, w.Code)
+			assert.NotContains(mt, w.Body.String(), other.ID.Hex())
+
+			w = s.do(r, http.MethodGet, path(own.ID.Hex()))
+			assert.Equal(mt, http.StatusOK, w.Code)
+
+			assert.Equal(mt, http.StatusNotFound, s.do(r, http.MethodGet, path("invalid")).Code)
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xmualex2023/i18n-translation/internal/apiserver/model"
+	"github.com/xmualex2023/i18n-translation/internal/apiserver/service"
+	"github.com/xmualex2023/i18n-translation/internal/pkg/middleware"
+)
+
+// GetUsage get current user token usage and cost
+func (c *Controller) GetUsage(ctx *gin.Context) {
+	var req model.UsageRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	claims, exists := middleware.GetCurrentUser(ctx)
+	if !exists {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	resp, err := c.svc.GetUsage(ctx.Request.Context(), &req, claims.UserID)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidUsagePeriod) || errors.Is(err, service.ErrInvalidUsageRange) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, resp)
+}
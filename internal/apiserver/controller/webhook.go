@@ -0,0 +1,101 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xmualex2023/i18n-translation/internal/apiserver/model"
+	"github.com/xmualex2023/i18n-translation/internal/apiserver/service"
+	"github.com/xmualex2023/i18n-translation/internal/pkg/middleware"
+)
+
+// CreateWebhook register webhook of the current user
+func (c *Controller) CreateWebhook(ctx *gin.Context) {
+	var req model.CreateWebhookRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	claims, exists := middleware.GetCurrentUser(ctx)
+	if !exists {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	resp, err := c.svc.CreateWebhook(ctx.Request.Context(), &req, claims.UserID)
+	if err != nil {
+		c.webhookError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, resp)
+}
+
+// ListWebhooks list webhooks of the current user
+func (c *Controller) ListWebhooks(ctx *gin.Context) {
+	claims, exists := middleware.GetCurrentUser(ctx)
+	if !exists {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	resp, err := c.svc.ListWebhooks(ctx.Request.Context(), claims.UserID)
+	if err != nil {
+		c.webhookError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, resp)
+}
+
+// DeleteWebhook delete webhook of the current user
+func (c *Controller) DeleteWebhook(ctx *gin.Context) {
+	claims, exists := middleware.GetCurrentUser(ctx)
+	if !exists {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	if err := c.svc.DeleteWebhook(ctx.Request.Context(), ctx.Param("webhookID"), claims.UserID); err != nil {
+		c.webhookError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "webhook deleted"})
+}
+
+// ListWebhookDeliveries list deliveries of the webhook with their attempts
+func (c *Controller) ListWebhookDeliveries(ctx *gin.Context) {
+	var req model.WebhookDeliveryListRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	claims, exists := middleware.GetCurrentUser(ctx)
+	if !exists {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	resp, err := c.svc.ListWebhookDeliveries(ctx.Request.Context(), ctx.Param("webhookID"), &req, claims.UserID)
+	if err != nil {
+		c.webhookError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, resp)
+}
+
+func (c *Controller) webhookError(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidWebhook):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrWebhookNotFound):
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
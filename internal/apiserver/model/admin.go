@@ -0,0 +1,63 @@
+package model
+
+import (
+	"time"
+
+	"github.com/xmualex2023/i18n-translation/internal/pkg/queue"
+)
+
+// DeadLetterListRequest dead letter list request
+type DeadLetterListRequest struct {
+	Offset int64 `form:"offset" binding:"omitempty,min=0"`
+	Limit  int64 `form:"limit" binding:"omitempty,min=1,max=100"`
+}
+
+// DeadLetterListResponse dead letter list response
+type DeadLetterListResponse struct {
+	Items []*queue.DeadLetter `json:"items"`
+	Total int64               `json:"total"`
+}
+
+// DeadLetterPurgeResponse dead letter purge response
+type DeadLetterPurgeResponse struct {
+	Purged int64 `json:"purged"`
+}
+
+// ScheduledListRequest scheduled task list request
+type ScheduledListRequest struct {
+	Offset int64 `form:"offset" binding:"omitempty,min=0"`
+	Limit  int64 `form:"limit" binding:"omitempty,min=1,max=100"`
+}
+
+// ScheduledListResponse scheduled task list response
+type ScheduledListResponse struct {
+	Items []*queue.ScheduledTask `json:"items"`
+	Total int64                  `json:"total"`
+}
+
+// QueueConsumersResponse pending task count of each queue consumer
+type QueueConsumersResponse struct {
+	Consumers map[string]int64 `json:"consumers"`
+}
+
+// WorkerPoolResponse worker pool status
+type WorkerPoolResponse struct {
+	Size          int        `json:"size"`
+	Active        int        `json:"active"`
+	Min           int        `json:"min"`
+	Max           int        `json:"max"`
+	Autoscale     bool       `json:"autoscale"`
+	Desired       int        `json:"desired,omitempty"`
+	QueueDepth    int64      `json:"queue_depth"`
+	EstimatedWait float64    `json:"estimated_wait_seconds"`
+	TaskDuration  float64    `json:"task_duration_seconds"`
+	LLMLatency    float64    `json:"llm_latency_seconds"`
+	LastScaleAt   *time.Time `json:"last_scale_at,omitempty"`
+}
+
+// WorkerPoolUpdateRequest resize worker pool request, omitted fields are left unchanged
+type WorkerPoolUpdateRequest struct {
+	Size int `json:"size" binding:"omitempty,min=1,max=1000"`
+	Min  int `json:"min" binding:"omitempty,min=1,max=1000"`
+	Max  int `json:"max" binding:"omitempty,min=1,max=1000"`
+}
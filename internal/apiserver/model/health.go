@@ -0,0 +1,15 @@
+package model
+
+// HealthStatus service health status
+type HealthStatus string
+
+const (
+	HealthStatusOK       HealthStatus = "ok"       // 正常
+	HealthStatusDegraded HealthStatus = "degraded" // 翻译服务熔断中
+)
+
+// HealthResponse health check response
+type HealthResponse struct {
+	Status   HealthStatus      `json:"status"`
+	Breakers map[string]string `json:"breakers"`
+}
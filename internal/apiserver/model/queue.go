@@ -3,22 +3,64 @@ package model
 import (
 	"encoding/json"
 	"time"
+
+	"github.com/xmualex2023/i18n-translation/internal/pkg/queue"
+)
+
+const (
+	// TranslationTaskType queue task type name of TranslationTask
+	TranslationTaskType = "translation"
+	// TranslationTaskVersion schema version of TranslationTask, bump it on incompatible changes
+	// and register a migration with queue.RegisterMigration
+	TranslationTaskVersion = 1
 )
 
+func init() {
+	queue.Register(TranslationTaskType, TranslationTaskVersion, func() queue.Task { return &TranslationTask{} })
+}
+
 // TranslationTask translation task
 type TranslationTask struct {
-	ID            string    `json:"id"`
-	UserID        string    `json:"user_id"`
-	SourceLang    string    `json:"source_lang"`
-	TargetLang    string    `json:"target_lang"`
-	SourceContent string    `json:"source_content"`
-	CreatedAt     time.Time `json:"created_at"`
+	ID            string         `json:"id"`
+	UserID        string         `json:"user_id"`
+	SourceLang    string         `json:"source_lang"`
+	TargetLang    string         `json:"target_lang"`
+	SourceContent string         `json:"source_content"`
+	Priority      queue.Priority `json:"priority,omitempty"`
+	Attempts      int            `json:"attempts"`
+	MaxRetries    int            `json:"max_retries,omitempty"`
+	Timeout       time.Duration  `json:"timeout,omitempty"`
+	CreatedAt     time.Time      `json:"created_at"`
 }
 
 func (t *TranslationTask) GetID() string {
 	return t.ID
 }
 
+func (t *TranslationTask) GetOwner() string {
+	return t.UserID
+}
+
+func (t *TranslationTask) GetPriority() queue.Priority {
+	return t.Priority
+}
+
+func (t *TranslationTask) GetAttempts() int {
+	return t.Attempts
+}
+
+func (t *TranslationTask) SetAttempts(attempts int) {
+	t.Attempts = attempts
+}
+
+func (t *TranslationTask) GetMaxRetries() int {
+	return t.MaxRetries
+}
+
+func (t *TranslationTask) GetTimeout() time.Duration {
+	return t.Timeout
+}
+
 func (t *TranslationTask) MarshalBinary() ([]byte, error) {
 	return json.Marshal(t)
 }
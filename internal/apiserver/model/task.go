@@ -3,6 +3,7 @@ package model
 import (
 	"time"
 
+	"github.com/xmualex2023/i18n-translation/internal/pkg/queue"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
@@ -11,23 +12,142 @@ type TaskStatus string
 
 const (
 	TaskStatusPending    TaskStatus = "pending"    // 等待中
+	TaskStatusScheduled  TaskStatus = "scheduled"  // 等待定时执行
+	TaskStatusQueued     TaskStatus = "queued"     // 排队中
 	TaskStatusProcessing TaskStatus = "processing" // 处理中
 	TaskStatusCompleted  TaskStatus = "completed"  // 已完成
 	TaskStatusFailed     TaskStatus = "failed"     // 失败
+	TaskStatusCancelled  TaskStatus = "cancelled"  // 已取消
 )
 
+// TaskFormat format of the source content
+type TaskFormat string
+
+const (
+	TaskFormatJSON TaskFormat = "json" // JSON 文档，按片段翻译
+	TaskFormatText TaskFormat = "text" // 纯文本
+)
+
+// taskTransitions allowed status transitions, completed and cancelled tasks are final
+var taskTransitions = map[TaskStatus][]TaskStatus{
+	TaskStatusPending:    {TaskStatusQueued, TaskStatusScheduled, TaskStatusCancelled},
+	TaskStatusScheduled:  {TaskStatusProcessing, TaskStatusPending, TaskStatusFailed, TaskStatusCancelled},
+	TaskStatusQueued:     {TaskStatusProcessing, TaskStatusFailed, TaskStatusCancelled},
+	TaskStatusProcessing: {TaskStatusQueued, TaskStatusCompleted, TaskStatusFailed, TaskStatusCancelled},
+	TaskStatusFailed:     {TaskStatusQueued, TaskStatusScheduled},
+}
+
+// CanTransition whether the task can move from status s to status to
+func (s TaskStatus) CanTransition(to TaskStatus) bool {
+	for _, next := range taskTransitions[s] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// IsFinal whether the task finished with the status
+func (s TaskStatus) IsFinal() bool {
+	return s == TaskStatusCompleted || s == TaskStatusFailed || s == TaskStatusCancelled
+}
+
 // Task translation task model
 type Task struct {
 	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
 	UserID        primitive.ObjectID `bson:"user_id" json:"user_id"`
 	Status        TaskStatus         `bson:"status" json:"status"`
+	Priority      queue.Priority     `bson:"priority,omitempty" json:"priority,omitempty"`
 	SourceLang    string             `bson:"source_lang" json:"source_lang"`
 	TargetLang    string             `bson:"target_lang" json:"target_lang"`
 	SourceContent string             `bson:"source_content" json:"source_content"`
+	Format        TaskFormat         `bson:"format,omitempty" json:"format,omitempty"`
 	ResultContent string             `bson:"result_content,omitempty" json:"result_content,omitempty"`
 	Error         string             `bson:"error,omitempty" json:"error,omitempty"`
-	CreatedAt     time.Time          `bson:"created_at" json:"created_at"`
-	UpdatedAt     time.Time          `bson:"updated_at" json:"updated_at"`
+
+	// schedule
+	RunAt *time.Time `bson:"run_at,omitempty" json:"run_at,omitempty"`
+
+	// retry
+	Attempts   int `bson:"attempts" json:"attempts"`
+	MaxRetries int `bson:"max_retries,omitempty" json:"max_retries,omitempty"` // 0 表示使用队列默认值
+
+	// time limit of each attempt, 0 means worker.task_timeout
+	Timeout time.Duration `bson:"timeout,omitempty" json:"-"`
+
+	// segment progress of JSON documents
+	Progress *TaskProgress `bson:"progress,omitempty" json:"progress,omitempty"`
+
+	// token usage and cost
+	Model            string  `bson:"model,omitempty" json:"model,omitempty"`
+	PromptTokens     int     `bson:"prompt_tokens" json:"prompt_tokens"`
+	CompletionTokens int     `bson:"completion_tokens" json:"completion_tokens"`
+	Cost             float64 `bson:"cost" json:"cost"`
+
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+
+	// contents were removed by the retention policy
+	AnonymizedAt *time.Time `bson:"anonymized_at,omitempty" json:"anonymized_at,omitempty"`
+}
+
+// ArchiveReason why the task was archived
+type ArchiveReason string
+
+const (
+	ArchiveReasonDeleted   ArchiveReason = "deleted"   // 用户删除
+	ArchiveReasonRetention ArchiveReason = "retention" // 超过保留期限
+)
+
+// TaskArchive metadata of a removed task without its contents, kept for usage reports
+type TaskArchive struct {
+	ID               primitive.ObjectID `bson:"_id" json:"id"` // 原任务 id
+	UserID           primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Status           TaskStatus         `bson:"status" json:"status"`
+	Priority         queue.Priority     `bson:"priority,omitempty" json:"priority,omitempty"`
+	SourceLang       string             `bson:"source_lang" json:"source_lang"`
+	TargetLang       string             `bson:"target_lang" json:"target_lang"`
+	Format           TaskFormat         `bson:"format,omitempty" json:"format,omitempty"`
+	Attempts         int                `bson:"attempts" json:"attempts"`
+	Model            string             `bson:"model,omitempty" json:"model,omitempty"`
+	PromptTokens     int                `bson:"prompt_tokens" json:"prompt_tokens"`
+	CompletionTokens int                `bson:"completion_tokens" json:"completion_tokens"`
+	Cost             float64            `bson:"cost" json:"cost"`
+	CreatedAt        time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt        time.Time          `bson:"updated_at" json:"updated_at"`
+	ArchivedAt       time.Time          `bson:"archived_at" json:"archived_at"`
+	Reason           ArchiveReason      `bson:"reason" json:"reason"`
+}
+
+// NewTaskArchive archive of the task, contents are left out
+func NewTaskArchive(task *Task, reason ArchiveReason) *TaskArchive {
+	return &TaskArchive{
+		ID:               task.ID,
+		UserID:           task.UserID,
+		Status:           task.Status,
+		Priority:         task.Priority,
+		SourceLang:       task.SourceLang,
+		TargetLang:       task.TargetLang,
+		Format:           task.Format,
+		Attempts:         task.Attempts,
+		Model:            task.Model,
+		PromptTokens:     task.PromptTokens,
+		CompletionTokens: task.CompletionTokens,
+		Cost:             task.Cost,
+		CreatedAt:        task.CreatedAt,
+		UpdatedAt:        task.UpdatedAt,
+		ArchivedAt:       time.Now(),
+		Reason:           reason,
+	}
+}
+
+// TaskProgress translation progress of document segments, updated by the worker while running
+type TaskProgress struct {
+	Total      int        `bson:"total" json:"total"`
+	Translated int        `bson:"translated" json:"translated"` // 包括命中缓存的片段
+	Cached     int        `bson:"cached" json:"cached"`
+	Failed     int        `bson:"failed" json:"failed"`
+	ETA        *time.Time `bson:"eta,omitempty" json:"eta,omitempty"` // 预计完成时间
 }
 
 // CreateTaskRequest create task request
@@ -35,13 +155,70 @@ type CreateTaskRequest struct {
 	SourceLang    string `json:"source_lang" binding:"required"`
 	TargetLang    string `json:"target_lang" binding:"required"`
 	SourceContent string `json:"source_content" binding:"required"`
+	MaxRetries    int    `json:"max_retries" binding:"omitempty,min=0,max=10"`
+	Priority      string `json:"priority" binding:"omitempty,oneof=high normal low"` // 默认 normal
+	Timeout       string `json:"timeout"`                                            // e.g. 10m，默认 worker.task_timeout
+}
+
+// ExecuteTaskRequest execute task request, runs immediately if neither RunAt nor Delay is set
+type ExecuteTaskRequest struct {
+	RunAt *time.Time `json:"run_at"` // RFC3339
+	Delay string     `json:"delay"`  // e.g. 30m, 2h
 }
 
 // TaskResponse task response
 type TaskResponse struct {
-	ID        string     `json:"id"`
-	Status    TaskStatus `json:"status"`
-	CreatedAt time.Time  `json:"created_at"`
-	UpdatedAt time.Time  `json:"updated_at"`
-	Error     string     `json:"error,omitempty"`
+	ID               string        `json:"id"`
+	Status           TaskStatus    `json:"status"`
+	Priority         string        `json:"priority,omitempty"`
+	SourceLang       string        `json:"source_lang,omitempty"`
+	TargetLang       string        `json:"target_lang,omitempty"`
+	Format           TaskFormat    `json:"format,omitempty"`
+	CreatedAt        time.Time     `json:"created_at"`
+	UpdatedAt        time.Time     `json:"updated_at"`
+	Error            string        `json:"error,omitempty"`
+	Attempts         int           `json:"attempts,omitempty"`
+	RunAt            *time.Time    `json:"run_at,omitempty"`
+	Progress         *TaskProgress `json:"progress,omitempty"`
+	Model            string        `json:"model,omitempty"`
+	PromptTokens     int           `json:"prompt_tokens,omitempty"`
+	CompletionTokens int           `json:"completion_tokens,omitempty"`
+	Cost             float64       `json:"cost,omitempty"`
+}
+
+// ListTasksRequest list tasks request, status can be repeated
+type ListTasksRequest struct {
+	Status      []string  `form:"status" binding:"omitempty,dive,oneof=pending scheduled queued processing completed failed cancelled"`
+	SourceLang  string    `form:"source_lang"`
+	TargetLang  string    `form:"target_lang"`
+	Format      string    `form:"format" binding:"omitempty,oneof=json text"`
+	CreatedFrom time.Time `form:"created_from"` // RFC3339，包含
+	CreatedTo   time.Time `form:"created_to"`   // RFC3339，不包含
+	Sort        string    `form:"sort" binding:"omitempty,oneof=created_at -created_at updated_at -updated_at"`
+	Cursor      string    `form:"cursor"`
+	Limit       int64     `form:"limit" binding:"omitempty,min=1,max=100"`
+}
+
+// TaskListResponse list tasks response, next_cursor is empty on the last page
+type TaskListResponse struct {
+	Items      []*TaskResponse `json:"items"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+}
+
+// TaskQuery task list query of a user, sorted by SortField then _id
+type TaskQuery struct {
+	UserID      primitive.ObjectID
+	Statuses    []TaskStatus
+	SourceLang  string
+	TargetLang  string
+	Format      TaskFormat
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+	SortField   string // created_at 或 updated_at
+	Desc        bool
+	Limit       int64
+
+	// keyset of the last task of the previous page
+	AfterValue time.Time
+	AfterID    primitive.ObjectID
 }
@@ -0,0 +1,59 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTaskTransitions(t *testing.T) {
+	statuses := []TaskStatus{
+		TaskStatusPending, TaskStatusScheduled, TaskStatusQueued, TaskStatusProcessing,
+		TaskStatusCompleted, TaskStatusFailed, TaskStatusCancelled,
+	}
+	// 允许的状态变化，其他均不允许
+	allowed := map[[2]TaskStatus]bool{
+		{TaskStatusPending, TaskStatusQueued}:       true,
+		{TaskStatusPending, TaskStatusScheduled}:    true,
+		{TaskStatusPending, TaskStatusCancelled}:    true,
+		{TaskStatusScheduled, TaskStatusProcessing}: true,
+		{TaskStatusScheduled, TaskStatusPending}:    true,
+		{TaskStatusScheduled, TaskStatusFailed}:     true,
+		{TaskStatusScheduled, TaskStatusCancelled}:  true,
+		{TaskStatusQueued, TaskStatusProcessing}:    true,
+		{TaskStatusQueued, TaskStatusFailed}:        true,
+		{TaskStatusQueued, TaskStatusCancelled}:     true,
+		{TaskStatusProcessing, TaskStatusQueued}:    true,
+		{TaskStatusProcessing, TaskStatusCompleted}: true,
+		{TaskStatusProcessing, TaskStatusFailed}:    true,
+		{TaskStatusProcessing, TaskStatusCancelled}: true,
+		{TaskStatusFailed, TaskStatusQueued}:        true,
+		{TaskStatusFailed, TaskStatusScheduled}:     true,
+	}
+
+	for _, from := range statuses {
+		for _, to := range statuses {
+			want := allowed[[2]TaskStatus{from, to}]
+			assert.Equal(t, want, from.CanTransition(to), "%s -> %s", from, to)
+		}
+	}
+	assert.False(t, TaskStatus("unknown").CanTransition(TaskStatusQueued))
+}
+
+func TestTaskStatusIsFinal(t *testing.T) {
+	tests := []struct {
+		status TaskStatus
+		final  bool
+	}{
+		{TaskStatusPending, false},
+		{TaskStatusScheduled, false},
+		{TaskStatusQueued, false},
+		{TaskStatusProcessing, false},
+		{TaskStatusCompleted, true},
+		{TaskStatusFailed, true},
+		{TaskStatusCancelled, true},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.final, tt.status.IsFinal(), tt.status)
+	}
+}
@@ -0,0 +1,55 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// UsagePeriod usage aggregation period
+type UsagePeriod string
+
+const (
+	UsagePeriodDay   UsagePeriod = "day"   // 按天汇总
+	UsagePeriodMonth UsagePeriod = "month" // 按月汇总
+)
+
+// Layout date layout of the period
+func (p UsagePeriod) Layout() string {
+	if p == UsagePeriodMonth {
+		return "2006-01"
+	}
+	return "2006-01-02"
+}
+
+// Usage user token usage aggregated by period
+type Usage struct {
+	ID               primitive.ObjectID `bson:"_id,omitempty" json:"-"`
+	UserID           primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Period           UsagePeriod        `bson:"period" json:"period"`
+	Date             string             `bson:"date" json:"date"` // 2006-01-02 或 2006-01
+	Tasks            int64              `bson:"tasks" json:"tasks"`
+	PromptTokens     int64              `bson:"prompt_tokens" json:"prompt_tokens"`
+	CompletionTokens int64              `bson:"completion_tokens" json:"completion_tokens"`
+	Cost             float64            `bson:"cost" json:"cost"`
+	UpdatedAt        time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// UsageRequest usage query request
+type UsageRequest struct {
+	Period string `form:"period"` // day, month
+	From   string `form:"from"`   // 起始日期（包含），格式同 period
+	To     string `form:"to"`     // 结束日期（包含），格式同 period
+}
+
+// UsageResponse usage query response
+type UsageResponse struct {
+	Period           UsagePeriod `json:"period"`
+	From             string      `json:"from"`
+	To               string      `json:"to"`
+	Items            []*Usage    `json:"items"`
+	Tasks            int64       `json:"tasks"`
+	PromptTokens     int64       `json:"prompt_tokens"`
+	CompletionTokens int64       `json:"completion_tokens"`
+	Cost             float64     `json:"cost"`
+}
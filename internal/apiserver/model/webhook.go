@@ -0,0 +1,116 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// WebhookEvent event sent to webhooks
+type WebhookEvent string
+
+const (
+	WebhookEventTaskCompleted WebhookEvent = "task.completed"
+	WebhookEventTaskFailed    WebhookEvent = "task.failed"
+	WebhookEventTaskCancelled WebhookEvent = "task.cancelled"
+)
+
+// WebhookEvents all events, webhooks without events receive all of them
+var WebhookEvents = []WebhookEvent{WebhookEventTaskCompleted, WebhookEventTaskFailed, WebhookEventTaskCancelled}
+
+// WebhookEventOf event of the task status, false if the status doesn't notify webhooks
+func WebhookEventOf(status TaskStatus) (WebhookEvent, bool) {
+	switch status {
+	case TaskStatusCompleted:
+		return WebhookEventTaskCompleted, true
+	case TaskStatusFailed:
+		return WebhookEventTaskFailed, true
+	case TaskStatusCancelled:
+		return WebhookEventTaskCancelled, true
+	default:
+		return "", false
+	}
+}
+
+// Webhook webhook endpoint of the user, it receives events of one task or all tasks of the user
+type Webhook struct {
+	ID        primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	UserID    primitive.ObjectID  `bson:"user_id" json:"user_id"`
+	TaskID    *primitive.ObjectID `bson:"task_id,omitempty" json:"task_id,omitempty"` // 为空时接收用户所有任务的事件
+	URL       string              `bson:"url" json:"url"`
+	Secret    string              `bson:"secret" json:"-"`
+	Events    []WebhookEvent      `bson:"events" json:"events"`
+	CreatedAt time.Time           `bson:"created_at" json:"created_at"`
+}
+
+// DeliveryStatus webhook delivery status
+type DeliveryStatus string
+
+const (
+	DeliveryStatusPending   DeliveryStatus = "pending"   // 等待发送或重试
+	DeliveryStatusSucceeded DeliveryStatus = "succeeded" // 发送成功
+	DeliveryStatusFailed    DeliveryStatus = "failed"    // 重试次数用尽
+)
+
+// WebhookDelivery event delivery to a webhook, with all its attempts
+type WebhookDelivery struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	WebhookID     primitive.ObjectID `bson:"webhook_id" json:"webhook_id"`
+	UserID        primitive.ObjectID `bson:"user_id" json:"-"`
+	TaskID        primitive.ObjectID `bson:"task_id" json:"task_id"`
+	Event         WebhookEvent       `bson:"event" json:"event"`
+	URL           string             `bson:"url" json:"url"`
+	Payload       string             `bson:"payload" json:"payload"`
+	Status        DeliveryStatus     `bson:"status" json:"status"`
+	Attempts      []DeliveryAttempt  `bson:"attempts" json:"attempts"`
+	NextAttemptAt time.Time          `bson:"next_attempt_at" json:"next_attempt_at"`
+	CreatedAt     time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt     time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// DeliveryAttempt one attempt of a delivery
+type DeliveryAttempt struct {
+	At         time.Time `bson:"at" json:"at"`
+	StatusCode int       `bson:"status_code,omitempty" json:"status_code,omitempty"`
+	Error      string    `bson:"error,omitempty" json:"error,omitempty"`
+	DurationMs int64     `bson:"duration_ms" json:"duration_ms"`
+}
+
+// WebhookPayload body of webhook requests
+type WebhookPayload struct {
+	ID        string        `json:"id"` // delivery id
+	Event     WebhookEvent  `json:"event"`
+	CreatedAt time.Time     `json:"created_at"`
+	Task      *TaskResponse `json:"task"`
+}
+
+// CreateWebhookRequest create webhook request
+type CreateWebhookRequest struct {
+	URL    string         `json:"url" binding:"required,url"`
+	TaskID string         `json:"task_id"`                                                                         // 可选，只接收该任务的事件
+	Events []WebhookEvent `json:"events" binding:"omitempty,dive,oneof=task.completed task.failed task.cancelled"` // 默认所有事件
+	Secret string         `json:"secret" binding:"omitempty,min=16,max=128"`                                       // 默认自动生成
+}
+
+// CreateWebhookResponse create webhook response, the secret is only returned once
+type CreateWebhookResponse struct {
+	*Webhook
+	Secret string `json:"secret"`
+}
+
+// WebhookListResponse webhook list response
+type WebhookListResponse struct {
+	Items []*Webhook `json:"items"`
+}
+
+// WebhookDeliveryListRequest webhook delivery list request
+type WebhookDeliveryListRequest struct {
+	Offset int64 `form:"offset" binding:"omitempty,min=0"`
+	Limit  int64 `form:"limit" binding:"omitempty,min=1,max=100"`
+}
+
+// WebhookDeliveryListResponse webhook delivery list response, newest first
+type WebhookDeliveryListResponse struct {
+	Items []*WebhookDelivery `json:"items"`
+	Total int64              `json:"total"`
+}
@@ -2,8 +2,10 @@ package repository
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/xmualex2023/i18n-translation/internal/apiserver/config"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
@@ -23,7 +25,54 @@ func NewRepository(cfg *config.Config) (*Repository, error) {
 		return nil, err
 	}
 
-	return &Repository{
-		db: client.Database(cfg.MongoDB.Database),
-	}, nil
+	repo := NewRepositoryWithDatabase(client.Database(cfg.MongoDB.Database))
+	if err := repo.ensureIndexes(ctx); err != nil {
+		return nil, err
+	}
+
+	return repo, nil
+}
+
+// NewRepositoryWithDatabase create repository on a connected database, indexes are not created
+func NewRepositoryWithDatabase(db *mongo.Database) *Repository {
+	return &Repository{db: db}
+}
+
+// ensureIndexes create the indexes needed by queries
+func (r *Repository) ensureIndexes(ctx context.Context) error {
+	indexes := map[string][]mongo.IndexModel{
+		usageCollection: {
+			{
+				Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "period", Value: 1}, {Key: "date", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			},
+		},
+		taskCollection: {
+			// task listing sorted by created or updated time, optionally filtered by status or languages
+			{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}},
+			{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "updated_at", Value: -1}, {Key: "_id", Value: -1}}},
+			{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "status", Value: 1}, {Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}},
+			{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "source_lang", Value: 1}, {Key: "target_lang", Value: 1}, {Key: "created_at", Value: -1}}},
+			// expired tasks of the retention policy
+			{Keys: bson.D{{Key: "status", Value: 1}, {Key: "updated_at", Value: 1}}},
+		},
+		archiveCollection: {
+			{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		},
+		webhookCollection: {
+			{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "events", Value: 1}}},
+			{Keys: bson.D{{Key: "task_id", Value: 1}}, Options: options.Index().SetSparse(true)},
+		},
+		deliveryCollection: {
+			// pending deliveries by due time, and the delivery log of webhooks
+			{Keys: bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_at", Value: 1}}},
+			{Keys: bson.D{{Key: "webhook_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		},
+	}
+	for name, models := range indexes {
+		if _, err := r.db.Collection(name).Indexes().CreateMany(ctx, models); err != nil {
+			return fmt.Errorf("failed to create indexes of %s, error: %w", name, err)
+		}
+	}
+	return nil
 }
@@ -0,0 +1,32 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// newMockTest 使用 mock 部署的测试，不连接 MongoDB，校验发送的命令
+func newMockTest(t *testing.T) *mtest.T {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	t.Cleanup(mt.Close)
+	return mt
+}
+
+// nextCommand 下一条发送的命令
+func nextCommand(mt *mtest.T, name string) bson.M {
+	e := mt.GetStartedEvent()
+	require.NotNil(mt, e, "no %s command", name)
+	require.Equal(mt, name, e.CommandName)
+
+	var cmd bson.M
+	require.NoError(mt, bson.Unmarshal(e.Command, &cmd))
+	return cmd
+}
+
+// writeResult update 和 delete 命令的响应
+func writeResult(n int) bson.D {
+	return mtest.CreateSuccessResponse(bson.E{Key: "n", Value: n}, bson.E{Key: "nModified", Value: n})
+}
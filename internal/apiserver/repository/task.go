@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
@@ -9,9 +10,19 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-const taskCollection = "tasks"
+const (
+	taskCollection    = "tasks"
+	archiveCollection = "task_archive"
+)
+
+var (
+	ErrTaskNotFound = errors.New("task not found")
+	// ErrStatusConflict the task is missing or its status changed meanwhile
+	ErrStatusConflict = errors.New("task status changed")
+)
 
 // CreateTask create translation task
 func (r *Repository) CreateTask(ctx context.Context, task *model.Task) error {
@@ -19,8 +30,12 @@ func (r *Repository) CreateTask(ctx context.Context, task *model.Task) error {
 	task.UpdatedAt = time.Now()
 
 	collection := r.db.Collection(taskCollection)
-	_, err := collection.InsertOne(ctx, task)
-	return err
+	result, err := collection.InsertOne(ctx, task)
+	if err != nil {
+		return err
+	}
+	task.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
 }
 
 // GetTask get task info
@@ -30,7 +45,7 @@ func (r *Repository) GetTask(ctx context.Context, taskID primitive.ObjectID) (*m
 	var task model.Task
 	err := collection.FindOne(ctx, bson.M{"_id": taskID}).Decode(&task)
 	if err == mongo.ErrNoDocuments {
-		return nil, fmt.Errorf("task not found, id: %s", taskID.Hex())
+		return nil, fmt.Errorf("%w, id: %s", ErrTaskNotFound, taskID.Hex())
 	}
 	return &task, err
 }
@@ -48,3 +63,172 @@ func (r *Repository) UpdateTask(ctx context.Context, task *model.Task) error {
 	)
 	return err
 }
+
+// UpdateTaskIfStatus update task only if its stored status is one of from, like compare-and-set,
+// so concurrent updates can't overwrite each other's status
+func (r *Repository) UpdateTaskIfStatus(ctx context.Context, task *model.Task, from ...model.TaskStatus) error {
+	task.UpdatedAt = time.Now()
+
+	collection := r.db.Collection(taskCollection)
+	result, err := collection.UpdateOne(
+		ctx,
+		bson.M{"_id": task.ID, "status": bson.M{"$in": from}},
+		bson.M{"$set": task},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrStatusConflict
+	}
+	return nil
+}
+
+// UpdateTaskProgress update progress of a processing task only, the rest of the document is kept
+func (r *Repository) UpdateTaskProgress(ctx context.Context, taskID primitive.ObjectID, progress *model.TaskProgress) error {
+	collection := r.db.Collection(taskCollection)
+	_, err := collection.UpdateOne(
+		ctx,
+		bson.M{"_id": taskID, "status": model.TaskStatusProcessing},
+		bson.M{"$set": bson.M{"progress": progress, "updated_at": time.Now()}},
+	)
+	return err
+}
+
+// ListTasks list tasks of the query with keyset pagination, contents are not loaded
+func (r *Repository) ListTasks(ctx context.Context, query *model.TaskQuery) ([]*model.Task, error) {
+	filter := bson.M{"user_id": query.UserID}
+	if len(query.Statuses) > 0 {
+		filter["status"] = bson.M{"$in": query.Statuses}
+	}
+	if query.SourceLang != "" {
+		filter["source_lang"] = query.SourceLang
+	}
+	if query.TargetLang != "" {
+		filter["target_lang"] = query.TargetLang
+	}
+	switch query.Format {
+	case model.TaskFormatJSON:
+		filter["format"] = model.TaskFormatJSON
+	case model.TaskFormatText:
+		// tasks created before the format was recorded are taken as text
+		filter["format"] = bson.M{"$ne": model.TaskFormatJSON}
+	}
+	created := bson.M{}
+	if !query.CreatedFrom.IsZero() {
+		created["$gte"] = query.CreatedFrom
+	}
+	if !query.CreatedTo.IsZero() {
+		created["$lt"] = query.CreatedTo
+	}
+	if len(created) > 0 {
+		filter["created_at"] = created
+	}
+
+	order, op := 1, "$gt"
+	if query.Desc {
+		order, op = -1, "$lt"
+	}
+	if !query.AfterID.IsZero() {
+		filter["$or"] = bson.A{
+			bson.M{query.SortField: bson.M{op: query.AfterValue}},
+			bson.M{query.SortField: query.AfterValue, "_id": bson.M{op: query.AfterID}},
+		}
+	}
+
+	collection := r.db.Collection(taskCollection)
+	cursor, err := collection.Find(ctx, filter, options.Find().
+		SetSort(bson.D{{Key: query.SortField, Value: order}, {Key: "_id", Value: order}}).
+		SetLimit(query.Limit).
+		SetProjection(bson.M{"source_content": 0, "result_content": 0}))
+	if err != nil {
+		return nil, err
+	}
+
+	tasks := make([]*model.Task, 0)
+	if err := cursor.All(ctx, &tasks); err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+// finalStatuses statuses of finished tasks, only they are deleted or anonymized
+var finalStatuses = []model.TaskStatus{model.TaskStatusCompleted, model.TaskStatusFailed, model.TaskStatusCancelled}
+
+// ArchiveAndDeleteTasks save metadata of finished tasks to the archive, then delete them.
+// Tasks which are not finished anymore are kept, archiving again is harmless.
+func (r *Repository) ArchiveAndDeleteTasks(ctx context.Context, tasks []*model.Task, reason model.ArchiveReason) (int64, error) {
+	if len(tasks) == 0 {
+		return 0, nil
+	}
+
+	writes := make([]mongo.WriteModel, 0, len(tasks))
+	ids := make([]primitive.ObjectID, 0, len(tasks))
+	for _, task := range tasks {
+		writes = append(writes, mongo.NewReplaceOneModel().
+			SetFilter(bson.M{"_id": task.ID}).
+			SetReplacement(model.NewTaskArchive(task, reason)).
+			SetUpsert(true))
+		ids = append(ids, task.ID)
+	}
+	if _, err := r.db.Collection(archiveCollection).BulkWrite(ctx, writes); err != nil {
+		return 0, fmt.Errorf("failed to archive tasks, error: %w", err)
+	}
+
+	result, err := r.db.Collection(taskCollection).DeleteMany(ctx, bson.M{
+		"_id":    bson.M{"$in": ids},
+		"status": bson.M{"$in": finalStatuses},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete tasks, error: %w", err)
+	}
+	return result.DeletedCount, nil
+}
+
+// ListExpiredTasks finished tasks last updated before the time, the oldest first, contents
+// are not loaded. Anonymized tasks are skipped unless includeAnonymized.
+func (r *Repository) ListExpiredTasks(ctx context.Context, before time.Time, includeAnonymized bool, limit int64) ([]*model.Task, error) {
+	filter := bson.M{
+		"status":     bson.M{"$in": finalStatuses},
+		"updated_at": bson.M{"$lt": before},
+	}
+	if !includeAnonymized {
+		filter["anonymized_at"] = bson.M{"$exists": false}
+	}
+
+	collection := r.db.Collection(taskCollection)
+	cursor, err := collection.Find(ctx, filter, options.Find().
+		SetSort(bson.D{{Key: "updated_at", Value: 1}}).
+		SetLimit(limit).
+		SetProjection(bson.M{"source_content": 0, "result_content": 0}))
+	if err != nil {
+		return nil, err
+	}
+
+	tasks := make([]*model.Task, 0)
+	if err := cursor.All(ctx, &tasks); err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+// AnonymizeTasks remove contents of finished tasks, the metadata is kept in place
+func (r *Repository) AnonymizeTasks(ctx context.Context, ids []primitive.ObjectID) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	collection := r.db.Collection(taskCollection)
+	result, err := collection.UpdateMany(
+		ctx,
+		bson.M{"_id": bson.M{"$in": ids}, "status": bson.M{"$in": finalStatuses}},
+		bson.M{
+			"$set":   bson.M{"anonymized_at": time.Now()},
+			"$unset": bson.M{"source_content": "", "result_content": "", "error": ""},
+		},
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
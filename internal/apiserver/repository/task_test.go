@@ -0,0 +1,44 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmualex2023/i18n-translation/internal/apiserver/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestUpdateTaskIfStatus(t *testing.T) {
+	mt := newMockTest(t)
+
+	mt.Run("Updated", func(mt *mtest.T) {
+		repo := NewRepositoryWithDatabase(mt.DB)
+		task := &model.Task{ID: primitive.NewObjectID(), Status: model.TaskStatusQueued}
+		mt.AddMockResponses(writeResult(1))
+
+		err := repo.UpdateTaskIfStatus(context.Background(), task, model.TaskStatusPending, model.TaskStatusFailed)
+		require.NoError(mt, err)
+
+		// 只更新状态仍为 from 之一的任务
+		update := nextCommand(mt, "update")["updates"].(bson.A)[0].(bson.M)
+		assert.Equal(mt, bson.M{
+			"_id":    task.ID,
+			"status": bson.M{"$in": bson.A{"pending", "failed"}},
+		}, update["q"])
+		assert.Equal(mt, "queued", update["u"].(bson.M)["$set"].(bson.M)["status"])
+	})
+
+	mt.Run("StaleStatus", func(mt *mtest.T) {
+		repo := NewRepositoryWithDatabase(mt.DB)
+		task := &model.Task{ID: primitive.NewObjectID(), Status: model.TaskStatusQueued}
+		// 状态已被修改，没有匹配的任务
+		mt.AddMockResponses(writeResult(0))
+
+		err := repo.UpdateTaskIfStatus(context.Background(), task, model.TaskStatusPending)
+		assert.ErrorIs(mt, err, ErrStatusConflict)
+	})
+}
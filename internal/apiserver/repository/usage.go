@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/xmualex2023/i18n-translation/internal/apiserver/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const usageCollection = "usage"
+
+// IncUsage accumulate user usage into the day and month buckets of the given time, tasks is the
+// number of tasks completed, failed attempts only add their tokens and cost
+func (r *Repository) IncUsage(ctx context.Context, userID primitive.ObjectID, at time.Time, tasks, promptTokens, completionTokens int, cost float64) error {
+	now := time.Now()
+	inc := bson.M{
+		"tasks":             tasks,
+		"prompt_tokens":     promptTokens,
+		"completion_tokens": completionTokens,
+		"cost":              cost,
+	}
+
+	var writes []mongo.WriteModel
+	for _, period := range []model.UsagePeriod{model.UsagePeriodDay, model.UsagePeriodMonth} {
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{
+				"user_id": userID,
+				"period":  period,
+				"date":    at.Format(period.Layout()),
+			}).
+			SetUpdate(bson.M{
+				"$inc": inc,
+				"$set": bson.M{"updated_at": now},
+			}).
+			SetUpsert(true))
+	}
+
+	collection := r.db.Collection(usageCollection)
+	_, err := collection.BulkWrite(ctx, writes)
+	return err
+}
+
+// ListUsage list user usage of the period between from and to (inclusive)
+func (r *Repository) ListUsage(ctx context.Context, userID primitive.ObjectID, period model.UsagePeriod, from, to string) ([]*model.Usage, error) {
+	collection := r.db.Collection(usageCollection)
+
+	filter := bson.M{
+		"user_id": userID,
+		"period":  period,
+		"date":    bson.M{"$gte": from, "$lte": to},
+	}
+	cursor, err := collection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "date", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	usages := make([]*model.Usage, 0)
+	if err := cursor.All(ctx, &usages); err != nil {
+		return nil, err
+	}
+	return usages, nil
+}
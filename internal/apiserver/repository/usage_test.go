@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestIncUsage(t *testing.T) {
+	mt := newMockTest(t)
+
+	mt.Run("DayAndMonth", func(mt *mtest.T) {
+		repo := NewRepositoryWithDatabase(mt.DB)
+		userID := primitive.NewObjectID()
+		at := time.Date(2024, 2, 29, 23, 30, 0, 0, time.UTC)
+		mt.AddMockResponses(writeResult(2))
+
+		require.NoError(mt, repo.IncUsage(context.Background(), userID, at, 1, 120, 80, 0.0018))
+
+		cmd := nextCommand(mt, "update")
+		assert.Equal(mt, "usage", cmd["update"])
+		updates := cmd["updates"].(bson.A)
+		require.Len(mt, updates, 2)
+
+		// 按天和按月各累加一次，不存在时插入
+		for i, want := range []bson.M{
+			{"user_id": userID, "period": "day", "date": "2024-02-29"},
+			{"user_id": userID, "period": "month", "date": "2024-02"},
+		} {
+			update := updates[i].(bson.M)
+			assert.Equal(mt, want, update["q"])
+			assert.Equal(mt, true, update["upsert"])
+			u := update["u"].(bson.M)
+			assert.Equal(mt, bson.M{
+				"tasks":             int32(1),
+				"prompt_tokens":     int32(120),
+				"completion_tokens": int32(80),
+				"cost":              0.0018,
+			}, u["$inc"])
+			assert.Contains(mt, u["$set"], "updated_at")
+		}
+	})
+}
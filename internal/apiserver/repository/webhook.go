@@ -0,0 +1,182 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/xmualex2023/i18n-translation/internal/apiserver/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	webhookCollection  = "webhooks"
+	deliveryCollection = "webhook_deliveries"
+)
+
+// CreateWebhook create webhook
+func (r *Repository) CreateWebhook(ctx context.Context, webhook *model.Webhook) error {
+	webhook.CreatedAt = time.Now()
+
+	collection := r.db.Collection(webhookCollection)
+	result, err := collection.InsertOne(ctx, webhook)
+	if err != nil {
+		return err
+	}
+	webhook.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// ListWebhooks list webhooks of the user, the oldest first
+func (r *Repository) ListWebhooks(ctx context.Context, userID primitive.ObjectID) ([]*model.Webhook, error) {
+	collection := r.db.Collection(webhookCollection)
+	cursor, err := collection.Find(ctx, bson.M{"user_id": userID}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	webhooks := make([]*model.Webhook, 0)
+	if err := cursor.All(ctx, &webhooks); err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+// GetWebhook get webhook, nil if not found
+func (r *Repository) GetWebhook(ctx context.Context, webhookID primitive.ObjectID) (*model.Webhook, error) {
+	collection := r.db.Collection(webhookCollection)
+
+	var webhook model.Webhook
+	err := collection.FindOne(ctx, bson.M{"_id": webhookID}).Decode(&webhook)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+// DeleteWebhook delete webhook of the user, returns false if not found
+func (r *Repository) DeleteWebhook(ctx context.Context, userID, webhookID primitive.ObjectID) (bool, error) {
+	collection := r.db.Collection(webhookCollection)
+	result, err := collection.DeleteOne(ctx, bson.M{"_id": webhookID, "user_id": userID})
+	if err != nil {
+		return false, err
+	}
+	return result.DeletedCount > 0, nil
+}
+
+// DeleteTaskWebhooks delete webhooks of the tasks
+func (r *Repository) DeleteTaskWebhooks(ctx context.Context, taskIDs []primitive.ObjectID) error {
+	collection := r.db.Collection(webhookCollection)
+	_, err := collection.DeleteMany(ctx, bson.M{"task_id": bson.M{"$in": taskIDs}})
+	return err
+}
+
+// MatchWebhooks webhooks of the user subscribed to the event of the task
+func (r *Repository) MatchWebhooks(ctx context.Context, userID, taskID primitive.ObjectID, event model.WebhookEvent) ([]*model.Webhook, error) {
+	collection := r.db.Collection(webhookCollection)
+	filter := bson.M{
+		"user_id": userID,
+		"events":  event,
+		"$or": bson.A{
+			bson.M{"task_id": bson.M{"$exists": false}},
+			bson.M{"task_id": taskID},
+		},
+	}
+	cursor, err := collection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	webhooks := make([]*model.Webhook, 0)
+	if err := cursor.All(ctx, &webhooks); err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+// CreateDeliveries create pending deliveries
+func (r *Repository) CreateDeliveries(ctx context.Context, deliveries []*model.WebhookDelivery) error {
+	now := time.Now()
+	docs := make([]interface{}, 0, len(deliveries))
+	for _, d := range deliveries {
+		d.CreatedAt = now
+		d.UpdatedAt = now
+		docs = append(docs, d)
+	}
+
+	collection := r.db.Collection(deliveryCollection)
+	_, err := collection.InsertMany(ctx, docs)
+	return err
+}
+
+// ClaimDelivery claim a due pending delivery, it's hidden from other dispatchers for lease.
+// Returns nil if no delivery is due.
+func (r *Repository) ClaimDelivery(ctx context.Context, lease time.Duration) (*model.WebhookDelivery, error) {
+	now := time.Now()
+	collection := r.db.Collection(deliveryCollection)
+
+	var delivery model.WebhookDelivery
+	err := collection.FindOneAndUpdate(
+		ctx,
+		bson.M{"status": model.DeliveryStatusPending, "next_attempt_at": bson.M{"$lte": now}},
+		bson.M{"$set": bson.M{"next_attempt_at": now.Add(lease)}},
+		options.FindOneAndUpdate().
+			SetSort(bson.D{{Key: "next_attempt_at", Value: 1}}).
+			SetReturnDocument(options.After),
+	).Decode(&delivery)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+// AddDeliveryAttempt record attempt of the delivery and its new status
+func (r *Repository) AddDeliveryAttempt(ctx context.Context, deliveryID primitive.ObjectID, attempt model.DeliveryAttempt, status model.DeliveryStatus, nextAttemptAt time.Time) error {
+	collection := r.db.Collection(deliveryCollection)
+	_, err := collection.UpdateOne(
+		ctx,
+		bson.M{"_id": deliveryID},
+		bson.M{
+			"$push": bson.M{"attempts": attempt},
+			"$set": bson.M{
+				"status":          status,
+				"next_attempt_at": nextAttemptAt,
+				"updated_at":      time.Now(),
+			},
+		},
+	)
+	return err
+}
+
+// ListDeliveries list deliveries of the webhook, newest first
+func (r *Repository) ListDeliveries(ctx context.Context, userID, webhookID primitive.ObjectID, offset, limit int64) ([]*model.WebhookDelivery, int64, error) {
+	collection := r.db.Collection(deliveryCollection)
+	filter := bson.M{"user_id": userID, "webhook_id": webhookID}
+
+	total, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	cursor, err := collection.Find(ctx, filter, options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetSkip(offset).
+		SetLimit(limit))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	deliveries := make([]*model.WebhookDelivery, 0)
+	if err := cursor.All(ctx, &deliveries); err != nil {
+		return nil, 0, err
+	}
+	return deliveries, total, nil
+}
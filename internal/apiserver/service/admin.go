@@ -0,0 +1,146 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/xmualex2023/i18n-translation/internal/apiserver/model"
+	"github.com/xmualex2023/i18n-translation/internal/pkg/queue"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrConsumersUnsupported  = errors.New("queue does not report consumers")
+	ErrDeadLetterUnsupported = errors.New("queue does not support dead letters")
+	ErrDeadLetterNotFound    = errors.New("dead letter not found")
+)
+
+const defaultAdminListLimit = 20
+
+func (s *Service) deadLetterQueue() (queue.DeadLetterQueue, error) {
+	dlq, ok := s.queue.(queue.DeadLetterQueue)
+	if !ok {
+		return nil, ErrDeadLetterUnsupported
+	}
+	return dlq, nil
+}
+
+// ListDeadLetters list tasks which exhausted their retries, newest first
+func (s *Service) ListDeadLetters(ctx context.Context, req *model.DeadLetterListRequest) (*model.DeadLetterListResponse, error) {
+	dlq, err := s.deadLetterQueue()
+	if err != nil {
+		return nil, err
+	}
+
+	limit := req.Limit
+	if limit == 0 {
+		limit = defaultAdminListLimit
+	}
+	items, total, err := dlq.DeadLetters(ctx, req.Offset, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.DeadLetterListResponse{
+		Items: items,
+		Total: total,
+	}, nil
+}
+
+// RequeueDeadLetter move dead letter back to the queue and mark the task queued again
+func (s *Service) RequeueDeadLetter(ctx context.Context, taskID string) error {
+	dlq, err := s.deadLetterQueue()
+	if err != nil {
+		return err
+	}
+
+	id, err := primitive.ObjectIDFromHex(taskID)
+	if err != nil {
+		// not a translation task, nothing to update
+		return s.requeueDeadLetter(ctx, dlq, taskID)
+	}
+	dbTask, err := s.repo.GetTask(ctx, id)
+	if err != nil {
+		return fmt.Errorf("failed to get task, id: %s, error: %w", taskID, err)
+	}
+
+	// workers skip failed tasks, so the task is marked queued before it's moved back
+	cause := dbTask.Error
+	dbTask.Attempts = 0
+	dbTask.Error = ""
+	if err := s.transition(ctx, dbTask, model.TaskStatusQueued); err != nil {
+		return err
+	}
+	if err := s.requeueDeadLetter(ctx, dlq, taskID); err != nil {
+		// the task failed already, webhooks are not notified again
+		dbTask.Error = cause
+		if err := s.setStatus(ctx, dbTask, model.TaskStatusFailed); err != nil {
+			log.Printf("failed to restore dead letter task status, taskID: %s, error: %v", taskID, err)
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *Service) requeueDeadLetter(ctx context.Context, dlq queue.DeadLetterQueue, taskID string) error {
+	task, err := dlq.RequeueDeadLetter(ctx, taskID)
+	if err != nil {
+		return err
+	}
+	if task == nil {
+		return ErrDeadLetterNotFound
+	}
+	return nil
+}
+
+// PurgeDeadLetters remove all dead letters, tasks stay failed
+func (s *Service) PurgeDeadLetters(ctx context.Context) (*model.DeadLetterPurgeResponse, error) {
+	dlq, err := s.deadLetterQueue()
+	if err != nil {
+		return nil, err
+	}
+
+	purged, err := dlq.PurgeDeadLetters(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &model.DeadLetterPurgeResponse{Purged: purged}, nil
+}
+
+// ListScheduled list tasks waiting in the delay queue, the earliest first
+func (s *Service) ListScheduled(ctx context.Context, req *model.ScheduledListRequest) (*model.ScheduledListResponse, error) {
+	scheduler, ok := s.queue.(queue.Scheduler)
+	if !ok {
+		return nil, ErrScheduleUnsupported
+	}
+
+	limit := req.Limit
+	if limit == 0 {
+		limit = defaultAdminListLimit
+	}
+	items, total, err := scheduler.ScheduledTasks(ctx, req.Offset, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.ScheduledListResponse{
+		Items: items,
+		Total: total,
+	}, nil
+}
+
+// QueueConsumers pending task count of each queue consumer
+func (s *Service) QueueConsumers(ctx context.Context) (*model.QueueConsumersResponse, error) {
+	reporter, ok := s.queue.(queue.ConsumerReporter)
+	if !ok {
+		return nil, ErrConsumersUnsupported
+	}
+
+	consumers, err := reporter.Consumers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &model.QueueConsumersResponse{Consumers: consumers}, nil
+}
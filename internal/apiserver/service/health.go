@@ -0,0 +1,27 @@
+package service
+
+import (
+	"context"
+
+	"github.com/xmualex2023/i18n-translation/internal/apiserver/model"
+	"github.com/xmualex2023/i18n-translation/internal/pkg/breaker"
+)
+
+// Health get service health, degraded if any provider circuit breaker is not closed
+func (s *Service) Health(ctx context.Context) *model.HealthResponse {
+	resp := &model.HealthResponse{
+		Status:   model.HealthStatusOK,
+		Breakers: map[string]string{},
+	}
+	if s.breakers == nil {
+		return resp
+	}
+
+	resp.Breakers = s.breakers.States()
+	for _, state := range resp.Breakers {
+		if state != breaker.StateClosed.String() {
+			resp.Status = model.HealthStatusDegraded
+		}
+	}
+	return resp
+}
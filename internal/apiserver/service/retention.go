@@ -0,0 +1,106 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/xmualex2023/i18n-translation/internal/apiserver/model"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrTaskNotDeletable = errors.New("task is not finished, cancel it first")
+
+const (
+	RetentionModePurge     = "purge"     // 删除任务，元数据归档
+	RetentionModeAnonymize = "anonymize" // 只清除原文和译文
+)
+
+// DeleteTask delete finished task of the user, its metadata is archived without the contents
+func (s *Service) DeleteTask(ctx context.Context, taskID string, userID primitive.ObjectID) error {
+	task, err := s.getUserTask(ctx, taskID, userID)
+	if err != nil {
+		return err
+	}
+	if !task.Status.IsFinal() {
+		return ErrTaskNotDeletable
+	}
+
+	deleted, err := s.repo.ArchiveAndDeleteTasks(ctx, []*model.Task{task}, model.ArchiveReasonDeleted)
+	if err != nil {
+		return fmt.Errorf("failed to delete task, id: %s, error: %w", taskID, err)
+	}
+	if deleted == 0 {
+		// run again meanwhile
+		return ErrTaskNotDeletable
+	}
+	if err := s.repo.DeleteTaskWebhooks(ctx, []primitive.ObjectID{task.ID}); err != nil {
+		log.Printf("failed to delete webhooks of task, taskID: %s, error: %v", taskID, err)
+	}
+	return nil
+}
+
+// RunRetention apply the retention policy every retention.interval until ctx is done
+func (s *Service) RunRetention(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.Retention.Interval)
+	defer ticker.Stop()
+
+	for {
+		n, err := s.applyRetention(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("failed to apply retention policy, error: %v", err)
+		} else if n > 0 {
+			log.Printf("retention policy applied, mode: %s, tasks: %d", s.cfg.Retention.Mode, n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// applyRetention purge or anonymize finished tasks not updated for retention.days in batches
+func (s *Service) applyRetention(ctx context.Context) (int64, error) {
+	cfg := s.cfg.Retention
+	before := time.Now().AddDate(0, 0, -cfg.Days)
+	purge := cfg.Mode == RetentionModePurge
+
+	var total int64
+	for ctx.Err() == nil {
+		// anonymized tasks are purged too once the mode is switched
+		tasks, err := s.repo.ListExpiredTasks(ctx, before, purge, int64(cfg.BatchSize))
+		if err != nil {
+			return total, fmt.Errorf("failed to list expired tasks, error: %w", err)
+		}
+		if len(tasks) == 0 {
+			break
+		}
+
+		ids := make([]primitive.ObjectID, 0, len(tasks))
+		for _, task := range tasks {
+			ids = append(ids, task.ID)
+		}
+
+		var n int64
+		if purge {
+			n, err = s.repo.ArchiveAndDeleteTasks(ctx, tasks, model.ArchiveReasonRetention)
+			if err == nil {
+				err = s.repo.DeleteTaskWebhooks(ctx, ids)
+			}
+		} else {
+			n, err = s.repo.AnonymizeTasks(ctx, ids)
+		}
+		total += n
+		if err != nil {
+			return total, err
+		}
+		if len(tasks) < cfg.BatchSize {
+			break
+		}
+	}
+	return total, nil
+}
@@ -0,0 +1,171 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmualex2023/i18n-translation/internal/apiserver/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+var finalStatusFilter = bson.M{"$in": bson.A{"completed", "failed", "cancelled"}}
+
+func TestApplyRetention(t *testing.T) {
+	mt := newMockTest(t)
+
+	mt.Run("Purge", func(mt *mtest.T) {
+		s := newMockService(mt, nil)
+		s.cfg.Retention.Mode = RetentionModePurge
+		tasks := []interface{}{newTask(model.TaskStatusCompleted), newTask(model.TaskStatusFailed)}
+		mt.AddMockResponses(findResult(mt, "tasks", tasks...), writeResult(2), writeResult(2), writeResult(0))
+
+		n, err := s.applyRetention(context.Background())
+		require.NoError(mt, err)
+		assert.Equal(mt, int64(2), n)
+		// 先归档再删除
+		assert.Equal(mt, []string{"find tasks", "update task_archive", "delete tasks", "delete webhooks"}, commands(mt))
+
+		// 已匿名化的任务同样删除
+		filter := command(mt, 0)["filter"].(bson.M)
+		assert.Equal(mt, finalStatusFilter, filter["status"])
+		assert.NotContains(mt, filter, "anonymized_at")
+
+		archive := command(mt, 1)["updates"].(bson.A)
+		require.Len(mt, archive, 2)
+		doc := archive[0].(bson.M)["u"].(bson.M)
+		assert.Equal(mt, "retention", doc["reason"])
+		assert.Equal(mt, "completed", doc["status"])
+		assert.NotContains(mt, doc, "source_content")
+		assert.NotContains(mt, doc, "result_content")
+
+		// 只删除已结束的任务，期间重新执行的任务保留
+		deletes := command(mt, 2)["deletes"].(bson.A)[0].(bson.M)
+		q := deletes["q"].(bson.M)
+		assert.Equal(mt, finalStatusFilter, q["status"])
+		assert.Equal(mt, bson.M{"$in": bson.A{tasks[0].(*model.Task).ID, tasks[1].(*model.Task).ID}}, q["_id"])
+	})
+
+	mt.Run("Anonymize", func(mt *mtest.T) {
+		s := newMockService(mt, nil)
+		s.cfg.Retention.Mode = RetentionModeAnonymize
+		task := newTask(model.TaskStatusCompleted)
+		mt.AddMockResponses(findResult(mt, "tasks", task), writeResult(1))
+
+		n, err := s.applyRetention(context.Background())
+		require.NoError(mt, err)
+		assert.Equal(mt, int64(1), n)
+		assert.Equal(mt, []string{"find tasks", "update tasks"}, commands(mt))
+
+		filter := command(mt, 0)["filter"].(bson.M)
+		assert.Equal(mt, finalStatusFilter, filter["status"])
+		assert.Equal(mt, bson.M{"$exists": false}, filter["anonymized_at"])
+
+		// 只清除原文、译文和错误信息，其他元数据保留
+		update := command(mt, 1)["updates"].(bson.A)[0].(bson.M)
+		assert.Equal(mt, finalStatusFilter, update["q"].(bson.M)["status"])
+		u := update["u"].(bson.M)
+		assert.Equal(mt, bson.M{"source_content": "", "result_content": "", "error": ""}, u["$unset"])
+		set := u["$set"].(bson.M)
+		assert.Len(mt, set, 1)
+		assert.Contains(mt, set, "anonymized_at")
+	})
+
+	mt.Run("NothingExpired", func(mt *mtest.T) {
+		s := newMockService(mt, nil)
+		mt.AddMockResponses(findResult(mt, "tasks"))
+
+		n, err := s.applyRetention(context.Background())
+		require.NoError(mt, err)
+		assert.Equal(mt, int64(0), n)
+		assert.Equal(mt, []string{"find tasks"}, commands(mt))
+	})
+}
+
+func TestDeleteTask(t *testing.T) {
+	mt := newMockTest(t)
+	ctx := context.Background()
+
+	mt.Run("Deleted", func(mt *mtest.T) {
+		s := newMockService(mt, nil)
+		task := newTask(model.TaskStatusCancelled)
+		mt.AddMockResponses(findResult(mt, "tasks", task), writeResult(1), writeResult(1), writeResult(0))
+
+		require.NoError(mt, s.DeleteTask(ctx, task.ID.Hex(), task.UserID))
+		assert.Equal(mt, []string{"find tasks", "update task_archive", "delete tasks", "delete webhooks"}, commands(mt))
+		doc := command(mt, 1)["updates"].(bson.A)[0].(bson.M)["u"].(bson.M)
+		assert.Equal(mt, "deleted", doc["reason"])
+	})
+
+	tests := []struct {
+		name      string
+		task      *model.Task
+		userID    primitive.ObjectID
+		responses func(mt *mtest.T, task *model.Task) []bson.D
+		err       error
+		commands  []string
+	}{
+		{
+			name: "NotOwned",
+			task: newTask(model.TaskStatusCompleted),
+			// 其他用户的任务视为不存在
+			userID: primitive.NewObjectID(),
+			err:    ErrTaskNotFound,
+		},
+		{
+			name: "NotFound",
+			task: newTask(model.TaskStatusCompleted),
+			responses: func(mt *mtest.T, task *model.Task) []bson.D {
+				return []bson.D{findResult(mt, "tasks")}
+			},
+			err: ErrTaskNotFound,
+		},
+		{
+			name: "Running",
+			task: newTask(model.TaskStatusProcessing),
+			err:  ErrTaskNotDeletable,
+		},
+		{
+			name: "RunAgainMeanwhile",
+			task: newTask(model.TaskStatusFailed),
+			// 读取后任务被重新执行，不会被删除
+			responses: func(mt *mtest.T, task *model.Task) []bson.D {
+				return []bson.D{findResult(mt, "tasks", task), writeResult(1), writeResult(0)}
+			},
+			err:      ErrTaskNotDeletable,
+			commands: []string{"find tasks", "update task_archive", "delete tasks"},
+		},
+	}
+
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			s := newMockService(mt, nil)
+			userID := tt.task.UserID
+			if !tt.userID.IsZero() {
+				userID = tt.userID
+			}
+			responses := []bson.D{findResult(mt, "tasks", tt.task)}
+			if tt.responses != nil {
+				responses = tt.responses(mt, tt.task)
+			}
+			mt.AddMockResponses(responses...)
+
+			err := s.DeleteTask(ctx, tt.task.ID.Hex(), userID)
+			assert.ErrorIs(mt, err, tt.err)
+			want := tt.commands
+			if want == nil {
+				want = []string{"find tasks"}
+			}
+			assert.Equal(mt, want, commands(mt))
+		})
+	}
+
+	mt.Run("InvalidID", func(mt *mtest.T) {
+		s := newMockService(mt, nil)
+		assert.ErrorIs(mt, s.DeleteTask(ctx, "invalid", primitive.NewObjectID()), ErrInvalidTask)
+		assert.Empty(mt, commands(mt))
+	})
+}
@@ -0,0 +1,282 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xmualex2023/i18n-translation/internal/apiserver/model"
+	"github.com/xmualex2023/i18n-translation/internal/pkg/llm"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// translate translate task content, JSON documents are translated segment by segment in batches
+// and their progress is reported to onProgress. If a document fails, the result is returned with
+// the error, without content, so the usage billed so far can be recorded.
+func (s *Service) translate(ctx context.Context, task *model.TranslationTask, onProgress llm.ProgressFunc) (*llm.Result, error) {
+	doc, ok := parseDocument(task.SourceContent)
+	if !ok || len(doc.segments) == 0 {
+		return s.translator.Translate(ctx, task.SourceContent, task.SourceLang, task.TargetLang)
+	}
+
+	batch, err := s.translator.TranslateSegments(ctx, doc.segments, task.SourceLang, task.TargetLang, onProgress)
+	if err != nil {
+		if batch == nil {
+			return nil, err
+		}
+		return &llm.Result{Model: batch.Model, Usage: batch.Usage}, err
+	}
+	if len(batch.Failed) > 0 {
+		for _, seg := range doc.segments {
+			if msg, failed := batch.Failed[seg.ID]; failed {
+				err := fmt.Errorf("failed to translate %d of %d segments, first error: %s", len(batch.Failed), len(doc.segments), msg)
+				return &llm.Result{Model: batch.Model, Usage: batch.Usage}, err
+			}
+		}
+	}
+
+	content, err := doc.render(batch.Translations)
+	if err != nil {
+		return nil, err
+	}
+
+	return &llm.Result{
+		Content: content,
+		Model:   batch.Model,
+		Usage:   batch.Usage,
+		Cached:  batch.Cached == len(doc.segments),
+	}, nil
+}
+
+// progressReporter save segment progress of a running task, at most once per interval
+// except the last report, so large documents don't flood the database
+type progressReporter struct {
+	s        *Service
+	ctx      context.Context
+	taskID   primitive.ObjectID
+	interval time.Duration
+	started  time.Time
+	saved    time.Time
+	progress *model.TaskProgress // latest progress, nil until reported
+}
+
+func (s *Service) newProgressReporter(ctx context.Context, taskID primitive.ObjectID) *progressReporter {
+	return &progressReporter{
+		s:        s,
+		ctx:      ctx,
+		taskID:   taskID,
+		interval: s.cfg.Worker.ProgressInterval,
+	}
+}
+
+// report llm.ProgressFunc, the ETA is estimated by the rate of segments not served by the cache
+func (r *progressReporter) report(p llm.Progress) {
+	now := time.Now()
+	if r.started.IsZero() {
+		// the first report comes right after the cache lookup
+		r.started = now
+	}
+
+	progress := &model.TaskProgress{
+		Total:      p.Total,
+		Translated: p.Translated,
+		Cached:     p.Cached,
+		Failed:     p.Failed,
+	}
+	remaining := p.Total - p.Translated - p.Failed
+	if done := p.Translated - p.Cached + p.Failed; done > 0 && remaining > 0 {
+		eta := now.Add(now.Sub(r.started) / time.Duration(done) * time.Duration(remaining))
+		progress.ETA = &eta
+	}
+	r.progress = progress
+
+	if remaining > 0 && now.Sub(r.saved) < r.interval {
+		return
+	}
+	r.saved = now
+	if err := r.s.repo.UpdateTaskProgress(r.ctx, r.taskID, progress); err != nil {
+		log.Printf("failed to update task progress, taskID: %s, error: %v", r.taskID.Hex(), err)
+	}
+}
+
+// document structured source content, every string leaf is a translation segment. Key order,
+// numbers and text are kept as they are, only the segments are replaced.
+type document struct {
+	root     interface{}
+	segments []llm.Segment
+	setters  map[string]func(string)
+}
+
+// jsonObject JSON object with its keys in the order of the source
+type jsonObject []jsonField
+
+type jsonField struct {
+	key   string
+	value interface{}
+}
+
+// parseDocument parse content as JSON object or array, returns false for plain text
+func parseDocument(content string) (*document, bool) {
+	dec := json.NewDecoder(strings.NewReader(content))
+	dec.UseNumber()
+	root, err := decodeValue(dec)
+	if err != nil {
+		return nil, false
+	}
+	// the content is one value only
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, false
+	}
+
+	doc := &document{
+		root:    root,
+		setters: make(map[string]func(string)),
+	}
+	switch v := root.(type) {
+	case jsonObject, []interface{}:
+		doc.walk(v)
+	default:
+		return nil, false
+	}
+	return doc, true
+}
+
+// decodeValue decode the next value, objects are decoded as jsonObject and numbers as json.Number
+func decodeValue(dec *json.Decoder) (interface{}, error) {
+	token, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch token {
+	case json.Delim('{'):
+		obj := jsonObject{}
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			obj = append(obj, jsonField{key: key.(string), value: value})
+		}
+		_, err = dec.Token()
+		return obj, err
+	case json.Delim('['):
+		arr := []interface{}{}
+		for dec.More() {
+			value, err := decodeValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, value)
+		}
+		_, err = dec.Token()
+		return arr, err
+	default:
+		return token, nil
+	}
+}
+
+// walk collect string leaves in document order
+func (d *document) walk(node interface{}) {
+	switch v := node.(type) {
+	case jsonObject:
+		for i := range v {
+			i := i
+			if text, ok := v[i].value.(string); ok {
+				d.add(text, func(s string) { v[i].value = s })
+				continue
+			}
+			d.walk(v[i].value)
+		}
+	case []interface{}:
+		for i := range v {
+			i := i
+			if text, ok := v[i].(string); ok {
+				d.add(text, func(s string) { v[i] = s })
+				continue
+			}
+			d.walk(v[i])
+		}
+	}
+}
+
+func (d *document) add(text string, set func(string)) {
+	if text == "" {
+		return
+	}
+	id := strconv.Itoa(len(d.segments))
+	d.segments = append(d.segments, llm.Segment{ID: id, Text: text})
+	d.setters[id] = set
+}
+
+// render replace segments with translations and encode the document
+func (d *document) render(translations map[string]string) (string, error) {
+	for id, set := range d.setters {
+		text, ok := translations[id]
+		if !ok {
+			return "", fmt.Errorf("translation of segment %s not found", id)
+		}
+		set(text)
+	}
+
+	var buf bytes.Buffer
+	if err := encodeValue(&buf, d.root); err != nil {
+		return "", err
+	}
+	var out bytes.Buffer
+	if err := json.Indent(&out, buf.Bytes(), "", "  "); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// encodeValue encode value decoded by decodeValue, text is not HTML escaped
+func encodeValue(buf *bytes.Buffer, node interface{}) error {
+	switch v := node.(type) {
+	case jsonObject:
+		buf.WriteByte('{')
+		for i, field := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := encodeValue(buf, field.key); err != nil {
+				return err
+			}
+			buf.WriteByte(':')
+			if err := encodeValue(buf, field.value); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	case []interface{}:
+		buf.WriteByte('[')
+		for i, item := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := encodeValue(buf, item); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	default:
+		enc := json.NewEncoder(buf)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(v); err != nil {
+			return err
+		}
+		// Encode ends the value with a newline
+		buf.Truncate(buf.Len() - 1)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestDocumentRoundTrip 测试翻译后的文档保持键顺序、大整数和特殊字符
+func TestDocumentRoundTrip(t *testing.T) {
+	content := `{
+  "zeta": "Save & exit",
+  "alpha": {
+    "id": 12345678901234567890,
+    "price": 1.50,
+    "tags": [
+      "<b>bold</b>",
+      "",
+      true,
+      null
+    ],
+    "empty": {}
+  },
+  "items": []
+}`
+
+	doc, ok := parseDocument(content)
+	require.True(t, ok)
+	require.Len(t, doc.segments, 2)
+	// 片段按文档顺序编号
+	assert.Equal(t, "Save & exit", doc.segments[0].Text)
+	assert.Equal(t, "<b>bold</b>", doc.segments[1].Text)
+
+	// 原文原样输出
+	out, err := doc.render(map[string]string{"0": "Save & exit", "1": "<b>bold</b>"})
+	require.NoError(t, err)
+	assert.Equal(t, content, out)
+
+	doc, ok = parseDocument(content)
+	require.True(t, ok)
+	out, err = doc.render(map[string]string{"0": "保存 & 退出", "1": "<b>粗体</b>"})
+	require.NoError(t, err)
+	assert.Equal(t, `{
+  "zeta": "保存 & 退出",
+  "alpha": {
+    "id": 12345678901234567890,
+    "price": 1.50,
+    "tags": [
+      "<b>粗体</b>",
+      "",
+      true,
+      null
+    ],
+    "empty": {}
+  },
+  "items": []
+}`, out)
+
+	_, err = doc.render(map[string]string{"0": "x"})
+	assert.Error(t, err)
+}
+
+func TestParseDocumentPlainText(t *testing.T) {
+	for _, content := range []string{"Hello", `"Hello"`, "42", `{"a": "b"} trailing`, `{"a": }`, `[1, 2`} {
+		_, ok := parseDocument(content)
+		assert.False(t, ok, content)
+	}
+}
@@ -6,11 +6,20 @@ import (
 	"github.com/xmualex2023/i18n-translation/internal/apiserver/config"
 	"github.com/xmualex2023/i18n-translation/internal/apiserver/repository"
 	"github.com/xmualex2023/i18n-translation/internal/pkg/auth"
+	"github.com/xmualex2023/i18n-translation/internal/pkg/breaker"
+	"github.com/xmualex2023/i18n-translation/internal/pkg/llm"
 	"github.com/xmualex2023/i18n-translation/internal/pkg/queue"
+	"github.com/xmualex2023/i18n-translation/internal/pkg/webhook"
 )
 
 type translator interface {
-	Translate(ctx context.Context, text, sourceLang, targetLang string) (string, error)
+	Translate(ctx context.Context, text, sourceLang, targetLang string) (*llm.Result, error)
+	TranslateSegments(ctx context.Context, segments []llm.Segment, sourceLang, targetLang string, onProgress llm.ProgressFunc) (*llm.BatchResult, error)
+}
+
+// canceller notifies workers to abort running tasks
+type canceller interface {
+	Publish(ctx context.Context, taskID string) error
 }
 
 type Service struct {
@@ -19,14 +28,21 @@ type Service struct {
 	translator translator
 	queue      queue.Queue
 	cache      auth.TokenCache
+	breakers   *breaker.Registry
+	cancels    canceller
+	workers    workerPool
+	webhooks   *webhook.Sender
 }
 
-func NewService(cfg *config.Config, repo *repository.Repository, tr translator, q queue.Queue, cache auth.TokenCache) *Service {
+func NewService(cfg *config.Config, repo *repository.Repository, tr translator, q queue.Queue, cache auth.TokenCache, breakers *breaker.Registry, cancels canceller) *Service {
 	return &Service{
 		cfg:        cfg,
 		repo:       repo,
 		translator: tr,
 		queue:      q,
 		cache:      cache,
+		breakers:   breakers,
+		cancels:    cancels,
+		webhooks:   webhook.NewSender(cfg.Webhook.Timeout),
 	}
 }
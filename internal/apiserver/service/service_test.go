@@ -0,0 +1,75 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/xmualex2023/i18n-translation/internal/apiserver/config"
+	"github.com/xmualex2023/i18n-translation/internal/apiserver/model"
+	"github.com/xmualex2023/i18n-translation/internal/apiserver/repository"
+	"github.com/xmualex2023/i18n-translation/internal/pkg/queue"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// newMockTest 使用 mock 部署的测试，不连接 MongoDB，按顺序返回预设的响应
+func newMockTest(t *testing.T) *mtest.T {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	t.Cleanup(mt.Close)
+	return mt
+}
+
+func newMockService(mt *mtest.T, q queue.Queue) *Service {
+	return &Service{
+		cfg:   config.DefaultConfig(),
+		repo:  repository.NewRepositoryWithDatabase(mt.DB),
+		queue: q,
+	}
+}
+
+// findResult find 命令的响应
+func findResult(mt *mtest.T, collection string, docs ...interface{}) bson.D {
+	batch := make([]bson.D, 0, len(docs))
+	for _, doc := range docs {
+		data, err := bson.Marshal(doc)
+		require.NoError(mt, err)
+		var d bson.D
+		require.NoError(mt, bson.Unmarshal(data, &d))
+		batch = append(batch, d)
+	}
+	return mtest.CreateCursorResponse(0, "test."+collection, mtest.FirstBatch, batch...)
+}
+
+// writeResult update 和 delete 命令的响应
+func writeResult(n int) bson.D {
+	return mtest.CreateSuccessResponse(bson.E{Key: "n", Value: n}, bson.E{Key: "nModified", Value: n})
+}
+
+// commands 发送的命令，如 find tasks、update tasks
+func commands(mt *mtest.T) []string {
+	var names []string
+	for _, e := range mt.GetAllStartedEvents() {
+		names = append(names, e.CommandName+" "+e.Command.Lookup(e.CommandName).StringValue())
+	}
+	return names
+}
+
+// command 第 i 条命令
+func command(mt *mtest.T, i int) bson.M {
+	events := mt.GetAllStartedEvents()
+	require.Greater(mt, len(events), i)
+	var cmd bson.M
+	require.NoError(mt, bson.Unmarshal(events[i].Command, &cmd))
+	return cmd
+}
+
+func newTask(status model.TaskStatus) *model.Task {
+	return &model.Task{
+		ID:         primitive.NewObjectID(),
+		UserID:     primitive.NewObjectID(),
+		Status:     status,
+		SourceLang: "en",
+		TargetLang: "zh",
+	}
+}
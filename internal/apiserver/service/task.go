@@ -2,28 +2,68 @@ package service
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"log"
+	"strings"
 	"time"
 
 	"github.com/xmualex2023/i18n-translation/internal/apiserver/model"
+	"github.com/xmualex2023/i18n-translation/internal/apiserver/repository"
+	"github.com/xmualex2023/i18n-translation/internal/pkg/llm"
 	"github.com/xmualex2023/i18n-translation/internal/pkg/queue"
+	"github.com/xmualex2023/i18n-translation/internal/pkg/worker"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 var (
-	ErrTaskNotFound = errors.New("task not found")
-	ErrInvalidTask  = errors.New("invalid task")
+	ErrTaskNotFound        = errors.New("task not found")
+	ErrInvalidTask         = errors.New("invalid task")
+	ErrInvalidSchedule     = errors.New("invalid schedule")
+	ErrScheduleUnsupported = errors.New("queue does not support scheduled tasks")
+	ErrTaskNotScheduled    = errors.New("task not scheduled")
+	ErrTaskNotCancellable  = errors.New("task is finished already")
+	ErrInvalidTransition   = errors.New("invalid task status transition")
+	ErrInvalidTaskQuery    = errors.New("invalid task query")
+)
+
+const (
+	// maxScheduleDelay tasks can be scheduled at most this far ahead
+	maxScheduleDelay = 30 * 24 * time.Hour
+	// maxTaskTimeout max time limit of tasks
+	maxTaskTimeout = time.Hour
+	// defaultTaskListLimit page size of task listing
+	defaultTaskListLimit = 20
 )
 
 // CreateTask create translation task
 func (s *Service) CreateTask(ctx context.Context, req *model.CreateTaskRequest, userID primitive.ObjectID) (*model.TaskResponse, error) {
+	priority, err := queue.ParsePriority(req.Priority)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTask, err)
+	}
+	timeout, err := s.parseTimeout(req.Timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	format := model.TaskFormatText
+	if doc, ok := parseDocument(req.SourceContent); ok && len(doc.segments) > 0 {
+		format = model.TaskFormatJSON
+	}
+
 	task := &model.Task{
 		UserID:        userID,
 		Status:        model.TaskStatusPending,
+		Priority:      priority,
 		SourceLang:    req.SourceLang,
 		TargetLang:    req.TargetLang,
 		SourceContent: req.SourceContent,
+		Format:        format,
+		MaxRetries:    req.MaxRetries,
+		Timeout:       timeout,
 	}
 
 	if err := s.repo.CreateTask(ctx, task); err != nil {
@@ -31,72 +71,367 @@ func (s *Service) CreateTask(ctx context.Context, req *model.CreateTaskRequest,
 	}
 
 	return &model.TaskResponse{
-		ID:        task.ID.Hex(),
-		Status:    task.Status,
-		CreatedAt: task.CreatedAt,
-		UpdatedAt: task.UpdatedAt,
+		ID:         task.ID.Hex(),
+		Status:     task.Status,
+		Priority:   string(task.Priority),
+		SourceLang: task.SourceLang,
+		TargetLang: task.TargetLang,
+		Format:     task.Format,
+		CreatedAt:  task.CreatedAt,
+		UpdatedAt:  task.UpdatedAt,
 	}, nil
 }
 
-// ExecuteTranslation execute translation task
-func (s *Service) ExecuteTranslation(ctx context.Context, taskID string) error {
-	id, err := primitive.ObjectIDFromHex(taskID)
+// parseTimeout time limit of the task, 0 means the default. It must be less than the
+// visibility timeout of the queue, so the task isn't delivered again while still running.
+func (s *Service) parseTimeout(timeout string) (time.Duration, error) {
+	if timeout == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(timeout)
 	if err != nil {
-		return fmt.Errorf("invalid task id: %s, error: %w", taskID, err)
+		return 0, fmt.Errorf("%w: invalid timeout: %v", ErrInvalidTask, err)
+	}
+	if d <= 0 || d > maxTaskTimeout {
+		return 0, fmt.Errorf("%w: timeout must be between 0 and %v", ErrInvalidTask, maxTaskTimeout)
+	}
+	if d >= s.cfg.Queue.VisibilityTimeout {
+		return 0, fmt.Errorf("%w: timeout must be less than the queue visibility timeout %v", ErrInvalidTask, s.cfg.Queue.VisibilityTimeout)
 	}
+	return d, nil
+}
 
-	task, err := s.repo.GetTask(ctx, id)
+// ExecuteTranslation execute translation task of the user, or schedule it if run_at or delay is set
+func (s *Service) ExecuteTranslation(ctx context.Context, taskID string, userID primitive.ObjectID, req *model.ExecuteTaskRequest) error {
+	runAt, err := parseRunAt(req)
 	if err != nil {
-		return fmt.Errorf("failed to get task, id: %s, error: %w", taskID, err)
+		return err
 	}
 
-	// update task status to processing
-	task.Status = model.TaskStatusProcessing
-	if err := s.repo.UpdateTask(ctx, task); err != nil {
-		return fmt.Errorf("failed to update task status, id: %s, error: %w", taskID, err)
+	task, err := s.getUserTask(ctx, taskID, userID)
+	if err != nil {
+		return err
 	}
 
-	// create translation task and enqueue
+	// create translation task
 	translationTask := &model.TranslationTask{
 		ID:            task.ID.Hex(),
 		UserID:        task.UserID.Hex(),
 		SourceLang:    task.SourceLang,
 		TargetLang:    task.TargetLang,
 		SourceContent: task.SourceContent,
+		Priority:      task.Priority,
+		MaxRetries:    task.MaxRetries,
+		Timeout:       task.Timeout,
 		CreatedAt:     time.Now(),
 	}
 
+	if runAt != nil {
+		return s.scheduleTranslation(ctx, task, translationTask, *runAt)
+	}
+
+	// the task is marked queued before enqueued, so it can't be enqueued twice
+	task.RunAt = nil
+	task.Attempts = 0
+	task.Error = ""
+	if err := s.transition(ctx, task, model.TaskStatusQueued); err != nil {
+		return err
+	}
+
 	if err := s.queue.Enqueue(ctx, translationTask); err != nil {
-		task.Status = model.TaskStatusFailed
-		task.Error = fmt.Sprintf("failed to enqueue, error: %v", err)
-		if err := s.repo.UpdateTask(ctx, task); err != nil {
-			return fmt.Errorf("failed to update task status, id: %s, error: %w", taskID, err)
-		}
-		return fmt.Errorf("failed to enqueue, id: %s, error: %w", taskID, err)
+		return s.failEnqueue(ctx, task, err)
 	}
 
 	return nil
 }
 
-// GetTaskStatus get task status
-func (s *Service) GetTaskStatus(ctx context.Context, taskID string) (*model.TaskResponse, error) {
+// scheduleTranslation add translation task to the delay queue
+func (s *Service) scheduleTranslation(ctx context.Context, task *model.Task, translationTask *model.TranslationTask, runAt time.Time) error {
+	scheduler, ok := s.queue.(queue.Scheduler)
+	if !ok {
+		return ErrScheduleUnsupported
+	}
+
+	task.RunAt = &runAt
+	task.Attempts = 0
+	task.Error = ""
+	if err := s.transition(ctx, task, model.TaskStatusScheduled); err != nil {
+		return err
+	}
+
+	if err := scheduler.Schedule(ctx, translationTask, runAt); err != nil {
+		return s.failEnqueue(ctx, task, err)
+	}
+	return nil
+}
+
+// failEnqueue mark task failed as it couldn't be enqueued
+func (s *Service) failEnqueue(ctx context.Context, task *model.Task, err error) error {
+	task.Error = fmt.Sprintf("failed to enqueue, error: %v", err)
+	if err := s.transition(ctx, task, model.TaskStatusFailed); err != nil {
+		return err
+	}
+	return fmt.Errorf("failed to enqueue, id: %s, error: %w", task.ID.Hex(), err)
+}
+
+// transition move task to status to, the update only applies if the stored status is still the
+// one the task was read with, otherwise ErrInvalidTransition is returned. Webhooks are notified
+// once the task is finished.
+func (s *Service) transition(ctx context.Context, task *model.Task, to model.TaskStatus) error {
+	if err := s.setStatus(ctx, task, to); err != nil {
+		return err
+	}
+	if to.IsFinal() {
+		s.notifyWebhooks(ctx, task)
+	}
+	return nil
+}
+
+// setStatus transition without notifying webhooks, for rolling back a transition
+func (s *Service) setStatus(ctx context.Context, task *model.Task, to model.TaskStatus) error {
+	from := task.Status
+	if !from.CanTransition(to) {
+		return fmt.Errorf("%w: %s -> %s, id: %s", ErrInvalidTransition, from, to, task.ID.Hex())
+	}
+
+	task.Status = to
+	if err := s.repo.UpdateTaskIfStatus(ctx, task, from); err != nil {
+		task.Status = from
+		if errors.Is(err, repository.ErrStatusConflict) {
+			return fmt.Errorf("%w: %s -> %s, id: %s, status changed meanwhile", ErrInvalidTransition, from, to, task.ID.Hex())
+		}
+		return fmt.Errorf("failed to update task status, id: %s, error: %w", task.ID.Hex(), err)
+	}
+	return nil
+}
+
+// parseRunAt time to run the task, nil means now
+func parseRunAt(req *model.ExecuteTaskRequest) (*time.Time, error) {
+	if req == nil || (req.RunAt == nil && req.Delay == "") {
+		return nil, nil
+	}
+	if req.RunAt != nil && req.Delay != "" {
+		return nil, fmt.Errorf("%w: run_at and delay are exclusive", ErrInvalidSchedule)
+	}
+
+	runAt := time.Now()
+	if req.RunAt != nil {
+		runAt = *req.RunAt
+	} else {
+		delay, err := time.ParseDuration(req.Delay)
+		if err != nil || delay < 0 {
+			return nil, fmt.Errorf("%w: invalid delay %q", ErrInvalidSchedule, req.Delay)
+		}
+		runAt = runAt.Add(delay)
+	}
+
+	if time.Until(runAt) > maxScheduleDelay {
+		return nil, fmt.Errorf("%w: can't schedule later than %v", ErrInvalidSchedule, maxScheduleDelay)
+	}
+	if !runAt.After(time.Now()) {
+		// due already, run now
+		return nil, nil
+	}
+	return &runAt, nil
+}
+
+// CancelSchedule remove scheduled task of the user from the delay queue, the task goes back to pending
+func (s *Service) CancelSchedule(ctx context.Context, taskID string, userID primitive.ObjectID) error {
+	scheduler, ok := s.queue.(queue.Scheduler)
+	if !ok {
+		return ErrScheduleUnsupported
+	}
+
+	task, err := s.getUserTask(ctx, taskID, userID)
+	if err != nil {
+		return err
+	}
+	if task.Status != model.TaskStatusScheduled {
+		return ErrTaskNotScheduled
+	}
+
+	cancelled, err := scheduler.CancelScheduled(ctx, taskID)
+	if err != nil {
+		return err
+	}
+	if !cancelled {
+		// promoted to the queue already
+		return ErrTaskNotScheduled
+	}
+
+	task.RunAt = nil
+	return s.transition(ctx, task, model.TaskStatusPending)
+}
+
+// CancelTask cancel task of the user, it's removed from the queue if waiting, or aborted if running
+func (s *Service) CancelTask(ctx context.Context, taskID string, userID primitive.ObjectID) error {
+	task, err := s.getUserTask(ctx, taskID, userID)
+	if err != nil {
+		return err
+	}
+
+	if task.Status.IsFinal() {
+		return ErrTaskNotCancellable
+	}
+
+	// workers skip cancelled tasks, so the status is updated first
+	task.RunAt = nil
+	if err := s.transition(ctx, task, model.TaskStatusCancelled); err != nil {
+		return err
+	}
+	if remover, ok := s.queue.(queue.Remover); ok {
+		removed, err := remover.Remove(ctx, taskID)
+		if err != nil {
+			log.Printf("failed to remove cancelled task from queue, taskID: %s, error: %v", taskID, err)
+		}
+		if removed {
+			return nil
+		}
+	}
+
+	// the task is running, or will be skipped once dequeued
+	return s.cancels.Publish(ctx, taskID)
+}
+
+// getUserTask get task of the user, tasks of other users are reported missing
+func (s *Service) getUserTask(ctx context.Context, taskID string, userID primitive.ObjectID) (*model.Task, error) {
 	id, err := primitive.ObjectIDFromHex(taskID)
 	if err != nil {
 		return nil, ErrInvalidTask
 	}
 
 	task, err := s.repo.GetTask(ctx, id)
+	if errors.Is(err, repository.ErrTaskNotFound) {
+		return nil, ErrTaskNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get task, id: %s, error: %w", taskID, err)
+	}
+	if task.UserID != userID {
+		return nil, ErrTaskNotFound
+	}
+	return task, nil
+}
+
+// GetTaskStatus get status of the user's task
+func (s *Service) GetTaskStatus(ctx context.Context, taskID string, userID primitive.ObjectID) (*model.TaskResponse, error) {
+	task, err := s.getUserTask(ctx, taskID, userID)
 	if err != nil {
 		return nil, err
 	}
 
+	return newTaskResponse(task), nil
+}
+
+func newTaskResponse(task *model.Task) *model.TaskResponse {
+	// progress belongs to the last run, it's hidden while the task waits for the next one
+	progress := task.Progress
+	switch task.Status {
+	case model.TaskStatusProcessing, model.TaskStatusCompleted, model.TaskStatusFailed:
+	default:
+		progress = nil
+	}
+
 	return &model.TaskResponse{
-		ID:        task.ID.Hex(),
-		Status:    task.Status,
-		CreatedAt: task.CreatedAt,
-		UpdatedAt: task.UpdatedAt,
-		Error:     task.Error,
-	}, nil
+		ID:               task.ID.Hex(),
+		Status:           task.Status,
+		Priority:         string(task.Priority),
+		SourceLang:       task.SourceLang,
+		TargetLang:       task.TargetLang,
+		Format:           task.Format,
+		CreatedAt:        task.CreatedAt,
+		UpdatedAt:        task.UpdatedAt,
+		Error:            task.Error,
+		Attempts:         task.Attempts,
+		RunAt:            task.RunAt,
+		Progress:         progress,
+		Model:            task.Model,
+		PromptTokens:     task.PromptTokens,
+		CompletionTokens: task.CompletionTokens,
+		Cost:             task.Cost,
+	}
+}
+
+// ListTasks list tasks of the user, newest first by default, pages are chained by next_cursor
+func (s *Service) ListTasks(ctx context.Context, req *model.ListTasksRequest, userID primitive.ObjectID) (*model.TaskListResponse, error) {
+	sort := req.Sort
+	if sort == "" {
+		sort = "-created_at"
+	}
+	query := &model.TaskQuery{
+		UserID:      userID,
+		SourceLang:  req.SourceLang,
+		TargetLang:  req.TargetLang,
+		Format:      model.TaskFormat(req.Format),
+		CreatedFrom: req.CreatedFrom,
+		CreatedTo:   req.CreatedTo,
+		SortField:   strings.TrimPrefix(sort, "-"),
+		Desc:        strings.HasPrefix(sort, "-"),
+		Limit:       req.Limit,
+	}
+	for _, status := range req.Status {
+		query.Statuses = append(query.Statuses, model.TaskStatus(status))
+	}
+	if query.Limit == 0 {
+		query.Limit = defaultTaskListLimit
+	}
+	if !query.CreatedFrom.IsZero() && !query.CreatedTo.IsZero() && !query.CreatedFrom.Before(query.CreatedTo) {
+		return nil, fmt.Errorf("%w: created_from must be before created_to", ErrInvalidTaskQuery)
+	}
+	if req.Cursor != "" {
+		c, err := decodeTaskCursor(req.Cursor)
+		if err != nil || c.Sort != sort {
+			return nil, fmt.Errorf("%w: invalid cursor", ErrInvalidTaskQuery)
+		}
+		query.AfterValue, query.AfterID = c.Value, c.ID
+	}
+
+	// one more task tells whether there is a next page
+	limit := query.Limit
+	query.Limit++
+	tasks, err := s.repo.ListTasks(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tasks, userID: %s, error: %w", userID.Hex(), err)
+	}
+
+	resp := &model.TaskListResponse{Items: make([]*model.TaskResponse, 0, len(tasks))}
+	if int64(len(tasks)) > limit {
+		tasks = tasks[:limit]
+		last := tasks[len(tasks)-1]
+		value := last.CreatedAt
+		if query.SortField == "updated_at" {
+			value = last.UpdatedAt
+		}
+		resp.NextCursor = encodeTaskCursor(&taskCursor{Sort: sort, Value: value, ID: last.ID})
+	}
+	for _, task := range tasks {
+		resp.Items = append(resp.Items, newTaskResponse(task))
+	}
+	return resp, nil
+}
+
+// taskCursor position after the last task of a page, bound to the sort order
+type taskCursor struct {
+	Sort  string             `json:"s"`
+	Value time.Time          `json:"v"`
+	ID    primitive.ObjectID `json:"id"`
+}
+
+func encodeTaskCursor(c *taskCursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeTaskCursor(s string) (*taskCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	var c taskCursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
 }
 
 // HandleTranslationTask handle translation task
@@ -117,33 +452,171 @@ func (s *Service) HandleTranslationTask(ctx context.Context, t queue.Task) error
 		return fmt.Errorf("failed to get task, id: %s, error: %w", task.ID, err)
 	}
 
+	if dbTask.Status.IsFinal() {
+		// cancelled, or finished by an earlier delivery
+		log.Printf("skip %s task, taskID: %s", dbTask.Status, task.ID)
+		return nil
+	}
+	// a processing task is delivered again when retried, or when its worker died and the lease
+	// expired, running workers keep renewing the leases of their tasks
+	if dbTask.Status != model.TaskStatusProcessing {
+		if err := s.transition(ctx, dbTask, model.TaskStatusProcessing); err != nil {
+			if errors.Is(err, ErrInvalidTransition) {
+				log.Printf("skip task, taskID: %s, error: %v", task.ID, err)
+				return nil
+			}
+			return err
+		}
+	}
+
 	// execute translation
-	translatedText, err := s.translator.Translate(ctx, task.SourceContent, task.SourceLang, task.TargetLang)
+	reporter := s.newProgressReporter(ctx, dbTask.ID)
+	result, err := s.translate(ctx, task, reporter.report)
+	if reporter.progress != nil {
+		// the final progress is stored with the outcome
+		dbTask.Progress = reporter.progress
+	}
+	s.recordUsage(dbTask, result, err == nil)
+	if err != nil && ctx.Err() != nil {
+		if errors.Is(context.Cause(ctx), worker.ErrTaskTimeout) {
+			dbTask.Attempts = task.Attempts + 1
+			s.failTimeout(dbTask)
+		}
+		// cancelled tasks are updated by CancelTask, interrupted ones are delivered again
+		return ctx.Err()
+	}
+	if errors.Is(err, llm.ErrCircuitOpen) {
+		// provider is down, try again once the breaker lets calls through instead of failing
+		// the task. If it can't be scheduled, the queue retries it like transient errors.
+		if err := s.requeueLater(ctx, task, s.circuitRetryAfter()); err != nil {
+			return err
+		}
+		if err := s.transition(ctx, dbTask, model.TaskStatusQueued); err != nil {
+			// cancelled meanwhile, it's skipped once delivered
+			log.Printf("failed to requeue task, taskID: %s, error: %v", task.ID, err)
+		}
+		return nil
+	}
+	dbTask.Attempts = task.Attempts + 1
+	if err != nil && llm.IsRetryable(err) {
+		// transient error, let the queue retry the task with backoff, the task stays processing
+		dbTask.Error = err.Error()
+		if err := s.repo.UpdateTaskIfStatus(ctx, dbTask, model.TaskStatusProcessing); err != nil {
+			log.Printf("failed to update task, taskID: %s, error: %v", task.ID, err)
+		}
+		return err
+	}
+	status := model.TaskStatusCompleted
 	if err != nil {
-		dbTask.Status = model.TaskStatusFailed
+		status = model.TaskStatusFailed
 		dbTask.Error = err.Error()
 	} else {
-		dbTask.Status = model.TaskStatusCompleted
-		dbTask.ResultContent = translatedText
+		dbTask.ResultContent = result.Content
+		dbTask.Model = result.Model
 	}
 
-	// update task status
-	return s.repo.UpdateTask(ctx, dbTask)
+	// update task status, the outcome is stored even if the task is interrupted meanwhile,
+	// so a finished translation is not run again
+	ctx = context.Background()
+	if err := s.transition(ctx, dbTask, status); err != nil {
+		if errors.Is(err, ErrInvalidTransition) {
+			// cancelled meanwhile, the cancellation wins
+			log.Printf("discard task outcome, taskID: %s, error: %v", task.ID, err)
+			return nil
+		}
+		return err
+	}
+	return nil
 }
 
-// GetTranslation get translation result
-func (s *Service) GetTranslation(ctx context.Context, taskID string) (string, error) {
-	id, err := primitive.ObjectIDFromHex(taskID)
+// failTimeout mark task failed as it ran out of time, the handler context is done already
+func (s *Service) failTimeout(task *model.Task) {
+	timeout := task.Timeout
+	if timeout == 0 {
+		timeout = s.cfg.Worker.TaskTimeout
+	}
+	task.Error = fmt.Sprintf("translation timed out after %v", timeout)
+	if err := s.transition(context.Background(), task, model.TaskStatusFailed); err != nil {
+		log.Printf("failed to update task, taskID: %s, error: %v", task.ID.Hex(), err)
+	}
+}
+
+// HandleRequeue mark task interrupted by shutdown queued until it's dequeued again
+func (s *Service) HandleRequeue(ctx context.Context, t queue.Task) {
+	id, err := primitive.ObjectIDFromHex(t.GetID())
+	if err != nil {
+		log.Printf("invalid requeued task id, taskID: %s, error: %v", t.GetID(), err)
+		return
+	}
+
+	task, err := s.repo.GetTask(ctx, id)
+	if err != nil {
+		log.Printf("failed to get task, taskID: %s, error: %v", t.GetID(), err)
+		return
+	}
+	if task.Status != model.TaskStatusProcessing {
+		return
+	}
+
+	if err := s.transition(ctx, task, model.TaskStatusQueued); err != nil {
+		log.Printf("failed to update task, taskID: %s, error: %v", t.GetID(), err)
+	}
+}
+
+// HandleDeadLetter mark task failed once its retries are exhausted
+func (s *Service) HandleDeadLetter(ctx context.Context, t queue.Task, cause error) {
+	id, err := primitive.ObjectIDFromHex(t.GetID())
 	if err != nil {
-		return "", fmt.Errorf("invalid task id, taskID: %v, error: %w", taskID, err)
+		log.Printf("invalid dead letter task id, taskID: %s, error: %v", t.GetID(), err)
+		return
 	}
 
 	task, err := s.repo.GetTask(ctx, id)
 	if err != nil {
-		return "", fmt.Errorf("failed to get task, id: %s, error: %w", taskID, err)
+		log.Printf("failed to get task, taskID: %s, error: %v", t.GetID(), err)
+		return
+	}
+
+	if rt, ok := t.(queue.RetryableTask); ok {
+		task.Attempts = rt.GetAttempts()
 	}
-	if task == nil {
-		return "", fmt.Errorf("task not found, id: %s", taskID)
+	if cause != nil {
+		task.Error = fmt.Sprintf("retries exhausted, error: %v", cause)
+	}
+	if err := s.transition(ctx, task, model.TaskStatusFailed); err != nil {
+		log.Printf("failed to update task, taskID: %s, error: %v", t.GetID(), err)
+	}
+}
+
+// requeueLater add the task to the delay queue of the queue, so it's not lost on restart
+func (s *Service) requeueLater(ctx context.Context, task *model.TranslationTask, delay time.Duration) error {
+	scheduler, ok := s.queue.(queue.Scheduler)
+	if !ok {
+		return ErrScheduleUnsupported
+	}
+	log.Printf("translation provider unavailable, requeue task in %v, taskID: %s", delay, task.ID)
+	if err := scheduler.Schedule(ctx, task, time.Now().Add(delay)); err != nil {
+		return fmt.Errorf("failed to schedule task, taskID: %s, error: %w", task.ID, err)
+	}
+	return nil
+}
+
+// circuitRetryAfter time before the breaker of the provider lets calls through again
+func (s *Service) circuitRetryAfter() time.Duration {
+	if s.breakers != nil {
+		if d := s.breakers.Get(s.cfg.LLM.Provider).RetryAfter(); d > 0 {
+			return d
+		}
+	}
+	// half-open already, or the breaker is unknown
+	return s.cfg.Queue.RetryDelay
+}
+
+// GetTranslation get translation result of the user's completed task
+func (s *Service) GetTranslation(ctx context.Context, taskID string, userID primitive.ObjectID) (string, error) {
+	task, err := s.getUserTask(ctx, taskID, userID)
+	if err != nil {
+		return "", err
 	}
 
 	if task.Status != model.TaskStatusCompleted {
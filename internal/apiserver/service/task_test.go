@@ -0,0 +1,236 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmualex2023/i18n-translation/internal/apiserver/config"
+	"github.com/xmualex2023/i18n-translation/internal/apiserver/model"
+	"github.com/xmualex2023/i18n-translation/internal/pkg/breaker"
+	"github.com/xmualex2023/i18n-translation/internal/pkg/queue"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// TestRequeueLater 测试熔断时任务进入延迟队列，延迟为熔断器剩余的打开时间
+func TestRequeueLater(t *testing.T) {
+	cfg := config.DefaultConfig()
+	q, err := queue.NewMemoryQueue()
+	require.NoError(t, err)
+	breakers := breaker.NewRegistry(breaker.Settings{FailureThreshold: 1, OpenTimeout: time.Minute, HalfOpenMaxCalls: 1})
+	s := &Service{cfg: cfg, queue: q, breakers: breakers}
+
+	// 熔断器未打开时使用 queue.retry_delay
+	assert.Equal(t, cfg.Queue.RetryDelay, s.circuitRetryAfter())
+
+	breakers.Get(cfg.LLM.Provider).Record(false)
+	delay := s.circuitRetryAfter()
+	assert.InDelta(t, time.Minute, delay, float64(time.Second))
+
+	ctx := context.Background()
+	require.NoError(t, s.requeueLater(ctx, &model.TranslationTask{ID: "task1"}, delay))
+	tasks, total, err := q.ScheduledTasks(ctx, 0, 10)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), total)
+	assert.Equal(t, "task1", tasks[0].ID)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), tasks[0].RunAt, time.Second)
+}
+
+// TestParseTimeout 测试任务超时必须小于队列的租约时间
+func TestParseTimeout(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Queue.VisibilityTimeout = 5 * time.Minute
+	s := &Service{cfg: cfg}
+
+	d, err := s.parseTimeout("")
+	require.NoError(t, err)
+	assert.Zero(t, d)
+	d, err = s.parseTimeout("4m")
+	require.NoError(t, err)
+	assert.Equal(t, 4*time.Minute, d)
+
+	for _, timeout := range []string{"5m", "10m", "2h", "0s", "-1m", "soon"} {
+		_, err := s.parseTimeout(timeout)
+		assert.ErrorIs(t, err, ErrInvalidTask, timeout)
+	}
+}
+
+func TestTransition(t *testing.T) {
+	mt := newMockTest(t)
+	ctx := context.Background()
+
+	mt.Run("Forbidden", func(mt *mtest.T) {
+		s := newMockService(mt, nil)
+		task := newTask(model.TaskStatusCompleted)
+		err := s.transition(ctx, task, model.TaskStatusQueued)
+		assert.ErrorIs(mt, err, ErrInvalidTransition)
+		assert.Equal(mt, model.TaskStatusCompleted, task.Status)
+		assert.Empty(mt, commands(mt))
+	})
+
+	mt.Run("StaleStatus", func(mt *mtest.T) {
+		s := newMockService(mt, nil)
+		task := newTask(model.TaskStatusPending)
+		// 读取后状态已被修改
+		mt.AddMockResponses(writeResult(0))
+
+		err := s.transition(ctx, task, model.TaskStatusQueued)
+		assert.ErrorIs(mt, err, ErrInvalidTransition)
+		assert.Equal(mt, model.TaskStatusPending, task.Status)
+		assert.Equal(mt, []string{"update tasks"}, commands(mt))
+	})
+
+	mt.Run("Final", func(mt *mtest.T) {
+		s := newMockService(mt, nil)
+		task := newTask(model.TaskStatusProcessing)
+		mt.AddMockResponses(writeResult(1), findResult(mt, "webhooks"))
+
+		require.NoError(mt, s.transition(ctx, task, model.TaskStatusFailed))
+		assert.Equal(mt, model.TaskStatusFailed, task.Status)
+		// 进入终态后查找订阅的 webhook
+		assert.Equal(mt, []string{"update tasks", "find webhooks"}, commands(mt))
+	})
+}
+
+// TestRequeueDeadLetterRollback 死信不存在时恢复为 failed，不再次通知 webhook
+func TestRequeueDeadLetterRollback(t *testing.T) {
+	mt := newMockTest(t)
+
+	mt.Run("Rollback", func(mt *mtest.T) {
+		q, err := queue.NewMemoryQueue()
+		require.NoError(mt, err)
+		s := newMockService(mt, q)
+		task := newTask(model.TaskStatusFailed)
+		task.Error = "boom"
+		mt.AddMockResponses(findResult(mt, "tasks", task), writeResult(1), writeResult(1))
+
+		err = s.RequeueDeadLetter(context.Background(), task.ID.Hex())
+		assert.ErrorIs(mt, err, ErrDeadLetterNotFound)
+		assert.Equal(mt, []string{"find tasks", "update tasks", "update tasks"}, commands(mt))
+
+		rollback := command(mt, 2)["updates"].(bson.A)[0].(bson.M)
+		assert.Equal(mt, bson.M{"$in": bson.A{"queued"}}, rollback["q"].(bson.M)["status"])
+		set := rollback["u"].(bson.M)["$set"].(bson.M)
+		assert.Equal(mt, "failed", set["status"])
+		assert.Equal(mt, "boom", set["error"])
+	})
+}
+
+// TestTaskCursor 测试游标编码后可以还原，格式错误的游标返回 ErrInvalidTaskQuery
+func TestTaskCursor(t *testing.T) {
+	c := &taskCursor{Sort: "-created_at", Value: time.Date(2024, 5, 1, 8, 30, 0, 123000000, time.UTC), ID: primitive.NewObjectID()}
+	decoded, err := decodeTaskCursor(encodeTaskCursor(c))
+	require.NoError(t, err)
+	assert.Equal(t, c.Sort, decoded.Sort)
+	assert.True(t, c.Value.Equal(decoded.Value))
+	assert.Equal(t, c.ID, decoded.ID)
+
+	tests := []struct {
+		name   string
+		sort   string
+		cursor string
+	}{
+		{name: "NotBase64", cursor: "not base64!"},
+		{name: "NotJSON", cursor: base64.RawURLEncoding.EncodeToString([]byte("cursor"))},
+		{name: "InvalidID", cursor: base64.RawURLEncoding.EncodeToString([]byte(`{"s":"-created_at","v":"2024-05-01T08:30:00Z","id":"1"}`))},
+		// 游标与排序方式绑定
+		{name: "SortMismatch", sort: "updated_at", cursor: encodeTaskCursor(c)},
+	}
+
+	mt := newMockTest(t)
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			s := newMockService(mt, nil)
+			_, err := s.ListTasks(context.Background(), &model.ListTasksRequest{Sort: tt.sort, Cursor: tt.cursor}, primitive.NewObjectID())
+			assert.ErrorIs(mt, err, ErrInvalidTaskQuery)
+			assert.Empty(mt, commands(mt))
+		})
+	}
+}
+
+// TestListTasksPaging 测试创建时间相同的任务按 _id 分页，不跳过也不重复
+func TestListTasksPaging(t *testing.T) {
+	mt := newMockTest(t)
+
+	mt.Run("SameCreatedAt", func(mt *mtest.T) {
+		s := newMockService(mt, nil)
+		userID := primitive.NewObjectID()
+		created := time.Now().UTC().Truncate(time.Millisecond)
+
+		// 按 -created_at 排序后的全部任务
+		var all []*model.Task
+		for i := 0; i < 5; i++ {
+			task := newTask(model.TaskStatusCompleted)
+			task.UserID, task.CreatedAt, task.UpdatedAt = userID, created, created
+			all = append([]*model.Task{task}, all...)
+		}
+
+		const limit = 2
+		var ids []string
+		cursor := ""
+		for page := 0; page < 5; page++ {
+			// 模拟 MongoDB 按游标返回的任务
+			rest := all
+			if cursor != "" {
+				c, err := decodeTaskCursor(cursor)
+				require.NoError(mt, err)
+				rest = rest[:0:0]
+				for _, task := range all {
+					if task.CreatedAt.Before(c.Value) || task.CreatedAt.Equal(c.Value) && task.ID.Hex() < c.ID.Hex() {
+						rest = append(rest, task)
+					}
+				}
+			}
+			if len(rest) > limit+1 {
+				rest = rest[:limit+1]
+			}
+			docs := make([]interface{}, 0, len(rest))
+			for _, task := range rest {
+				docs = append(docs, task)
+			}
+			mt.ClearEvents()
+			mt.AddMockResponses(findResult(mt, "tasks", docs...))
+
+			resp, err := s.ListTasks(context.Background(), &model.ListTasksRequest{Cursor: cursor, Limit: limit}, userID)
+			require.NoError(mt, err)
+
+			find := command(mt, 0)
+			assert.Equal(mt, int64(limit+1), find["limit"])
+			assert.Equal(mt, bson.M{"created_at": int32(-1), "_id": int32(-1)}, find["sort"])
+			filter := find["filter"].(bson.M)
+			if cursor == "" {
+				assert.NotContains(mt, filter, "$or")
+			} else {
+				last, err := primitive.ObjectIDFromHex(ids[len(ids)-1])
+				require.NoError(mt, err)
+				assert.Equal(mt, bson.A{
+					bson.M{"created_at": bson.M{"$lt": primitive.NewDateTimeFromTime(created)}},
+					bson.M{"created_at": primitive.NewDateTimeFromTime(created), "_id": bson.M{"$lt": last}},
+				}, filter["$or"])
+			}
+
+			for _, item := range resp.Items {
+				ids = append(ids, item.ID)
+			}
+			if resp.NextCursor == "" {
+				break
+			}
+			// 下一页从本页最后一个任务之后开始，而不是多查询的那一个
+			c, err := decodeTaskCursor(resp.NextCursor)
+			require.NoError(mt, err)
+			assert.Equal(mt, ids[len(ids)-1], c.ID.Hex())
+			cursor = resp.NextCursor
+		}
+
+		want := make([]string, 0, len(all))
+		for _, task := range all {
+			want = append(want, task.ID.Hex())
+		}
+		assert.Equal(mt, want, ids)
+	})
+}
@@ -0,0 +1,106 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/xmualex2023/i18n-translation/internal/apiserver/model"
+	"github.com/xmualex2023/i18n-translation/internal/pkg/llm"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrInvalidUsagePeriod = errors.New("invalid usage period")
+	ErrInvalidUsageRange  = errors.New("invalid usage date range")
+)
+
+// calcCost calculate cost of the usage from the configured price table
+func (s *Service) calcCost(modelName string, usage llm.Usage) float64 {
+	price, ok := s.cfg.LLM.Prices[modelName]
+	if !ok {
+		return 0
+	}
+	return float64(usage.PromptTokens)/1000*price.Prompt +
+		float64(usage.CompletionTokens)/1000*price.Completion
+}
+
+// recordUsage add tokens and cost of an attempt to the task and to the usage of its owner. The
+// provider bills every request, so failed, timed out and interrupted attempts are recorded too,
+// the task itself is counted once it completes.
+func (s *Service) recordUsage(task *model.Task, result *llm.Result, completed bool) {
+	if result == nil {
+		return
+	}
+	usage := result.Usage
+	if !completed && usage.PromptTokens == 0 && usage.CompletionTokens == 0 {
+		return
+	}
+
+	cost := s.calcCost(result.Model, usage)
+	task.PromptTokens += usage.PromptTokens
+	task.CompletionTokens += usage.CompletionTokens
+	task.Cost += cost
+
+	tasks := 0
+	if completed {
+		tasks = 1
+	}
+	// the attempt may be cancelled already
+	if err := s.repo.IncUsage(context.Background(), task.UserID, time.Now(), tasks, usage.PromptTokens, usage.CompletionTokens, cost); err != nil {
+		log.Printf("failed to record usage, taskID: %s, error: %v", task.ID.Hex(), err)
+	}
+}
+
+// GetUsage get user usage aggregated by day or month
+func (s *Service) GetUsage(ctx context.Context, req *model.UsageRequest, userID primitive.ObjectID) (*model.UsageResponse, error) {
+	period := model.UsagePeriod(req.Period)
+	switch period {
+	case "":
+		period = model.UsagePeriodDay
+	case model.UsagePeriodDay, model.UsagePeriodMonth:
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrInvalidUsagePeriod, req.Period)
+	}
+
+	// default range: last 30 days or last 12 months
+	now := time.Now()
+	from, to := req.From, req.To
+	if to == "" {
+		to = now.Format(period.Layout())
+	}
+	if from == "" {
+		if period == model.UsagePeriodMonth {
+			from = now.AddDate(0, -11, 0).Format(period.Layout())
+		} else {
+			from = now.AddDate(0, 0, -29).Format(period.Layout())
+		}
+	}
+	if _, err := time.Parse(period.Layout(), from); err != nil {
+		return nil, fmt.Errorf("%w: from=%s", ErrInvalidUsageRange, from)
+	}
+	if _, err := time.Parse(period.Layout(), to); err != nil {
+		return nil, fmt.Errorf("%w: to=%s", ErrInvalidUsageRange, to)
+	}
+
+	usages, err := s.repo.ListUsage(ctx, userID, period, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list usage, userID: %s, error: %w", userID.Hex(), err)
+	}
+
+	resp := &model.UsageResponse{
+		Period: period,
+		From:   from,
+		To:     to,
+		Items:  usages,
+	}
+	for _, u := range usages {
+		resp.Tasks += u.Tasks
+		resp.PromptTokens += u.PromptTokens
+		resp.CompletionTokens += u.CompletionTokens
+		resp.Cost += u.Cost
+	}
+	return resp, nil
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmualex2023/i18n-translation/internal/apiserver/config"
+	"github.com/xmualex2023/i18n-translation/internal/apiserver/model"
+	"github.com/xmualex2023/i18n-translation/internal/pkg/llm"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestCalcCost(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.LLM.Prices = map[string]config.ModelPrice{
+		"gpt-4o": {Prompt: 0.005, Completion: 0.015},
+		"free":   {},
+	}
+	s := &Service{cfg: cfg}
+
+	tests := []struct {
+		name  string
+		model string
+		usage llm.Usage
+		cost  float64
+	}{
+		{name: "Priced", model: "gpt-4o", usage: llm.Usage{PromptTokens: 2000, CompletionTokens: 500}, cost: 0.0175},
+		{name: "PartialThousand", model: "gpt-4o", usage: llm.Usage{PromptTokens: 100, CompletionTokens: 10}, cost: 0.00065},
+		{name: "NoUsage", model: "gpt-4o", cost: 0},
+		{name: "FreeModel", model: "free", usage: llm.Usage{PromptTokens: 1000, CompletionTokens: 1000}, cost: 0},
+		// 未配置价格的模型不计费
+		{name: "UnknownModel", model: "unknown", usage: llm.Usage{PromptTokens: 1000, CompletionTokens: 1000}, cost: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.InDelta(t, tt.cost, s.calcCost(tt.model, tt.usage), 1e-12)
+		})
+	}
+}
+
+// failingTranslator 翻译部分批次后失败的翻译器
+type failingTranslator struct {
+	usage llm.Usage
+	err   error
+}
+
+func (f *failingTranslator) Translate(ctx context.Context, text, sourceLang, targetLang string) (*llm.Result, error) {
+	return nil, f.err
+}
+
+func (f *failingTranslator) TranslateSegments(ctx context.Context, segments []llm.Segment, sourceLang, targetLang string, onProgress llm.ProgressFunc) (*llm.BatchResult, error) {
+	return &llm.BatchResult{Translations: map[string]string{}, Model: "gpt-4o", Usage: f.usage}, f.err
+}
+
+// TestTranslatePartialUsage 测试文档翻译失败时返回已计费的用量
+func TestTranslatePartialUsage(t *testing.T) {
+	usage := llm.Usage{PromptTokens: 120, CompletionTokens: 80}
+	s := &Service{cfg: config.DefaultConfig(), translator: &failingTranslator{usage: usage, err: context.DeadlineExceeded}}
+
+	task := &model.TranslationTask{ID: "task1", SourceLang: "en", TargetLang: "zh", SourceContent: `{"title": "Start"}`}
+	result, err := s.translate(context.Background(), task, nil)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	require.NotNil(t, result)
+	assert.Equal(t, usage, result.Usage)
+	assert.Equal(t, "gpt-4o", result.Model)
+	assert.Empty(t, result.Content)
+}
+
+// TestRecordUsage 测试每次执行的用量都计入任务和用户用量，只有完成的执行计为一个任务
+func TestRecordUsage(t *testing.T) {
+	mt := newMockTest(t)
+
+	mt.Run("Attempts", func(mt *mtest.T) {
+		s := newMockService(mt, nil)
+		s.cfg.LLM.Prices = map[string]config.ModelPrice{"gpt-4o": {Prompt: 0.005, Completion: 0.015}}
+		task := newTask(model.TaskStatusProcessing)
+		mt.AddMockResponses(writeResult(2), writeResult(2))
+
+		// 失败的执行只累加 token 和费用
+		s.recordUsage(task, &llm.Result{Model: "gpt-4o", Usage: llm.Usage{PromptTokens: 2000, CompletionTokens: 500}}, false)
+		s.recordUsage(task, &llm.Result{Model: "gpt-4o", Usage: llm.Usage{PromptTokens: 1000}}, true)
+		assert.Equal(mt, 3000, task.PromptTokens)
+		assert.Equal(mt, 500, task.CompletionTokens)
+		assert.InDelta(mt, 0.0225, task.Cost, 1e-12)
+
+		for i, tasks := range []int32{0, 1} {
+			cmd := command(mt, i)
+			assert.Equal(mt, "usage", cmd["update"])
+			inc := cmd["updates"].(bson.A)[0].(bson.M)["u"].(bson.M)["$inc"].(bson.M)
+			assert.Equal(mt, tasks, inc["tasks"])
+		}
+	})
+
+	mt.Run("NothingBilled", func(mt *mtest.T) {
+		s := newMockService(mt, nil)
+		task := newTask(model.TaskStatusProcessing)
+
+		s.recordUsage(task, nil, false)
+		s.recordUsage(task, &llm.Result{Model: "gpt-4o"}, false)
+		assert.Empty(mt, commands(mt))
+	})
+}
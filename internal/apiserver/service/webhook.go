@@ -0,0 +1,247 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/xmualex2023/i18n-translation/internal/apiserver/model"
+	"github.com/xmualex2023/i18n-translation/internal/pkg/util"
+	"github.com/xmualex2023/i18n-translation/internal/pkg/webhook"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrInvalidWebhook  = errors.New("invalid webhook")
+	ErrWebhookNotFound = errors.New("webhook not found")
+)
+
+const defaultDeliveryListLimit = 20
+
+// CreateWebhook register webhook of the user, for one task or all of the user's tasks
+func (s *Service) CreateWebhook(ctx context.Context, req *model.CreateWebhookRequest, userID primitive.ObjectID) (*model.CreateWebhookResponse, error) {
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("%w: url must be http or https", ErrInvalidWebhook)
+	}
+	// host names are checked again when sending, after they're resolved
+	if ip := net.ParseIP(u.Hostname()); u.Hostname() == "localhost" || (ip != nil && webhook.IsForbiddenIP(ip)) {
+		return nil, fmt.Errorf("%w: internal addresses are not allowed", ErrInvalidWebhook)
+	}
+
+	hook := &model.Webhook{
+		UserID: userID,
+		URL:    req.URL,
+		Events: req.Events,
+		Secret: req.Secret,
+	}
+	if len(hook.Events) == 0 {
+		hook.Events = model.WebhookEvents
+	}
+	if hook.Secret == "" {
+		if hook.Secret, err = webhook.GenerateSecret(); err != nil {
+			return nil, err
+		}
+	}
+
+	if req.TaskID != "" {
+		taskID, err := primitive.ObjectIDFromHex(req.TaskID)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid task id", ErrInvalidWebhook)
+		}
+		task, err := s.repo.GetTask(ctx, taskID)
+		if err != nil || task.UserID != userID {
+			return nil, fmt.Errorf("%w: task not found, id: %s", ErrInvalidWebhook, req.TaskID)
+		}
+		hook.TaskID = &taskID
+	}
+
+	if err := s.repo.CreateWebhook(ctx, hook); err != nil {
+		return nil, fmt.Errorf("failed to create webhook, error: %w", err)
+	}
+	return &model.CreateWebhookResponse{Webhook: hook, Secret: hook.Secret}, nil
+}
+
+// ListWebhooks list webhooks of the user
+func (s *Service) ListWebhooks(ctx context.Context, userID primitive.ObjectID) (*model.WebhookListResponse, error) {
+	hooks, err := s.repo.ListWebhooks(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhooks, userID: %s, error: %w", userID.Hex(), err)
+	}
+	return &model.WebhookListResponse{Items: hooks}, nil
+}
+
+// DeleteWebhook delete webhook of the user, pending deliveries of it are dropped
+func (s *Service) DeleteWebhook(ctx context.Context, webhookID string, userID primitive.ObjectID) error {
+	id, err := primitive.ObjectIDFromHex(webhookID)
+	if err != nil {
+		return ErrWebhookNotFound
+	}
+
+	deleted, err := s.repo.DeleteWebhook(ctx, userID, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook, id: %s, error: %w", webhookID, err)
+	}
+	if !deleted {
+		return ErrWebhookNotFound
+	}
+	return nil
+}
+
+// ListWebhookDeliveries list deliveries of the webhook with their attempts, newest first
+func (s *Service) ListWebhookDeliveries(ctx context.Context, webhookID string, req *model.WebhookDeliveryListRequest, userID primitive.ObjectID) (*model.WebhookDeliveryListResponse, error) {
+	id, err := primitive.ObjectIDFromHex(webhookID)
+	if err != nil {
+		return nil, ErrWebhookNotFound
+	}
+
+	limit := req.Limit
+	if limit == 0 {
+		limit = defaultDeliveryListLimit
+	}
+	items, total, err := s.repo.ListDeliveries(ctx, userID, id, req.Offset, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook deliveries, id: %s, error: %w", webhookID, err)
+	}
+	return &model.WebhookDeliveryListResponse{Items: items, Total: total}, nil
+}
+
+// notifyWebhooks create deliveries of the task event for the subscribed webhooks, they're sent
+// by the dispatcher, so a slow endpoint doesn't hold the task up
+func (s *Service) notifyWebhooks(ctx context.Context, task *model.Task) {
+	event, ok := model.WebhookEventOf(task.Status)
+	if !ok {
+		return
+	}
+
+	hooks, err := s.repo.MatchWebhooks(ctx, task.UserID, task.ID, event)
+	if err != nil {
+		log.Printf("failed to match webhooks, taskID: %s, error: %v", task.ID.Hex(), err)
+		return
+	}
+	if len(hooks) == 0 {
+		return
+	}
+
+	now := time.Now()
+	deliveries := make([]*model.WebhookDelivery, 0, len(hooks))
+	for _, hook := range hooks {
+		id := primitive.NewObjectID()
+		payload, err := json.Marshal(&model.WebhookPayload{
+			ID:        id.Hex(),
+			Event:     event,
+			CreatedAt: now,
+			Task:      newTaskResponse(task),
+		})
+		if err != nil {
+			log.Printf("failed to encode webhook payload, taskID: %s, error: %v", task.ID.Hex(), err)
+			return
+		}
+		deliveries = append(deliveries, &model.WebhookDelivery{
+			ID:            id,
+			WebhookID:     hook.ID,
+			UserID:        task.UserID,
+			TaskID:        task.ID,
+			Event:         event,
+			URL:           hook.URL,
+			Payload:       string(payload),
+			Status:        model.DeliveryStatusPending,
+			Attempts:      []model.DeliveryAttempt{},
+			NextAttemptAt: now,
+		})
+	}
+	if err := s.repo.CreateDeliveries(ctx, deliveries); err != nil {
+		log.Printf("failed to create webhook deliveries, taskID: %s, error: %v", task.ID.Hex(), err)
+	}
+}
+
+// RunWebhookDispatcher send due webhook deliveries until ctx is done. Deliveries are claimed
+// atomically, so dispatchers of several processes can run together.
+func (s *Service) RunWebhookDispatcher(ctx context.Context) {
+	cfg := s.cfg.Webhook
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+
+	sem := make(chan struct{}, cfg.Concurrency)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for ctx.Err() == nil {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+
+			// the lease covers the request, then the delivery is claimable again
+			delivery, err := s.repo.ClaimDelivery(ctx, 2*cfg.Timeout)
+			if err != nil || delivery == nil {
+				<-sem
+				if err != nil && ctx.Err() == nil {
+					log.Printf("failed to claim webhook delivery, error: %v", err)
+				}
+				break
+			}
+			util.SafetyGo(func() {
+				defer func() { <-sem }()
+				s.deliver(ctx, delivery)
+			})
+		}
+	}
+}
+
+// deliver send delivery once and record the attempt, it's retried with backoff until
+// webhook.max_attempts is reached
+func (s *Service) deliver(ctx context.Context, delivery *model.WebhookDelivery) {
+	cfg := s.cfg.Webhook
+	hook, err := s.repo.GetWebhook(ctx, delivery.WebhookID)
+	if err != nil {
+		log.Printf("failed to get webhook, id: %s, error: %v", delivery.WebhookID.Hex(), err)
+		return
+	}
+
+	attempt := model.DeliveryAttempt{At: time.Now()}
+	if hook == nil {
+		attempt.Error = "webhook deleted"
+	} else {
+		resp, err := s.webhooks.Send(ctx, &webhook.Request{
+			URL:        delivery.URL,
+			Secret:     hook.Secret,
+			Event:      string(delivery.Event),
+			DeliveryID: delivery.ID.Hex(),
+			Body:       []byte(delivery.Payload),
+		})
+		if resp != nil {
+			attempt.StatusCode = resp.StatusCode
+			attempt.DurationMs = resp.Duration.Milliseconds()
+		}
+		if err != nil {
+			attempt.Error = err.Error()
+		}
+	}
+
+	status := model.DeliveryStatusSucceeded
+	next := attempt.At
+	attempts := len(delivery.Attempts) + 1
+	if attempt.Error != "" {
+		status = model.DeliveryStatusPending
+		next = attempt.At.Add(webhook.Backoff(attempts, cfg.BaseDelay, cfg.MaxDelay))
+		if hook == nil || attempts >= cfg.MaxAttempts {
+			status = model.DeliveryStatusFailed
+		}
+	}
+
+	// the attempt is recorded even if the dispatcher is stopping
+	if err := s.repo.AddDeliveryAttempt(context.Background(), delivery.ID, attempt, status, next); err != nil {
+		log.Printf("failed to record webhook delivery attempt, id: %s, error: %v", delivery.ID.Hex(), err)
+	}
+}
@@ -0,0 +1,58 @@
+package service
+
+import (
+	"errors"
+
+	"github.com/xmualex2023/i18n-translation/internal/apiserver/model"
+	"github.com/xmualex2023/i18n-translation/internal/pkg/worker"
+)
+
+var ErrWorkerPoolUnavailable = errors.New("no worker pool in this process")
+
+// workerPool worker pool resizable at runtime
+type workerPool interface {
+	Status() worker.PoolStatus
+	Update(size, min, max int) error
+}
+
+// SetWorkerPool set worker pool managed by the admin api, the pool is created after the
+// service as it runs the handlers of the service
+func (s *Service) SetWorkerPool(pool workerPool) {
+	s.workers = pool
+}
+
+// WorkerPool get worker pool status
+func (s *Service) WorkerPool() (*model.WorkerPoolResponse, error) {
+	if s.workers == nil {
+		return nil, ErrWorkerPoolUnavailable
+	}
+
+	status := s.workers.Status()
+	resp := &model.WorkerPoolResponse{
+		Size:          status.Size,
+		Active:        status.Active,
+		Min:           status.Min,
+		Max:           status.Max,
+		Autoscale:     status.Autoscale,
+		Desired:       status.Desired,
+		QueueDepth:    status.QueueDepth,
+		EstimatedWait: status.EstimatedWait.Seconds(),
+		TaskDuration:  status.TaskDuration.Seconds(),
+		LLMLatency:    status.LLMLatency.Seconds(),
+	}
+	if !status.LastScaleAt.IsZero() {
+		resp.LastScaleAt = &status.LastScaleAt
+	}
+	return resp, nil
+}
+
+// UpdateWorkerPool resize worker pool or change its autoscaling bounds
+func (s *Service) UpdateWorkerPool(req *model.WorkerPoolUpdateRequest) (*model.WorkerPoolResponse, error) {
+	if s.workers == nil {
+		return nil, ErrWorkerPoolUnavailable
+	}
+	if err := s.workers.Update(req.Size, req.Min, req.Max); err != nil {
+		return nil, err
+	}
+	return s.WorkerPool()
+}
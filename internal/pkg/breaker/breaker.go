@@ -0,0 +1,215 @@
+package breaker
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/xmualex2023/i18n-translation/internal/pkg/metrics"
+)
+
+var ErrOpen = errors.New("circuit breaker is open")
+
+// State circuit breaker state
+type State int
+
+const (
+	StateClosed   State = iota // 关闭：正常放行
+	StateHalfOpen              // 半开：放行少量探测请求
+	StateOpen                  // 打开：拒绝所有请求
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateHalfOpen:
+		return "half-open"
+	case StateOpen:
+		return "open"
+	default:
+		return "unknown"
+	}
+}
+
+// Settings circuit breaker settings
+type Settings struct {
+	FailureThreshold int           // 连续失败次数达到阈值后打开
+	OpenTimeout      time.Duration // 打开状态持续时间，超时后进入半开
+	HalfOpenMaxCalls int           // 半开状态允许的探测请求数，全部成功后关闭
+}
+
+// Breaker circuit breaker
+type Breaker struct {
+	name     string
+	settings Settings
+
+	mu        sync.Mutex
+	state     State
+	failures  int
+	openedAt  time.Time
+	probes    int // 半开状态已放行的请求数
+	successes int // 半开状态成功的请求数
+}
+
+func New(name string, settings Settings) *Breaker {
+	if settings.FailureThreshold <= 0 {
+		settings.FailureThreshold = 5
+	}
+	if settings.OpenTimeout <= 0 {
+		settings.OpenTimeout = 30 * time.Second
+	}
+	if settings.HalfOpenMaxCalls <= 0 {
+		settings.HalfOpenMaxCalls = 1
+	}
+
+	b := &Breaker{
+		name:     name,
+		settings: settings,
+	}
+	metrics.SetCircuitBreakerState(name, int(StateClosed))
+	return b
+}
+
+// Name breaker name
+func (b *Breaker) Name() string {
+	return b.name
+}
+
+// State current state
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refresh(time.Now())
+	return b.state
+}
+
+// Allow check if a call is allowed, returns ErrOpen if not
+func (b *Breaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refresh(time.Now())
+	switch b.state {
+	case StateOpen:
+		return ErrOpen
+	case StateHalfOpen:
+		if b.probes >= b.settings.HalfOpenMaxCalls {
+			return ErrOpen
+		}
+		b.probes++
+	}
+	return nil
+}
+
+// Record record the result of an allowed call
+func (b *Breaker) Record(success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.refresh(now)
+	switch b.state {
+	case StateClosed:
+		if success {
+			b.failures = 0
+			return
+		}
+		b.failures++
+		if b.failures >= b.settings.FailureThreshold {
+			b.setState(StateOpen, now)
+		}
+	case StateHalfOpen:
+		if !success {
+			b.setState(StateOpen, now)
+			return
+		}
+		b.successes++
+		if b.successes >= b.settings.HalfOpenMaxCalls {
+			b.setState(StateClosed, now)
+		}
+	}
+}
+
+// Cancel release an allowed call whose result should not be counted, e.g. canceled by caller
+func (b *Breaker) Cancel() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == StateHalfOpen && b.probes > 0 {
+		b.probes--
+	}
+}
+
+// RetryAfter remaining time before the breaker turns half-open
+func (b *Breaker) RetryAfter() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state != StateOpen {
+		return 0
+	}
+	if d := b.settings.OpenTimeout - time.Since(b.openedAt); d > 0 {
+		return d
+	}
+	return 0
+}
+
+// refresh turn open into half-open once open timeout elapsed
+func (b *Breaker) refresh(now time.Time) {
+	if b.state == StateOpen && now.Sub(b.openedAt) >= b.settings.OpenTimeout {
+		b.setState(StateHalfOpen, now)
+	}
+}
+
+func (b *Breaker) setState(state State, now time.Time) {
+	b.state = state
+	b.failures = 0
+	b.probes = 0
+	b.successes = 0
+	if state == StateOpen {
+		b.openedAt = now
+	}
+	metrics.SetCircuitBreakerState(b.name, int(state))
+}
+
+// Registry circuit breakers keyed by provider
+type Registry struct {
+	settings Settings
+
+	mu       sync.Mutex
+	breakers map[string]*Breaker
+}
+
+func NewRegistry(settings Settings) *Registry {
+	return &Registry{
+		settings: settings,
+		breakers: make(map[string]*Breaker),
+	}
+}
+
+// Get get or create breaker of the provider
+func (r *Registry) Get(name string) *Breaker {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	b, ok := r.breakers[name]
+	if !ok {
+		b = New(name, r.settings)
+		r.breakers[name] = b
+	}
+	return b
+}
+
+// States current state of all breakers
+func (r *Registry) States() map[string]string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	states := make(map[string]string, len(r.breakers))
+	for name, b := range r.breakers {
+		states[name] = b.State().String()
+	}
+	return states
+}
@@ -0,0 +1,63 @@
+package breaker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBreaker(t *testing.T) {
+	b := New("test", Settings{
+		FailureThreshold: 2,
+		OpenTimeout:      50 * time.Millisecond,
+		HalfOpenMaxCalls: 1,
+	})
+	assert.Equal(t, StateClosed, b.State())
+
+	// 连续失败达到阈值后打开
+	for i := 0; i < 2; i++ {
+		require.NoError(t, b.Allow())
+		b.Record(false)
+	}
+	assert.Equal(t, StateOpen, b.State())
+	assert.ErrorIs(t, b.Allow(), ErrOpen)
+	assert.Greater(t, b.RetryAfter(), time.Duration(0))
+
+	// 超时后进入半开，只放行一个探测请求
+	time.Sleep(60 * time.Millisecond)
+	assert.Equal(t, StateHalfOpen, b.State())
+	require.NoError(t, b.Allow())
+	assert.ErrorIs(t, b.Allow(), ErrOpen)
+
+	// 探测失败重新打开
+	b.Record(false)
+	assert.Equal(t, StateOpen, b.State())
+
+	// 探测成功后关闭
+	time.Sleep(60 * time.Millisecond)
+	require.NoError(t, b.Allow())
+	b.Record(true)
+	assert.Equal(t, StateClosed, b.State())
+}
+
+func TestBreakerResetOnSuccess(t *testing.T) {
+	b := New("test", Settings{FailureThreshold: 2})
+
+	require.NoError(t, b.Allow())
+	b.Record(false)
+	require.NoError(t, b.Allow())
+	b.Record(true)
+	require.NoError(t, b.Allow())
+	b.Record(false)
+
+	// 失败不连续，不会打开
+	assert.Equal(t, StateClosed, b.State())
+}
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry(Settings{})
+	assert.Same(t, r.Get("openai"), r.Get("openai"))
+	assert.Equal(t, map[string]string{"openai": "closed"}, r.States())
+}
@@ -0,0 +1,183 @@
+package idempotency
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// defaultLockTTL reservation time when the requests are not bounded by a timeout
+const defaultLockTTL = 10 * time.Minute
+
+// ErrNotReserved the key is not reserved by the request anymore, e.g. the reservation expired
+// and another request took the key
+var ErrNotReserved = errors.New("idempotency key is not reserved by the request")
+
+// completeScript store the response only if the key is still reserved by the request
+// KEYS[1] key
+// ARGV[1] reservation token, ARGV[2] record, ARGV[3] ttl in milliseconds
+var completeScript = redis.NewScript(`
+local data = redis.call('GET', KEYS[1])
+if not data then
+	return 0
+end
+local rec = cjson.decode(data)
+if rec.done or rec.token ~= ARGV[1] then
+	return 0
+end
+redis.call('SET', KEYS[1], ARGV[2], 'PX', ARGV[3])
+return 1
+`)
+
+// releaseScript remove the key only if it is still reserved by the request
+// KEYS[1] key
+// ARGV[1] reservation token
+var releaseScript = redis.NewScript(`
+local data = redis.call('GET', KEYS[1])
+if not data then
+	return 0
+end
+local rec = cjson.decode(data)
+if rec.done or rec.token ~= ARGV[1] then
+	return 0
+end
+redis.call('DEL', KEYS[1])
+return 1
+`)
+
+// Record record of an idempotency key
+type Record struct {
+	Fingerprint string    `json:"fingerprint"`
+	Token       string    `json:"token,omitempty"` // reservation token of the request owning the key
+	Done        bool      `json:"done"`
+	Status      int       `json:"status,omitempty"`
+	ContentType string    `json:"content_type,omitempty"`
+	Body        []byte    `json:"body,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Store redis store of idempotency keys and the responses of their first requests
+type Store struct {
+	client  *redis.Client
+	prefix  string
+	ttl     time.Duration
+	lockTTL time.Duration
+}
+
+// NewStore create store, responses are kept for ttl. A key is reserved by a request in progress
+// for lockTTL, which must outlast the requests so a key isn't taken over while its first request
+// is still running, and is short enough that a crashed request doesn't hold the key for the whole
+// retention window. lockTTL <= 0 uses 10 minutes.
+func NewStore(client *redis.Client, prefix string, ttl, lockTTL time.Duration) *Store {
+	if lockTTL <= 0 {
+		lockTTL = defaultLockTTL
+	}
+	return &Store{
+		client:  client,
+		prefix:  prefix,
+		ttl:     ttl,
+		lockTTL: lockTTL,
+	}
+}
+
+// Fingerprint hash of a request, a key reused with a different fingerprint is rejected
+func Fingerprint(method, path string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(method + " " + path + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (s *Store) key(key string) string {
+	return s.prefix + ":" + key
+}
+
+// Begin reserve the key for a request and return the reservation token, which is required to
+// complete or release the key. If the key is reserved or completed already its record is
+// returned instead.
+func (s *Store) Begin(ctx context.Context, key, fingerprint string) (string, *Record, error) {
+	token, err := newToken()
+	if err != nil {
+		return "", nil, err
+	}
+	data, err := json.Marshal(&Record{Fingerprint: fingerprint, Token: token, CreatedAt: time.Now()})
+	if err != nil {
+		return "", nil, err
+	}
+
+	for {
+		ok, err := s.client.SetNX(ctx, s.key(key), data, s.lockTTL).Result()
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to reserve idempotency key, error: %w", err)
+		}
+		if ok {
+			return token, nil, nil
+		}
+
+		existing, err := s.client.Get(ctx, s.key(key)).Bytes()
+		if err == redis.Nil {
+			// expired in between, try again
+			continue
+		}
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to get idempotency key, error: %w", err)
+		}
+
+		var rec Record
+		if err := json.Unmarshal(existing, &rec); err != nil {
+			return "", nil, fmt.Errorf("failed to unmarshal idempotency record, error: %w", err)
+		}
+		return "", &rec, nil
+	}
+}
+
+// Complete store the response of the request reserving the key with token for the retention
+// window, ErrNotReserved is returned if the key is not reserved by the request anymore
+func (s *Store) Complete(ctx context.Context, key, token string, rec *Record) error {
+	rec.Token = token
+	rec.Done = true
+	if rec.CreatedAt.IsZero() {
+		rec.CreatedAt = time.Now()
+	}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	ok, err := completeScript.Run(ctx, s.client, []string{s.key(key)}, token, data, s.ttl.Milliseconds()).Int()
+	if err != nil {
+		return fmt.Errorf("failed to store idempotency record, error: %w", err)
+	}
+	if ok == 0 {
+		return ErrNotReserved
+	}
+	return nil
+}
+
+// Release remove the reservation of the key with token, e.g. the request failed and may be
+// retried. ErrNotReserved is returned if the key is not reserved by the request anymore.
+func (s *Store) Release(ctx context.Context, key, token string) error {
+	ok, err := releaseScript.Run(ctx, s.client, []string{s.key(key)}, token).Int()
+	if err != nil {
+		return fmt.Errorf("failed to release idempotency key, error: %w", err)
+	}
+	if ok == 0 {
+		return ErrNotReserved
+	}
+	return nil
+}
+
+// newToken random reservation token
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate idempotency token, error: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
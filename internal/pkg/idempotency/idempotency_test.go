@@ -0,0 +1,99 @@
+package idempotency
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore(t *testing.T) {
+	mr, err := miniredis.Run()
+	require.NoError(t, err)
+	defer mr.Close()
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+
+	ctx := context.Background()
+	store := NewStore(client, "idempotency", time.Hour, time.Minute)
+	fingerprint := Fingerprint(http.MethodPost, "/tasks", []byte(`{}`))
+
+	// 预留 key 的时间为 lockTTL
+	token, rec, err := store.Begin(ctx, "k1", fingerprint)
+	require.NoError(t, err)
+	assert.Nil(t, rec)
+	assert.NotEmpty(t, token)
+	assert.Equal(t, time.Minute, mr.TTL("idempotency:k1"))
+
+	// 处理中的请求
+	other, rec, err := store.Begin(ctx, "k1", fingerprint)
+	require.NoError(t, err)
+	assert.Empty(t, other)
+	require.NotNil(t, rec)
+	assert.False(t, rec.Done)
+
+	// 其他请求不能完成或释放 key
+	assert.ErrorIs(t, store.Complete(ctx, "k1", "other", &Record{Fingerprint: fingerprint, Status: http.StatusCreated}), ErrNotReserved)
+	assert.ErrorIs(t, store.Release(ctx, "k1", "other"), ErrNotReserved)
+
+	// 响应保存 ttl
+	require.NoError(t, store.Complete(ctx, "k1", token, &Record{Fingerprint: fingerprint, Status: http.StatusCreated, Body: []byte(`{"id":1}`)}))
+	assert.Equal(t, time.Hour, mr.TTL("idempotency:k1"))
+	_, rec, err = store.Begin(ctx, "k1", fingerprint)
+	require.NoError(t, err)
+	require.NotNil(t, rec)
+	assert.True(t, rec.Done)
+	assert.Equal(t, http.StatusCreated, rec.Status)
+	assert.Equal(t, []byte(`{"id":1}`), rec.Body)
+
+	// 已完成的 key 不能再次完成或释放
+	assert.ErrorIs(t, store.Complete(ctx, "k1", token, &Record{Fingerprint: fingerprint, Status: http.StatusAccepted}), ErrNotReserved)
+	assert.ErrorIs(t, store.Release(ctx, "k1", token), ErrNotReserved)
+
+	// 释放后可以重试
+	token, _, err = store.Begin(ctx, "k2", fingerprint)
+	require.NoError(t, err)
+	require.NoError(t, store.Release(ctx, "k2", token))
+	assert.False(t, mr.Exists("idempotency:k2"))
+	assert.ErrorIs(t, store.Release(ctx, "k2", token), ErrNotReserved)
+}
+
+// TestStoreReservationExpired 测试预留过期后 key 被其他请求占用，首次请求不能覆盖或删除
+func TestStoreReservationExpired(t *testing.T) {
+	mr, err := miniredis.Run()
+	require.NoError(t, err)
+	defer mr.Close()
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+
+	ctx := context.Background()
+	store := NewStore(client, "idempotency", time.Hour, time.Minute)
+	fingerprint := Fingerprint(http.MethodPost, "/tasks", []byte(`{}`))
+
+	first, _, err := store.Begin(ctx, "k1", fingerprint)
+	require.NoError(t, err)
+	mr.FastForward(time.Minute)
+	second, rec, err := store.Begin(ctx, "k1", fingerprint)
+	require.NoError(t, err)
+	assert.Nil(t, rec)
+	assert.NotEqual(t, first, second)
+
+	assert.ErrorIs(t, store.Complete(ctx, "k1", first, &Record{Fingerprint: fingerprint, Status: http.StatusCreated}), ErrNotReserved)
+	assert.ErrorIs(t, store.Release(ctx, "k1", first), ErrNotReserved)
+
+	// 第二个请求仍持有 key
+	_, rec, err = store.Begin(ctx, "k1", fingerprint)
+	require.NoError(t, err)
+	require.NotNil(t, rec)
+	assert.False(t, rec.Done)
+	require.NoError(t, store.Complete(ctx, "k1", second, &Record{Fingerprint: fingerprint, Status: http.StatusAccepted}))
+}
+
+func TestNewStoreDefaultLockTTL(t *testing.T) {
+	assert.Equal(t, defaultLockTTL, NewStore(nil, "idempotency", time.Hour, 0).lockTTL)
+}
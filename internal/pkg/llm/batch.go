@@ -0,0 +1,258 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/xmualex2023/i18n-translation/internal/pkg/metrics"
+)
+
+// batchSchema response schema of batch translation, every segment is returned with its id
+var batchSchema = json.RawMessage(`{
+	"type": "object",
+	"properties": {
+		"translations": {
+			"type": "array",
+			"items": {
+				"type": "object",
+				"properties": {
+					"id": {"type": "string"},
+					"text": {"type": "string"}
+				},
+				"required": ["id", "text"],
+				"additionalProperties": false
+			}
+		}
+	},
+	"required": ["translations"],
+	"additionalProperties": false
+}`)
+
+// Segment translation segment
+type Segment struct {
+	ID   string `json:"id"`
+	Text string `json:"text"`
+}
+
+// BatchResult translation result of segments
+type BatchResult struct {
+	Translations map[string]string // segment id -> translated text
+	Failed       map[string]string // segment id -> error message
+	Cached       int               // 命中缓存的片段数
+	Model        string
+	Usage        Usage
+}
+
+// Progress translation progress of segments, Translated includes the Cached ones
+type Progress struct {
+	Total      int
+	Translated int
+	Cached     int
+	Failed     int
+}
+
+// ProgressFunc called after the cache lookup and after each batch
+type ProgressFunc func(Progress)
+
+func (r *BatchResult) progress(total int) Progress {
+	return Progress{
+		Total:      total,
+		Translated: len(r.Translations),
+		Cached:     r.Cached,
+		Failed:     len(r.Failed),
+	}
+}
+
+type batchPayload struct {
+	Translations []Segment `json:"translations"`
+}
+
+// TranslateSegments translate segments in batches, each batch is one structured output request.
+// Missing or malformed items of a batch are retried individually, segments that still fail are
+// reported in BatchResult.Failed. An error is returned only if the translation can not go on,
+// e.g. the context is done or the circuit breaker is open, together with the partial result,
+// whose Usage covers the requests billed so far. onProgress may be nil.
+func (c *Client) TranslateSegments(ctx context.Context, segments []Segment, sourceLang, targetLang string, onProgress ProgressFunc) (*BatchResult, error) {
+	result := &BatchResult{
+		Translations: make(map[string]string, len(segments)),
+		Failed:       make(map[string]string),
+		Model:        c.model,
+	}
+
+	// lookup cache first
+	pending := make([]Segment, 0, len(segments))
+	for _, seg := range segments {
+		if text, ok := c.getCache(ctx, seg.Text, sourceLang, targetLang); ok {
+			result.Translations[seg.ID] = text
+			result.Cached++
+			continue
+		}
+		pending = append(pending, seg)
+	}
+	if onProgress != nil {
+		onProgress(result.progress(len(segments)))
+	}
+
+	for start := 0; start < len(pending); start += c.batchSize {
+		end := start + c.batchSize
+		if end > len(pending) {
+			end = len(pending)
+		}
+		if err := c.translateBatch(ctx, pending[start:end], sourceLang, targetLang, result); err != nil {
+			return result, err
+		}
+		if onProgress != nil {
+			onProgress(result.progress(len(segments)))
+		}
+	}
+
+	return result, nil
+}
+
+// translateBatch translate one batch and fill in result
+func (c *Client) translateBatch(ctx context.Context, batch []Segment, sourceLang, targetLang string, result *BatchResult) error {
+	translations, usage, err := c.requestBatch(ctx, batch, sourceLang, targetLang)
+	// invalid responses are billed as well
+	addUsage(&result.Usage, usage)
+	if err != nil {
+		if !isRecoverable(ctx, err) {
+			return err
+		}
+		log.Printf("batch translation failed, retry %d segments individually, error: %v", len(batch), err)
+	}
+
+	for _, seg := range batch {
+		if text, ok := translations[seg.ID]; ok {
+			result.Translations[seg.ID] = text
+			c.setCache(ctx, seg.Text, sourceLang, targetLang, text)
+			continue
+		}
+
+		// missing or malformed, retry individually
+		single, err := c.translate(ctx, seg.Text, sourceLang, targetLang)
+		if err != nil {
+			if !isRecoverable(ctx, err) {
+				return err
+			}
+			result.Failed[seg.ID] = err.Error()
+			continue
+		}
+		addUsage(&result.Usage, single.Usage)
+		result.Translations[seg.ID] = single.Content
+		c.setCache(ctx, seg.Text, sourceLang, targetLang, single.Content)
+	}
+	return nil
+}
+
+// requestBatch send batch request, returns the valid translations keyed by segment id.
+// Items with unknown or duplicated ids and empty texts are dropped.
+func (c *Client) requestBatch(ctx context.Context, batch []Segment, sourceLang, targetLang string) (map[string]string, Usage, error) {
+	input, err := json.Marshal(batchPayload{Translations: batch})
+	if err != nil {
+		return nil, Usage{}, err
+	}
+
+	req := TranslationRequest{
+		Model: c.model,
+		Messages: []Message{
+			{
+				Role: "system",
+				Content: "你是一个专业的翻译助手。用户会提供一个 JSON，translations 数组中每一项包含片段 id 和待翻译的 text。" +
+					"请逐项翻译 text，保持 id 不变，每个 id 必须且只能返回一次，不要添加任何额外的解释。",
+			},
+			{
+				Role:    "user",
+				Content: fmt.Sprintf("将以下片段从%s翻译成%s：\n\n%s", sourceLang, targetLang, input),
+			},
+		},
+		ResponseFormat: &ResponseFormat{
+			Type: "json_schema",
+			JSONSchema: &JSONSchema{
+				Name:   "translations",
+				Strict: true,
+				Schema: batchSchema,
+			},
+		},
+	}
+
+	resp, err := c.chat(ctx, &req)
+	if err != nil {
+		return nil, Usage{}, err
+	}
+	if len(resp.Choices) == 0 {
+		return nil, resp.Usage, ErrInvalidResponse
+	}
+
+	var output batchPayload
+	if err := json.Unmarshal([]byte(resp.Choices[0].Message.Content), &output); err != nil {
+		return nil, resp.Usage, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+
+	expected := make(map[string]bool, len(batch))
+	for _, seg := range batch {
+		expected[seg.ID] = true
+	}
+
+	translations := make(map[string]string, len(output.Translations))
+	duplicated := make(map[string]bool)
+	for _, item := range output.Translations {
+		if !expected[item.ID] || strings.TrimSpace(item.Text) == "" {
+			continue
+		}
+		if _, ok := translations[item.ID]; ok {
+			duplicated[item.ID] = true
+			continue
+		}
+		translations[item.ID] = item.Text
+	}
+	for id := range duplicated {
+		delete(translations, id)
+	}
+
+	return translations, resp.Usage, nil
+}
+
+func (c *Client) getCache(ctx context.Context, text, sourceLang, targetLang string) (string, bool) {
+	if c.cache == nil {
+		return "", false
+	}
+
+	key := CacheKey(c.provider, c.model, promptVersion, sourceLang, targetLang, text)
+	cached, ok, err := c.cache.Get(ctx, key)
+	if err != nil {
+		log.Printf("failed to get translation cache, error: %v", err)
+	}
+	if ok {
+		metrics.IncLLMCache("hit")
+		return cached, true
+	}
+	metrics.IncLLMCache("miss")
+	return "", false
+}
+
+func (c *Client) setCache(ctx context.Context, text, sourceLang, targetLang, translated string) {
+	if c.cache == nil {
+		return
+	}
+
+	key := CacheKey(c.provider, c.model, promptVersion, sourceLang, targetLang, text)
+	if err := c.cache.Set(ctx, key, translated); err != nil {
+		log.Printf("failed to set translation cache, error: %v", err)
+	}
+}
+
+// isRecoverable whether the error only affects the current request,
+// translation can go on with other requests
+func isRecoverable(ctx context.Context, err error) bool {
+	return ctx.Err() == nil && !errors.Is(err, ErrCircuitOpen)
+}
+
+func addUsage(total *Usage, usage Usage) {
+	total.PromptTokens += usage.PromptTokens
+	total.CompletionTokens += usage.CompletionTokens
+	total.TotalTokens += usage.TotalTokens
+}
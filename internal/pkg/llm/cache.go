@@ -0,0 +1,61 @@
+package llm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Cache translation result cache
+type Cache interface {
+	Get(ctx context.Context, key string) (string, bool, error)
+	Set(ctx context.Context, key, value string) error
+}
+
+// RedisCache redis backed translation cache
+type RedisCache struct {
+	client    *redis.Client
+	keyPrefix string
+	ttl       time.Duration
+}
+
+func NewRedisCache(client *redis.Client, keyPrefix string, ttl time.Duration) *RedisCache {
+	return &RedisCache{
+		client:    client,
+		keyPrefix: keyPrefix,
+		ttl:       ttl,
+	}
+}
+
+func (c *RedisCache) cacheKey(key string) string {
+	return fmt.Sprintf("%s:%s", c.keyPrefix, key)
+}
+
+func (c *RedisCache) Get(ctx context.Context, key string) (string, bool, error) {
+	value, err := c.client.Get(ctx, c.cacheKey(key)).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+	return value, true, nil
+}
+
+func (c *RedisCache) Set(ctx context.Context, key, value string) error {
+	return c.client.Set(ctx, c.cacheKey(key), value, c.ttl).Err()
+}
+
+// CacheKey 根据 provider、模型、prompt 版本、语言对和原文计算缓存 key
+func CacheKey(provider, model, promptVersion, sourceLang, targetLang, text string) string {
+	h := sha256.New()
+	h.Write([]byte(strings.Join([]string{provider, model, promptVersion, sourceLang, targetLang}, "\x00")))
+	h.Write([]byte{0})
+	h.Write([]byte(text))
+	return hex.EncodeToString(h.Sum(nil))
+}
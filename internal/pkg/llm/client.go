@@ -4,26 +4,109 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"time"
+
+	"github.com/xmualex2023/i18n-translation/internal/pkg/breaker"
+	"github.com/xmualex2023/i18n-translation/internal/pkg/metrics"
+	"github.com/xmualex2023/i18n-translation/internal/pkg/util"
 )
 
-var (
-	ErrInvalidResponse = errors.New("invalid API response")
-	ErrAPIError        = errors.New("failed to call API")
+const (
+	defaultProvider = "openai"
+	defaultModel    = "gpt-3.5-turbo"
+
+	defaultBatchSize = 50
+
+	// latencyAlpha weight of new samples in the latency moving average
+	latencyAlpha = 0.2
+
+	// promptVersion 修改 prompt 时需要同步修改，避免命中旧的缓存
+	promptVersion = "v1"
 )
 
 type Client struct {
-	apiKey   string
-	endpoint string
-	client   *http.Client
+	apiKey    string
+	endpoint  string
+	provider  string
+	model     string
+	batchSize int
+	cache     Cache
+	retry     RetryPolicy
+	breaker   *breaker.Breaker
+	client    *http.Client
+	latency   *util.EWMA // seconds of successful requests
+}
+
+// Option client option
+type Option func(*Client)
+
+// WithProvider set provider name, used in cache key
+func WithProvider(provider string) Option {
+	return func(c *Client) {
+		if provider != "" {
+			c.provider = provider
+		}
+	}
+}
+
+// WithModel set model name
+func WithModel(model string) Option {
+	return func(c *Client) {
+		if model != "" {
+			c.model = model
+		}
+	}
+}
+
+// WithBatchSize set max segments per batch request
+func WithBatchSize(size int) Option {
+	return func(c *Client) {
+		if size > 0 {
+			c.batchSize = size
+		}
+	}
+}
+
+// WithRetryPolicy set retry policy of API calls
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(c *Client) {
+		c.retry = policy
+	}
+}
+
+// WithBreaker set circuit breaker of the provider
+func WithBreaker(b *breaker.Breaker) Option {
+	return func(c *Client) {
+		c.breaker = b
+	}
+}
+
+// WithCache set translation result cache
+func WithCache(cache Cache) Option {
+	return func(c *Client) {
+		c.cache = cache
+	}
 }
 
 type TranslationRequest struct {
-	Model    string    `json:"model"`
-	Messages []Message `json:"messages"`
+	Model          string          `json:"model"`
+	Messages       []Message       `json:"messages"`
+	ResponseFormat *ResponseFormat `json:"response_format,omitempty"`
+}
+
+// ResponseFormat structured output format
+type ResponseFormat struct {
+	Type       string      `json:"type"`
+	JSONSchema *JSONSchema `json:"json_schema,omitempty"`
+}
+
+type JSONSchema struct {
+	Name   string          `json:"name"`
+	Strict bool            `json:"strict"`
+	Schema json.RawMessage `json:"schema"`
 }
 
 type Message struct {
@@ -50,22 +133,53 @@ type Usage struct {
 	TotalTokens      int `json:"total_tokens"`
 }
 
-func NewClient(apiKey, endpoint string) *Client {
-	return &Client{
-		apiKey:   apiKey,
-		endpoint: endpoint,
+// Result translation result
+type Result struct {
+	Content string
+	Model   string
+	Usage   Usage
+	Cached  bool // 命中缓存时 Usage 为空
+}
+
+func NewClient(apiKey, endpoint string, opts ...Option) *Client {
+	c := &Client{
+		apiKey:    apiKey,
+		endpoint:  endpoint,
+		provider:  defaultProvider,
+		model:     defaultModel,
+		batchSize: defaultBatchSize,
+		retry:     defaultRetryPolicy,
+		latency:   util.NewEWMA(latencyAlpha),
 		client: &http.Client{
 			Timeout: 30 * time.Second,
 		},
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Translate 执行翻译，命中缓存时不会调用 API
+func (c *Client) Translate(ctx context.Context, text, sourceLang, targetLang string) (*Result, error) {
+	if cached, ok := c.getCache(ctx, text, sourceLang, targetLang); ok {
+		return &Result{Content: cached, Model: c.model, Cached: true}, nil
+	}
+
+	result, err := c.translate(ctx, text, sourceLang, targetLang)
+	if err != nil {
+		return nil, err
+	}
+
+	c.setCache(ctx, text, sourceLang, targetLang, result.Content)
+	return result, nil
 }
 
-// Translate 执行翻译
-func (c *Client) Translate(ctx context.Context, text, sourceLang, targetLang string) (string, error) {
+func (c *Client) translate(ctx context.Context, text, sourceLang, targetLang string) (*Result, error) {
 	prompt := fmt.Sprintf("将以下%s文本翻译成%s：\n\n%s", sourceLang, targetLang, text)
 
 	req := TranslationRequest{
-		Model: "gpt-3.5-turbo",
+		Model: c.model,
 		Messages: []Message{
 			{
 				Role:    "system",
@@ -78,14 +192,97 @@ func (c *Client) Translate(ctx context.Context, text, sourceLang, targetLang str
 		},
 	}
 
+	result, err := c.chat(ctx, &req)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(result.Choices) == 0 {
+		return nil, ErrInvalidResponse
+	}
+
+	return &Result{
+		Content: result.Choices[0].Message.Content,
+		Model:   c.model,
+		Usage:   result.Usage,
+	}, nil
+}
+
+// chat call chat completions API, retryable errors are retried with backoff
+func (c *Client) chat(ctx context.Context, req *TranslationRequest) (*TranslationResponse, error) {
 	reqBody, err := json.Marshal(req)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.endpoint+"/v1/chat/completions", bytes.NewBuffer(reqBody))
+	for attempt := 0; ; attempt++ {
+		if c.breaker != nil {
+			if err := c.breaker.Allow(); err != nil {
+				return nil, fmt.Errorf("%w, provider: %s", ErrCircuitOpen, c.provider)
+			}
+		}
+
+		start := time.Now()
+		result, err := c.send(ctx, reqBody)
+		c.record(ctx, err)
+		if err == nil {
+			c.observeLatency(time.Since(start))
+			return result, nil
+		}
+		if !IsRetryable(err) {
+			return nil, err
+		}
+		if attempt >= c.retry.MaxRetries {
+			return nil, fmt.Errorf("%w, retries: %d", err, attempt)
+		}
+
+		delay, ok := c.retry.backoff(attempt, err)
+		if deadline, has := ctx.Deadline(); has && time.Until(deadline) < delay {
+			// the retry can't be sent in time
+			ok = false
+		}
+		if !ok {
+			return nil, fmt.Errorf("%w, retries: %d, retry after: %v", err, attempt, delay)
+		}
+		log.Printf("llm call failed, retry in %v, attempt: %d, error: %v", delay, attempt+1, err)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, fmt.Errorf("%w, last error: %v", ctx.Err(), err)
+		case <-timer.C:
+		}
+	}
+}
+
+func (c *Client) observeLatency(d time.Duration) {
+	c.latency.Add(d.Seconds())
+	metrics.ObserveLLMLatency(c.provider, d)
+}
+
+// Latency moving average latency of successful requests, 0 before the first one
+func (c *Client) Latency() time.Duration {
+	return time.Duration(c.latency.Value() * float64(time.Second))
+}
+
+// record record call result to circuit breaker, only retryable errors count as failures
+func (c *Client) record(ctx context.Context, err error) {
+	if c.breaker == nil {
+		return
+	}
+	if err != nil && ctx.Err() != nil {
+		c.breaker.Cancel()
+		return
+	}
+	c.breaker.Record(!IsRetryable(err))
+}
+
+// send send a single chat completions request
+func (c *Client) send(ctx context.Context, reqBody []byte) (*TranslationResponse, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.endpoint+"/v1/chat/completions", bytes.NewReader(reqBody))
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	httpReq.Header.Set("Content-Type", "application/json")
@@ -93,22 +290,18 @@ func (c *Client) Translate(ctx context.Context, text, sourceLang, targetLang str
 
 	resp, err := c.client.Do(httpReq)
 	if err != nil {
-		return "", err
+		return nil, newNetworkError(ctx, err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("%w: %d", ErrAPIError, resp.StatusCode)
+		return nil, newStatusError(resp)
 	}
 
 	var result TranslationResponse
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return "", err
-	}
-
-	if len(result.Choices) == 0 {
-		return "", ErrInvalidResponse
+		return nil, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
 	}
 
-	return result.Choices[0].Message.Content, nil
+	return &result, nil
 }
@@ -0,0 +1,196 @@
+package llm_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmualex2023/i18n-translation/internal/pkg/llm"
+	"github.com/xmualex2023/i18n-translation/internal/pkg/llm/llmtest"
+)
+
+var fastRetry = llm.WithRetryPolicy(llm.RetryPolicy{
+	MaxRetries: 2,
+	BaseDelay:  time.Millisecond,
+	MaxDelay:   5 * time.Millisecond,
+})
+
+// memoryCache 用于测试的缓存实现
+type memoryCache map[string]string
+
+func (c memoryCache) Get(ctx context.Context, key string) (string, bool, error) {
+	v, ok := c[key]
+	return v, ok, nil
+}
+
+func (c memoryCache) Set(ctx context.Context, key, value string) error {
+	c[key] = value
+	return nil
+}
+
+func TestTranslate(t *testing.T) {
+	srv := llmtest.NewServer(llmtest.Options{})
+	defer srv.Close()
+
+	client := llm.NewClient("test-key", srv.URL)
+	result, err := client.Translate(context.Background(), "Hello", "en", "zh")
+	require.NoError(t, err)
+
+	assert.Equal(t, llmtest.Translate("Hello", "zh"), result.Content)
+	assert.False(t, result.Cached)
+	assert.Greater(t, result.Usage.PromptTokens, 0)
+	assert.Greater(t, result.Usage.CompletionTokens, 0)
+}
+
+func TestTranslateCache(t *testing.T) {
+	srv := llmtest.NewServer(llmtest.Options{})
+	defer srv.Close()
+
+	client := llm.NewClient("test-key", srv.URL, llm.WithCache(memoryCache{}))
+	for i := 0; i < 3; i++ {
+		result, err := client.Translate(context.Background(), "Hello", "en", "zh")
+		require.NoError(t, err)
+		assert.Equal(t, i > 0, result.Cached)
+	}
+
+	// 命中缓存不会调用 API
+	assert.Equal(t, 1, srv.Requests())
+}
+
+func TestTranslateRetry(t *testing.T) {
+	tests := []struct {
+		name  string
+		fault llmtest.Fault
+	}{
+		{"RateLimit", llmtest.FaultRateLimit},
+		{"ServerError", llmtest.FaultServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := llmtest.NewServer(llmtest.Options{Fault: tt.fault, FaultFirst: 2})
+			defer srv.Close()
+
+			client := llm.NewClient("test-key", srv.URL, fastRetry)
+			result, err := client.Translate(context.Background(), "Hello", "en", "zh")
+			require.NoError(t, err)
+			assert.Equal(t, llmtest.Translate("Hello", "zh"), result.Content)
+			assert.Equal(t, 3, srv.Requests())
+		})
+	}
+}
+
+func TestTranslateRetryExhausted(t *testing.T) {
+	srv := llmtest.NewServer(llmtest.Options{Fault: llmtest.FaultRateLimit, FaultEvery: 1})
+	defer srv.Close()
+
+	client := llm.NewClient("test-key", srv.URL, fastRetry)
+	_, err := client.Translate(context.Background(), "Hello", "en", "zh")
+	require.Error(t, err)
+	assert.ErrorIs(t, err, llm.ErrAPIError)
+	assert.ErrorIs(t, err, llm.ErrRateLimited)
+	assert.True(t, llm.IsRetryable(err))
+	assert.Equal(t, 3, srv.Requests())
+}
+
+func TestTranslateRetryAfterTooLong(t *testing.T) {
+	srv := llmtest.NewServer(llmtest.Options{Fault: llmtest.FaultRateLimit, FaultEvery: 1, RetryAfter: 3600})
+	defer srv.Close()
+
+	// Retry-After 超过 MaxDelay 时不等待，直接返回可重试的错误
+	client := llm.NewClient("test-key", srv.URL, fastRetry)
+	start := time.Now()
+	_, err := client.Translate(context.Background(), "Hello", "en", "zh")
+	assert.True(t, llm.IsRetryable(err))
+	assert.Equal(t, 1, srv.Requests())
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestTranslateMalformed(t *testing.T) {
+	srv := llmtest.NewServer(llmtest.Options{Fault: llmtest.FaultMalformed, FaultEvery: 1})
+	defer srv.Close()
+
+	client := llm.NewClient("test-key", srv.URL, fastRetry)
+	_, err := client.Translate(context.Background(), "Hello", "en", "zh")
+	assert.ErrorIs(t, err, llm.ErrInvalidResponse)
+	assert.Equal(t, 1, srv.Requests())
+}
+
+func TestTranslateSegments(t *testing.T) {
+	srv := llmtest.NewServer(llmtest.Options{})
+	defer srv.Close()
+
+	segments := []llm.Segment{
+		{ID: "0", Text: "Start"},
+		{ID: "1", Text: "Pause"},
+		{ID: "2", Text: "Game Over"},
+	}
+
+	client := llm.NewClient("test-key", srv.URL, llm.WithBatchSize(2))
+	var progress []llm.Progress
+	result, err := client.TranslateSegments(context.Background(), segments, "en", "zh", func(p llm.Progress) {
+		progress = append(progress, p)
+	})
+	require.NoError(t, err)
+
+	// 查询缓存后和每个批次完成后各报告一次进度
+	assert.Equal(t, []llm.Progress{
+		{Total: 3},
+		{Total: 3, Translated: 2},
+		{Total: 3, Translated: 3},
+	}, progress)
+
+	require.Len(t, result.Translations, len(segments))
+	for _, seg := range segments {
+		assert.Equal(t, llmtest.Translate(seg.Text, "zh"), result.Translations[seg.ID])
+	}
+	assert.Empty(t, result.Failed)
+	assert.Equal(t, 2, srv.Requests())
+}
+
+func TestTranslateSegmentsPartialUsage(t *testing.T) {
+	srv := llmtest.NewServer(llmtest.Options{})
+	defer srv.Close()
+
+	segments := []llm.Segment{
+		{ID: "0", Text: "Start"},
+		{ID: "1", Text: "Pause"},
+	}
+
+	// 第一个批次完成后取消，返回已计费的用量
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := llm.NewClient("test-key", srv.URL, llm.WithBatchSize(1))
+	result, err := client.TranslateSegments(ctx, segments, "en", "zh", func(p llm.Progress) {
+		if p.Translated == 1 {
+			cancel()
+		}
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	require.NotNil(t, result)
+	assert.Len(t, result.Translations, 1)
+	assert.Greater(t, result.Usage.PromptTokens, 0)
+	assert.Greater(t, result.Usage.CompletionTokens, 0)
+	assert.Equal(t, 1, srv.Requests())
+}
+
+func TestTranslateSegmentsFallback(t *testing.T) {
+	// 批量请求返回无法解析的 JSON，逐个片段重试
+	srv := llmtest.NewServer(llmtest.Options{Fault: llmtest.FaultMalformed, FaultFirst: 1})
+	defer srv.Close()
+
+	segments := []llm.Segment{
+		{ID: "a", Text: "Start"},
+		{ID: "b", Text: "Pause"},
+	}
+
+	client := llm.NewClient("test-key", srv.URL, fastRetry)
+	result, err := client.TranslateSegments(context.Background(), segments, "en", "zh", nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, llmtest.Translate("Start", "zh"), result.Translations["a"])
+	assert.Equal(t, llmtest.Translate("Pause", "zh"), result.Translations["b"])
+	assert.Equal(t, 3, srv.Requests())
+}
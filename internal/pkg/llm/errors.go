@@ -0,0 +1,131 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrInvalidResponse = errors.New("invalid API response")
+	ErrAPIError        = errors.New("failed to call API")
+
+	// retryable errors
+	ErrRateLimited = errors.New("rate limited")
+	ErrUnavailable = errors.New("service unavailable")
+
+	// non-retryable errors
+	ErrUnauthorized = errors.New("authentication failed")
+	ErrBadRequest   = errors.New("request rejected")
+
+	// ErrCircuitOpen provider circuit breaker is open, call is rejected without sending
+	ErrCircuitOpen = errors.New("translation provider circuit breaker is open")
+)
+
+// APIError classified error of an API call, matches ErrAPIError and one of the kind errors
+type APIError struct {
+	StatusCode int           // 0 表示网络错误
+	Message    string        // 上游返回的错误信息
+	RetryAfter time.Duration // Retry-After 响应头
+	kind       error
+	err        error
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("%v: %v", ErrAPIError, e.kind)
+	if e.StatusCode != 0 {
+		msg = fmt.Sprintf("%s (status %d)", msg, e.StatusCode)
+	}
+	if e.Message != "" {
+		msg = fmt.Sprintf("%s: %s", msg, e.Message)
+	}
+	return msg
+}
+
+func (e *APIError) Unwrap() []error {
+	errs := []error{ErrAPIError, e.kind}
+	if e.err != nil {
+		errs = append(errs, e.err)
+	}
+	return errs
+}
+
+// Retryable whether the call can be retried
+func (e *APIError) Retryable() bool {
+	return e.kind == ErrRateLimited || e.kind == ErrUnavailable
+}
+
+// IsRetryable whether err is a retryable API error
+func IsRetryable(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.Retryable()
+}
+
+// newStatusError classify the non-200 response
+func newStatusError(resp *http.Response) *APIError {
+	e := &APIError{
+		StatusCode: resp.StatusCode,
+		Message:    readErrorMessage(resp.Body),
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		e.kind = ErrRateLimited
+		e.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"))
+	case resp.StatusCode >= http.StatusInternalServerError:
+		e.kind = ErrUnavailable
+		e.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"))
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		e.kind = ErrUnauthorized
+	default:
+		e.kind = ErrBadRequest
+	}
+	return e
+}
+
+// newNetworkError wrap transport error, returns nil if ctx is done
+func newNetworkError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return &APIError{kind: ErrUnavailable, Message: err.Error(), err: err}
+}
+
+// readErrorMessage read error message from OpenAI style error body
+func readErrorMessage(body io.Reader) string {
+	data, err := io.ReadAll(io.LimitReader(body, 4096))
+	if err != nil || len(data) == 0 {
+		return ""
+	}
+
+	var errResp struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(data, &errResp); err == nil && errResp.Error.Message != "" {
+		return errResp.Error.Message
+	}
+	return string(data)
+}
+
+// parseRetryAfter parse Retry-After header, supports seconds and http date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
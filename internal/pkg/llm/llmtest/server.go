@@ -0,0 +1,205 @@
+// Package llmtest provides an OpenAI compatible mock LLM server for offline development and tests.
+package llmtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/xmualex2023/i18n-translation/internal/pkg/llm"
+)
+
+// Fault injected fault
+type Fault string
+
+const (
+	FaultNone        Fault = ""          // 不注入错误
+	FaultRateLimit   Fault = "429"       // 返回 429 Too Many Requests
+	FaultServerError Fault = "500"       // 返回 500 Internal Server Error
+	FaultMalformed   Fault = "malformed" // 返回无法解析的 JSON
+)
+
+// Options mock server options
+type Options struct {
+	Latency    time.Duration // 每个请求的响应延迟
+	Fault      Fault         // 注入的错误类型
+	FaultFirst int           // 前 N 个请求注入错误
+	FaultEvery int           // 每 N 个请求注入一次错误，1 表示全部
+	RetryAfter int           // 429 响应的 Retry-After（秒），0 表示不返回
+}
+
+// Handler chat completions handler, translations are deterministic pseudo translations
+type Handler struct {
+	opts     Options
+	requests int64
+}
+
+func NewHandler(opts Options) *Handler {
+	return &Handler{opts: opts}
+}
+
+// Requests number of received requests
+func (h *Handler) Requests() int {
+	return int(atomic.LoadInt64(&h.requests))
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/v1/chat/completions" {
+		writeError(w, http.StatusNotFound, "unknown path: "+r.URL.Path)
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	n := int(atomic.AddInt64(&h.requests, 1))
+	if h.opts.Latency > 0 {
+		select {
+		case <-time.After(h.opts.Latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	if h.shouldFail(n) {
+		switch h.opts.Fault {
+		case FaultRateLimit:
+			if h.opts.RetryAfter > 0 {
+				w.Header().Set("Retry-After", strconv.Itoa(h.opts.RetryAfter))
+			}
+			writeError(w, http.StatusTooManyRequests, "rate limit reached")
+			return
+		case FaultServerError:
+			writeError(w, http.StatusInternalServerError, "internal server error")
+			return
+		case FaultMalformed:
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"id": "chatcmpl-mock", "choices": [`))
+			return
+		}
+	}
+
+	var req llm.TranslationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+	if len(req.Messages) == 0 {
+		writeError(w, http.StatusBadRequest, "messages is required")
+		return
+	}
+
+	prompt := req.Messages[len(req.Messages)-1].Content
+	content, err := reply(prompt, req.ResponseFormat != nil)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	promptTokens := 0
+	for _, m := range req.Messages {
+		promptTokens += countTokens(m.Content)
+	}
+	completionTokens := countTokens(content)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(llm.TranslationResponse{
+		ID:      fmt.Sprintf("chatcmpl-mock-%d", n),
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Choices: []llm.Choice{{
+			Index:   0,
+			Message: llm.Message{Role: "assistant", Content: content},
+		}},
+		Usage: llm.Usage{
+			PromptTokens:     promptTokens,
+			CompletionTokens: completionTokens,
+			TotalTokens:      promptTokens + completionTokens,
+		},
+	})
+}
+
+func (h *Handler) shouldFail(n int) bool {
+	if h.opts.Fault == FaultNone {
+		return false
+	}
+	if n <= h.opts.FaultFirst {
+		return true
+	}
+	return h.opts.FaultEvery > 0 && n%h.opts.FaultEvery == 0
+}
+
+// reply build the pseudo translation of the prompt: "将以下<src>文本翻译成<dst>：\n\n<text>"
+func reply(prompt string, structured bool) (string, error) {
+	header, text, ok := strings.Cut(prompt, "\n\n")
+	if !ok {
+		return "", fmt.Errorf("unexpected prompt: %q", prompt)
+	}
+	targetLang := "xx"
+	if _, after, found := strings.Cut(header, "翻译成"); found {
+		targetLang = strings.TrimSuffix(after, "：")
+	}
+
+	if !structured {
+		return Translate(text, targetLang), nil
+	}
+
+	var payload struct {
+		Translations []llm.Segment `json:"translations"`
+	}
+	if err := json.Unmarshal([]byte(text), &payload); err != nil {
+		return "", fmt.Errorf("invalid segments: %v", err)
+	}
+	for i := range payload.Translations {
+		payload.Translations[i].Text = Translate(payload.Translations[i].Text, targetLang)
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// Translate deterministic pseudo translation of text
+func Translate(text, targetLang string) string {
+	return fmt.Sprintf("[%s] %s", targetLang, text)
+}
+
+// countTokens rough token estimation, about 4 characters per token
+func countTokens(s string) int {
+	return utf8.RuneCountInString(s)/4 + 1
+}
+
+func writeError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]string{
+			"message": message,
+			"type":    "mock_error",
+		},
+	})
+}
+
+// Server in-process mock server
+type Server struct {
+	*httptest.Server
+	*Handler
+}
+
+// NewServer start an in-process mock server, the caller should call Close when finished.
+// Use Server.URL as the endpoint of llm.Client.
+func NewServer(opts Options) *Server {
+	h := NewHandler(opts)
+	return &Server{
+		Server:  httptest.NewServer(h),
+		Handler: h,
+	}
+}
@@ -0,0 +1,41 @@
+package llm
+
+import (
+	"errors"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy retry policy of API calls, only retryable errors are retried
+type RetryPolicy struct {
+	MaxRetries int
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+}
+
+var defaultRetryPolicy = RetryPolicy{
+	MaxRetries: 3,
+	BaseDelay:  time.Second,
+	MaxDelay:   30 * time.Second,
+}
+
+// backoff returns the delay before the next attempt, Retry-After takes precedence. It returns
+// false if Retry-After exceeds MaxDelay, retrying earlier is rejected again, so the caller
+// should give up and leave the wait to the task retry.
+func (p RetryPolicy) backoff(attempt int, err error) (time.Duration, bool) {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+		return apiErr.RetryAfter, apiErr.RetryAfter <= p.MaxDelay
+	}
+
+	delay := p.BaseDelay << uint(attempt)
+	if delay <= 0 || delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	// jitter: [delay/2, delay)
+	half := delay / 2
+	if half <= 0 {
+		return delay, true
+	}
+	return half + time.Duration(rand.Int63n(int64(half))), true
+}
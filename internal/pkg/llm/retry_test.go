@@ -0,0 +1,64 @@
+package llm
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		min   time.Duration
+		max   time.Duration
+	}{
+		{"Empty", "", 0, 0},
+		{"Seconds", "120", 120 * time.Second, 120 * time.Second},
+		{"ZeroSeconds", "0", 0, 0},
+		{"NegativeSeconds", "-5", 0, 0},
+		{"HTTPDate", time.Now().Add(time.Minute).UTC().Format(http.TimeFormat), 58 * time.Second, time.Minute},
+		{"PastHTTPDate", time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat), 0, 0},
+		{"Invalid", "soon", 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := parseRetryAfter(tt.value)
+			assert.GreaterOrEqual(t, d, tt.min)
+			assert.LessOrEqual(t, d, tt.max)
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	policy := RetryPolicy{MaxRetries: 3, BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+	tests := []struct {
+		name    string
+		attempt int
+		err     error
+		min     time.Duration
+		max     time.Duration
+		ok      bool
+	}{
+		{"First", 0, &APIError{kind: ErrUnavailable}, 500 * time.Millisecond, time.Second, true},
+		{"Doubled", 2, &APIError{kind: ErrUnavailable}, 2 * time.Second, 4 * time.Second, true},
+		{"CappedAtMaxDelay", 10, &APIError{kind: ErrUnavailable}, 5 * time.Second, 10 * time.Second, true},
+		{"Overflow", 100, &APIError{kind: ErrUnavailable}, 5 * time.Second, 10 * time.Second, true},
+		{"RetryAfter", 0, &APIError{kind: ErrRateLimited, RetryAfter: 3 * time.Second}, 3 * time.Second, 3 * time.Second, true},
+		{"RetryAfterMaxDelay", 0, &APIError{kind: ErrRateLimited, RetryAfter: 10 * time.Second}, 10 * time.Second, 10 * time.Second, true},
+		// 超过 MaxDelay 时放弃重试
+		{"RetryAfterTooLong", 0, &APIError{kind: ErrRateLimited, RetryAfter: time.Hour}, time.Hour, time.Hour, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, ok := policy.backoff(tt.attempt, tt.err)
+			assert.Equal(t, tt.ok, ok)
+			assert.GreaterOrEqual(t, d, tt.min)
+			assert.LessOrEqual(t, d, tt.max)
+		})
+	}
+}
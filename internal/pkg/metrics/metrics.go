@@ -27,12 +27,30 @@ var (
 		[]string{"status"},
 	)
 
-	// QueueSize 队列大小
-	QueueSize = promauto.NewGauge(
+	// QueueSize 各优先级队列大小
+	QueueSize = promauto.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: "translation_queue_size",
 			Help: "翻译任务队列大小",
 		},
+		[]string{"priority"},
+	)
+
+	// QueuePending 各消费者已取出未确认的任务数
+	QueuePending = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "translation_queue_pending",
+			Help: "各消费者已取出但未确认的翻译任务数",
+		},
+		[]string{"consumer"},
+	)
+
+	// ScheduledTasks 延迟队列中等待执行的任务数
+	ScheduledTasks = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "translation_scheduled_tasks",
+			Help: "延迟队列中等待执行的翻译任务数",
+		},
 	)
 
 	// WorkerCount 工作器数量
@@ -43,6 +61,68 @@ var (
 		},
 	)
 
+	// LLMCacheCounter 翻译缓存命中计数器
+	LLMCacheCounter = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "translation_llm_cache_total",
+			Help: "翻译缓存命中/未命中次数",
+		},
+		[]string{"result"}, // hit, miss
+	)
+
+	// CircuitBreakerState 熔断器状态
+	CircuitBreakerState = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "translation_circuit_breaker_state",
+			Help: "翻译服务熔断器状态：0 关闭，1 半开，2 打开",
+		},
+		[]string{"provider"},
+	)
+
+	// DeadLetterCounter 进入死信队列的任务数
+	DeadLetterCounter = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "translation_dead_letters_total",
+			Help: "重试耗尽进入死信队列的任务数",
+		},
+	)
+
+	// LLMLatency 翻译服务请求耗时
+	LLMLatency = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "translation_llm_request_duration_seconds",
+			Help:    "翻译服务成功请求的耗时",
+			Buckets: prometheus.ExponentialBuckets(0.25, 2, 10),
+		},
+		[]string{"provider"},
+	)
+
+	// WorkerPoolSize 工作器池大小
+	WorkerPoolSize = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "translation_worker_pool_size",
+			Help: "工作器池大小：current 当前，desired 自动扩缩容期望值",
+		},
+		[]string{"kind"}, // current, desired
+	)
+
+	// WorkerScaleCounter 工作器池扩缩容次数
+	WorkerScaleCounter = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "translation_worker_scale_total",
+			Help: "工作器池扩缩容次数",
+		},
+		[]string{"direction", "trigger"}, // up/down, auto/manual
+	)
+
+	// QueueWaitEstimate 估算的队列等待时间
+	QueueWaitEstimate = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "translation_queue_wait_estimate_seconds",
+			Help: "按队列长度和处理速率估算的新任务等待时间",
+		},
+	)
+
 	// TODO: Add more metrics here
 
 	// append metrics
@@ -50,7 +130,16 @@ var (
 		TaskCounter,
 		TaskDuration,
 		QueueSize,
+		QueuePending,
+		ScheduledTasks,
 		WorkerCount,
+		LLMCacheCounter,
+		CircuitBreakerState,
+		DeadLetterCounter,
+		LLMLatency,
+		WorkerPoolSize,
+		WorkerScaleCounter,
+		QueueWaitEstimate,
 	}
 )
 
@@ -62,10 +151,46 @@ func ObserveTaskDuration(status string, duration time.Duration) {
 	TaskDuration.WithLabelValues(status).Observe(duration.Seconds())
 }
 
-func SetQueueSize(size int) {
-	QueueSize.Set(float64(size))
+func SetQueueSize(priority string, size int) {
+	QueueSize.WithLabelValues(priority).Set(float64(size))
+}
+
+func SetQueuePending(consumer string, count int) {
+	QueuePending.WithLabelValues(consumer).Set(float64(count))
+}
+
+func SetScheduledTasks(size int) {
+	ScheduledTasks.Set(float64(size))
 }
 
 func SetWorkerCount(count int) {
 	WorkerCount.Set(float64(count))
 }
+
+func IncLLMCache(result string) {
+	LLMCacheCounter.WithLabelValues(result).Inc()
+}
+
+func SetCircuitBreakerState(provider string, state int) {
+	CircuitBreakerState.WithLabelValues(provider).Set(float64(state))
+}
+
+func IncDeadLetter() {
+	DeadLetterCounter.Inc()
+}
+
+func ObserveLLMLatency(provider string, duration time.Duration) {
+	LLMLatency.WithLabelValues(provider).Observe(duration.Seconds())
+}
+
+func SetWorkerPoolSize(kind string, size int) {
+	WorkerPoolSize.WithLabelValues(kind).Set(float64(size))
+}
+
+func IncWorkerScale(direction, trigger string) {
+	WorkerScaleCounter.WithLabelValues(direction, trigger).Inc()
+}
+
+func SetQueueWaitEstimate(wait time.Duration) {
+	QueueWaitEstimate.Set(wait.Seconds())
+}
@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+const adminTokenHeaderKey = "X-Admin-Token"
+
+// AdminMiddleware check admin token, admin endpoints are disabled if token is empty
+func AdminMiddleware(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token == "" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "admin api disabled"})
+			c.Abort()
+			return
+		}
+
+		if subtle.ConstantTimeCompare([]byte(c.GetHeader(adminTokenHeaderKey)), []byte(token)) != 1 {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid admin token"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -33,7 +33,7 @@ func AuthMiddleware(maker *auth.JWTMaker) gin.HandlerFunc {
 
 		// store user info in context
 		c.Set("user_id", claims.UserID.Hex())
-		c.Set("claims", claims)
+		c.Set(authorizationPayloadKey, claims)
 
 		c.Next()
 	}
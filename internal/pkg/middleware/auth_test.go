@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmualex2023/i18n-translation/internal/pkg/auth"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TestAuthMiddleware 测试认证后的处理函数可以通过 GetCurrentUser 取到令牌中的用户
+func TestAuthMiddleware(t *testing.T) {
+	mr, err := miniredis.Run()
+	require.NoError(t, err)
+	defer mr.Close()
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+
+	maker := auth.NewJWTMaker("secret", auth.NewRedisTokenCache(client, "token", time.Hour))
+	userID := primitive.NewObjectID()
+	token, _, err := maker.CreateToken(context.Background(), userID, time.Hour)
+	require.NoError(t, err)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/me", AuthMiddleware(maker), func(c *gin.Context) {
+		claims, ok := GetCurrentUser(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"user_id": claims.UserID.Hex(), "id": c.GetString("user_id")})
+	})
+
+	do := func(header string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/me", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do("Bearer " + token)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"user_id":"`+userID.Hex()+`","id":"`+userID.Hex()+`"}`, w.Body.String())
+
+	// 没有令牌或令牌无效
+	assert.Equal(t, http.StatusUnauthorized, do("").Code)
+	assert.Equal(t, http.StatusUnauthorized, do("Bearer invalid").Code)
+}
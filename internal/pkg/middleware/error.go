@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -21,11 +22,23 @@ func ErrorHandler() gin.HandlerFunc {
 		var httpCode int
 		var message string
 
-		switch err.Err {
-		case llm.ErrInvalidResponse:
+		switch {
+		case errors.Is(err.Err, llm.ErrInvalidResponse):
 			httpCode = http.StatusBadGateway
 			message = "translation service response invalid"
-		case llm.ErrAPIError:
+		case errors.Is(err.Err, llm.ErrCircuitOpen):
+			httpCode = http.StatusServiceUnavailable
+			message = "translation service temporarily unavailable"
+		case errors.Is(err.Err, llm.ErrRateLimited):
+			httpCode = http.StatusTooManyRequests
+			message = "translation service rate limited, please try again later"
+		case errors.Is(err.Err, llm.ErrUnauthorized):
+			httpCode = http.StatusBadGateway
+			message = "translation service authentication failed"
+		case errors.Is(err.Err, llm.ErrBadRequest):
+			httpCode = http.StatusBadGateway
+			message = "translation service rejected request: " + err.Error()
+		case errors.Is(err.Err, llm.ErrAPIError):
 			httpCode = http.StatusServiceUnavailable
 			message = "translation service temporarily unavailable"
 		default:
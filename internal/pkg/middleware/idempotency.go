@@ -0,0 +1,107 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xmualex2023/i18n-translation/internal/pkg/idempotency"
+)
+
+const (
+	idempotencyKeyHeaderKey   = "Idempotency-Key"
+	idempotentReplayHeaderKey = "Idempotent-Replayed"
+	maxIdempotencyKeyLength   = 255
+)
+
+// responseRecorder keep a copy of the response body
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Idempotency replay the stored response for requests repeating the Idempotency-Key header of
+// a previous request of the user, requests without the header are not affected. Keys reused
+// with a different request are rejected. Server errors are not stored, so the request can be
+// retried with the same key. The response of a request whose reservation expired meanwhile is
+// not stored either, the key belongs to the request which took it over.
+func Idempotency(store *idempotency.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(idempotencyKeyHeaderKey)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "idempotency key too long"})
+			c.Abort()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read request body"})
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		// keys are scoped by user
+		key = c.GetString("user_id") + ":" + key
+		fingerprint := idempotency.Fingerprint(c.Request.Method, c.Request.URL.Path, body)
+		token, rec, err := store.Begin(c.Request.Context(), key, fingerprint)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "idempotency service error"})
+			c.Abort()
+			return
+		}
+		if rec != nil {
+			switch {
+			case rec.Fingerprint != fingerprint:
+				c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "idempotency key already used for a different request"})
+			case !rec.Done:
+				c.JSON(http.StatusConflict, gin.H{"error": "a request with the same idempotency key is in progress"})
+			default:
+				c.Header(idempotentReplayHeaderKey, "true")
+				c.Data(rec.Status, rec.ContentType, rec.Body)
+			}
+			c.Abort()
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+
+		// the request context may be cancelled already
+		ctx := context.Background()
+		if recorder.Status() >= http.StatusInternalServerError {
+			if err := store.Release(ctx, key, token); err != nil {
+				log.Printf("failed to release idempotency key, error: %v", err)
+			}
+			return
+		}
+		err = store.Complete(ctx, key, token, &idempotency.Record{
+			Fingerprint: fingerprint,
+			Status:      recorder.Status(),
+			ContentType: recorder.Header().Get("Content-Type"),
+			Body:        recorder.body.Bytes(),
+		})
+		if err != nil {
+			log.Printf("failed to store idempotent response, error: %v", err)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmualex2023/i18n-translation/internal/pkg/idempotency"
+)
+
+func TestIdempotency(t *testing.T) {
+	mr, err := miniredis.Run()
+	require.NoError(t, err)
+	defer mr.Close()
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	calls := 0
+	fail := false
+	r.POST("/tasks", func(c *gin.Context) {
+		c.Set("user_id", c.GetHeader("X-User"))
+	}, Idempotency(idempotency.NewStore(client, "idempotency", time.Hour, time.Minute)), func(c *gin.Context) {
+		calls++
+		if fail {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed"})
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{"call": calls})
+	})
+
+	do := func(user, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/tasks", strings.NewReader(body))
+		req.Header.Set("X-User", user)
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// 重复请求返回首次请求的响应
+	w := do("u1", "k1", `{"a":1}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	w = do("u1", "k1", `{"a":1}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.JSONEq(t, `{"call":1}`, w.Body.String())
+	assert.Equal(t, "true", w.Header().Get("Idempotent-Replayed"))
+	assert.Equal(t, 1, calls)
+
+	// 相同 key 用于不同请求
+	w = do("u1", "k1", `{"a":2}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+	// key 按用户隔离，没有 key 的请求不受影响
+	assert.Equal(t, http.StatusCreated, do("u2", "k1", `{"a":2}`).Code)
+	assert.Equal(t, http.StatusCreated, do("u1", "", `{"a":1}`).Code)
+	assert.Equal(t, 3, calls)
+
+	// 服务端错误不保存，可以重试
+	fail = true
+	assert.Equal(t, http.StatusInternalServerError, do("u1", "k2", `{}`).Code)
+	fail = false
+	assert.Equal(t, http.StatusCreated, do("u1", "k2", `{}`).Code)
+	assert.Equal(t, 5, calls)
+
+	// 首次请求处理中
+	store := idempotency.NewStore(client, "idempotency", time.Hour, time.Minute)
+	_, rec, err := store.Begin(context.Background(), "u1:k3", idempotency.Fingerprint(http.MethodPost, "/tasks", []byte(`{}`)))
+	require.NoError(t, err)
+	assert.Nil(t, rec)
+	assert.Equal(t, http.StatusConflict, do("u1", "k3", `{}`).Code)
+}
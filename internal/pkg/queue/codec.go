@@ -0,0 +1,179 @@
+package queue
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+)
+
+var (
+	ErrUnknownTaskType    = errors.New("unknown task type")
+	ErrUnsupportedVersion = errors.New("unsupported task version")
+)
+
+// Envelope message format of the queue, carries task type name and schema version
+type Envelope struct {
+	Type       string          `json:"type"`
+	Version    int             `json:"version"`
+	Payload    json.RawMessage `json:"payload"`
+	Priority   Priority        `json:"priority,omitempty"` // lane of the task, read by lua scripts
+	ID         string          `json:"id,omitempty"`       // read by lua scripts in fair mode
+	Owner      string          `json:"owner,omitempty"`    // sub-queue of the task in fair mode
+	EnqueuedAt time.Time       `json:"enqueued_at"`
+}
+
+// Factory create an empty task to decode payload into
+type Factory func() Task
+
+// Migration upgrade payload of a version to the next version
+type Migration func(payload json.RawMessage) (json.RawMessage, error)
+
+type registryEntry struct {
+	name       string
+	version    int
+	factory    Factory
+	migrations map[int]Migration // from version -> migration
+}
+
+// Registry task type registry, maps task type names to concrete types
+type Registry struct {
+	mu     sync.RWMutex
+	byName map[string]*registryEntry
+	byType map[reflect.Type]*registryEntry
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		byName: make(map[string]*registryEntry),
+		byType: make(map[reflect.Type]*registryEntry),
+	}
+}
+
+// DefaultRegistry registry used by queues by default
+var DefaultRegistry = NewRegistry()
+
+// Register register task type to DefaultRegistry
+func Register(name string, version int, factory Factory) {
+	DefaultRegistry.Register(name, version, factory)
+}
+
+// RegisterMigration register payload migration to DefaultRegistry
+func RegisterMigration(name string, fromVersion int, migration Migration) {
+	DefaultRegistry.RegisterMigration(name, fromVersion, migration)
+}
+
+// Register register task type with its current schema version, panics on duplicate registration
+func (r *Registry) Register(name string, version int, factory Factory) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	typ := reflect.TypeOf(factory())
+	if _, ok := r.byName[name]; ok {
+		panic(fmt.Sprintf("queue: task type %s registered twice", name))
+	}
+	if _, ok := r.byType[typ]; ok {
+		panic(fmt.Sprintf("queue: go type %v registered twice", typ))
+	}
+
+	entry := &registryEntry{
+		name:       name,
+		version:    version,
+		factory:    factory,
+		migrations: make(map[int]Migration),
+	}
+	r.byName[name] = entry
+	r.byType[typ] = entry
+}
+
+// RegisterMigration register migration which upgrades payload from fromVersion to fromVersion+1.
+// Versions without migration are decoded as is, which is fine for additive changes.
+func (r *Registry) RegisterMigration(name string, fromVersion int, migration Migration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry, ok := r.byName[name]
+	if !ok {
+		panic(fmt.Sprintf("queue: task type %s not registered", name))
+	}
+	entry.migrations[fromVersion] = migration
+}
+
+// Encode wrap task into envelope
+func (r *Registry) Encode(task Task) ([]byte, error) {
+	r.mu.RLock()
+	entry, ok := r.byType[reflect.TypeOf(task)]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %T", ErrUnknownTaskType, task)
+	}
+
+	payload, err := json.Marshal(task)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal task, error: %w", err)
+	}
+
+	var priority Priority
+	if pt, ok := task.(PrioritizedTask); ok {
+		priority = pt.GetPriority()
+	}
+
+	return json.Marshal(&Envelope{
+		Type:       entry.name,
+		Version:    entry.version,
+		Payload:    payload,
+		Priority:   priority,
+		ID:         task.GetID(),
+		Owner:      ownerOf(task),
+		EnqueuedAt: time.Now(),
+	})
+}
+
+// Decode unwrap envelope into concrete task, payloads of older versions are migrated first
+func (r *Registry) Decode(data []byte) (Task, error) {
+	env, err := r.DecodeEnvelope(data)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	entry, ok := r.byName[env.Type]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownTaskType, env.Type)
+	}
+	if env.Version > entry.version {
+		return nil, fmt.Errorf("%w: %s v%d, supported: v%d", ErrUnsupportedVersion, env.Type, env.Version, entry.version)
+	}
+
+	payload := env.Payload
+	for v := env.Version; v < entry.version; v++ {
+		migrate, ok := entry.migrations[v]
+		if !ok {
+			continue
+		}
+		if payload, err = migrate(payload); err != nil {
+			return nil, fmt.Errorf("failed to migrate task %s from v%d, error: %w", env.Type, v, err)
+		}
+	}
+
+	task := entry.factory()
+	if err := json.Unmarshal(payload, task); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal task, type: %s, error: %w", env.Type, err)
+	}
+	return task, nil
+}
+
+// DecodeEnvelope decode envelope without decoding payload
+func (r *Registry) DecodeEnvelope(data []byte) (*Envelope, error) {
+	var env Envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal envelope, error: %w", err)
+	}
+	if env.Type == "" {
+		return nil, fmt.Errorf("%w: missing type", ErrUnknownTaskType)
+	}
+	return &env, nil
+}
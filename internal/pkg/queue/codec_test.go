@@ -0,0 +1,65 @@
+package queue
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistryEncodeDecode(t *testing.T) {
+	r := NewRegistry()
+	r.Register("mock", 1, func() Task { return &MockTask{} })
+
+	data, err := r.Encode(&MockTask{ID: "task1"})
+	require.NoError(t, err)
+
+	env, err := r.DecodeEnvelope(data)
+	require.NoError(t, err)
+	assert.Equal(t, "mock", env.Type)
+	assert.Equal(t, 1, env.Version)
+
+	task, err := r.Decode(data)
+	require.NoError(t, err)
+	mockTask, ok := task.(*MockTask)
+	require.True(t, ok)
+	assert.Equal(t, "task1", mockTask.ID)
+}
+
+func TestRegistryUnknownType(t *testing.T) {
+	r := NewRegistry()
+
+	_, err := r.Encode(&MockTask{ID: "task1"})
+	assert.ErrorIs(t, err, ErrUnknownTaskType)
+
+	_, err = r.Decode([]byte(`{"type": "other", "version": 1, "payload": {}}`))
+	assert.ErrorIs(t, err, ErrUnknownTaskType)
+
+	// 旧格式（无 envelope）的消息
+	_, err = r.Decode([]byte(`{"id": "task1"}`))
+	assert.ErrorIs(t, err, ErrUnknownTaskType)
+}
+
+func TestRegistryVersion(t *testing.T) {
+	r := NewRegistry()
+	r.Register("mock", 2, func() Task { return &MockTask{} })
+	r.RegisterMigration("mock", 1, func(payload json.RawMessage) (json.RawMessage, error) {
+		var v1 struct {
+			TaskID string `json:"task_id"`
+		}
+		if err := json.Unmarshal(payload, &v1); err != nil {
+			return nil, err
+		}
+		return json.Marshal(&MockTask{ID: v1.TaskID})
+	})
+
+	// v1 的消息经过迁移后解码
+	task, err := r.Decode([]byte(`{"type": "mock", "version": 1, "payload": {"task_id": "task1"}}`))
+	require.NoError(t, err)
+	assert.Equal(t, "task1", task.GetID())
+
+	// 新版本的消息无法被旧代码解码
+	_, err = r.Decode([]byte(`{"type": "mock", "version": 3, "payload": {"id": "task1"}}`))
+	assert.ErrorIs(t, err, ErrUnsupportedVersion)
+}
@@ -0,0 +1,157 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// DeadLetter task which exhausted its retries
+type DeadLetter struct {
+	ID       string          `json:"id"`
+	Message  json.RawMessage `json:"message"` // envelope of the task
+	Error    string          `json:"error"`
+	FailedAt time.Time       `json:"failed_at"`
+}
+
+// DeadLetterQueue queue which keeps dead letters for inspection
+type DeadLetterQueue interface {
+	// DeadLetters list dead letters, newest first
+	DeadLetters(ctx context.Context, offset, limit int64) ([]*DeadLetter, int64, error)
+	// RequeueDeadLetter move dead letter of the task back to the queue with attempts reset
+	RequeueDeadLetter(ctx context.Context, taskID string) (Task, error)
+	// PurgeDeadLetters remove all dead letters
+	PurgeDeadLetters(ctx context.Context) (int64, error)
+}
+
+// takeDeadLetterScript remove the first dead letter starting with the prefix and return it,
+// the list is scanned in chunks on the server
+// KEYS: dead letters; ARGV: entry prefix, chunk size
+var takeDeadLetterScript = redis.NewScript(`
+local prefix, size = ARGV[1], tonumber(ARGV[2])
+local start = 0
+while true do
+	local values = redis.call('LRANGE', KEYS[1], start, start + size - 1)
+	if #values == 0 then
+		return false
+	end
+	for _, v in ipairs(values) do
+		if string.sub(v, 1, #prefix) == prefix then
+			redis.call('LREM', KEYS[1], 1, v)
+			return v
+		end
+	end
+	start = start + size
+end
+`)
+
+// takeChunkSize dead letters scanned per LRANGE by takeDeadLetterScript
+const takeChunkSize = 100
+
+// deadLetterStore redis list of dead letters, shared by queue backends
+type deadLetterStore struct {
+	client   *redis.Client
+	registry *Registry
+	key      string
+}
+
+// entry encode dead letter of the task
+func (s *deadLetterStore) entry(task Task, cause error) ([]byte, error) {
+	data, err := s.registry.Encode(task)
+	if err != nil {
+		return nil, err
+	}
+
+	errMsg := ""
+	if cause != nil {
+		errMsg = cause.Error()
+	}
+	entry, err := json.Marshal(&DeadLetter{
+		ID:       task.GetID(),
+		Message:  data,
+		Error:    errMsg,
+		FailedAt: time.Now(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal dead letter, error: %w", err)
+	}
+	return entry, nil
+}
+
+func (s *deadLetterStore) list(ctx context.Context, offset, limit int64) ([]*DeadLetter, int64, error) {
+	total, err := s.client.LLen(ctx, s.key).Result()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count dead letters, error: %w", err)
+	}
+
+	values, err := s.client.LRange(ctx, s.key, offset, offset+limit-1).Result()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list dead letters, error: %w", err)
+	}
+
+	letters := make([]*DeadLetter, 0, len(values))
+	for _, v := range values {
+		var letter DeadLetter
+		if err := json.Unmarshal([]byte(v), &letter); err != nil {
+			return nil, 0, fmt.Errorf("failed to unmarshal dead letter, error: %w", err)
+		}
+		letters = append(letters, &letter)
+	}
+	return letters, total, nil
+}
+
+// take remove dead letter of the task and return the task with attempts reset, nil if not found
+func (s *deadLetterStore) take(ctx context.Context, taskID string) (Task, error) {
+	// entries are encoded by entry, which writes the id first
+	id, err := json.Marshal(taskID)
+	if err != nil {
+		return nil, err
+	}
+	prefix := `{"id":` + string(id) + `,`
+
+	v, err := takeDeadLetterScript.Run(ctx, s.client, []string{s.key}, prefix, takeChunkSize).Text()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to remove dead letter, taskID: %s, error: %w", taskID, err)
+	}
+
+	var letter DeadLetter
+	if err := json.Unmarshal([]byte(v), &letter); err != nil {
+		return nil, s.restore(ctx, v, fmt.Errorf("failed to unmarshal dead letter, error: %w", err))
+	}
+	task, err := s.registry.Decode(letter.Message)
+	if err != nil {
+		return nil, s.restore(ctx, v, err)
+	}
+	if rt, ok := task.(RetryableTask); ok {
+		rt.SetAttempts(0)
+	}
+	return task, nil
+}
+
+// restore put back a dead letter which couldn't be requeued, and return cause
+func (s *deadLetterStore) restore(ctx context.Context, entry string, cause error) error {
+	if err := s.client.LPush(ctx, s.key, entry).Err(); err != nil {
+		return fmt.Errorf("%w, failed to restore dead letter, error: %v", cause, err)
+	}
+	return cause
+}
+
+// purge remove all dead letters, the count and the deletion are atomic
+func (s *deadLetterStore) purge(ctx context.Context) (int64, error) {
+	var total *redis.IntCmd
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		total = pipe.LLen(ctx, s.key)
+		pipe.Del(ctx, s.key)
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge dead letters, error: %w", err)
+	}
+	return total.Val(), nil
+}
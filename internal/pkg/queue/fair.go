@@ -0,0 +1,256 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// OwnedTask task submitted by a user, tasks not implementing it share an anonymous owner
+type OwnedTask interface {
+	Task
+	GetOwner() string
+}
+
+func ownerOf(task Task) string {
+	if ot, ok := task.(OwnedTask); ok {
+		return ot.GetOwner()
+	}
+	return ""
+}
+
+// WithFairShare enable fair mode. Tasks of each owner wait in their own sub-queue per lane and
+// owners are served round robin, so a large batch of one owner doesn't starve the others.
+// Each owner runs at most maxRunning tasks at once across all consumers, 0 means unlimited.
+// StreamQueue doesn't support fair mode.
+func WithFairShare(maxRunning int) Option {
+	return func(o *options) {
+		o.fair = true
+		o.maxRunning = maxRunning
+	}
+}
+
+// In fair mode the lanes of RedisQueue are the inboxes of new, retried and released messages,
+// so scripts pushing into the lanes work unchanged. Dequeue moves messages from the inbox into
+// the sub-queues of their owners, and pops from the next owner of the lane round robin.
+// The running tasks of an owner are kept in a sorted set scored by the slot deadline. Slots are
+// freed by Ack, Nack and Release. In reliable mode the deadline is the lease deadline, the task
+// is reaped then. Otherwise the consumer refreshes the slots of its running tasks every reap
+// interval, so only slots of crashed consumers expire after the visibility timeout.
+// Sub-queue and running keys are derived from prefixes declared in KEYS, all of them have the
+// hash tag of the queue key, so they're in the same redis cluster slot.
+
+// envelopeLua owner and id of a raw message by its envelope
+const envelopeLua = `
+local function envelope(raw)
+	local ok, env = pcall(cjson.decode, raw)
+	if ok and type(env) == 'table' then
+		return env.owner or '', env.id or raw
+	end
+	return '', raw
+end
+`
+
+// fairPopScript KEYS: inbox, owners, processing, sub-queue prefix, running prefix;
+// ARGV: max running, now, slot deadline, move limit, reliable
+var fairPopScript = redis.NewScript(envelopeLua + `
+local prefix, running, limit = KEYS[4], KEYS[5], tonumber(ARGV[1])
+for i = 1, tonumber(ARGV[4]) do
+	local raw = redis.call('RPOP', KEYS[1])
+	if not raw then
+		break
+	end
+	local owner = envelope(raw)
+	redis.call('LPUSH', prefix .. owner, raw)
+	if not redis.call('LPOS', KEYS[2], owner) then
+		redis.call('RPUSH', KEYS[2], owner)
+	end
+end
+
+for i = 1, redis.call('LLEN', KEYS[2]) do
+	local owner = redis.call('LMOVE', KEYS[2], KEYS[2], 'LEFT', 'RIGHT')
+	local slots = running .. owner
+	local free = true
+	if limit > 0 then
+		redis.call('ZREMRANGEBYSCORE', slots, '-inf', ARGV[2])
+		free = redis.call('ZCARD', slots) < limit
+	end
+	if free then
+		local sub = prefix .. owner
+		local raw = redis.call('RPOP', sub)
+		if redis.call('LLEN', sub) == 0 then
+			redis.call('LREM', KEYS[2], 1, owner)
+		end
+		if raw then
+			if limit > 0 then
+				local _, id = envelope(raw)
+				redis.call('ZADD', slots, ARGV[3], id)
+				redis.call('PEXPIREAT', slots, ARGV[3])
+			end
+			if ARGV[5] == '1' then
+				redis.call('LPUSH', KEYS[3], raw)
+			end
+			return raw
+		end
+	end
+end
+return false
+`)
+
+// fairSizeScript KEYS: inbox, owners, sub-queue prefix
+var fairSizeScript = redis.NewScript(`
+local size = redis.call('LLEN', KEYS[1])
+for _, owner in ipairs(redis.call('LRANGE', KEYS[2], 0, -1)) do
+	size = size + redis.call('LLEN', KEYS[3] .. owner)
+end
+return size
+`)
+
+// fairMoveBatchSize max messages moved from an inbox into sub-queues per dequeue
+const fairMoveBatchSize = 100
+
+// ownersKey redis list of owners with waiting tasks in the lane, rotated round robin
+func (q *RedisQueue) ownersKey(p Priority) string {
+	return q.laneKey(p) + ":owners"
+}
+
+func (q *RedisQueue) ownerKeyPrefix(p Priority) string {
+	return q.laneKey(p) + ":owner:"
+}
+
+func (q *RedisQueue) runningKeyPrefix() string {
+	return q.queueKey + ":running:"
+}
+
+// moveFair pop a message by weighted priority and round robin across owners, into the
+// processing list in reliable mode. Sub-queues can't be watched by blocking commands, so it
+// waits on the inbox of the picked lane for a short while and checks all lanes again.
+func (q *RedisQueue) moveFair(ctx context.Context) (string, error) {
+	for {
+		lanes := q.lanes.next()
+		for _, p := range lanes {
+			raw, err := q.popFair(ctx, p)
+			if err == nil {
+				return raw, nil
+			}
+			if err != redis.Nil {
+				return "", dequeueError(ctx, err)
+			}
+		}
+
+		timeout, err := laneWait(ctx)
+		if err != nil {
+			return "", err
+		}
+		// rotate the inbox in place, returns once a message arrives without taking it
+		inbox := q.laneKey(lanes[0])
+		if err := q.client.BLMove(ctx, inbox, inbox, "RIGHT", "RIGHT", timeout).Err(); err != nil && err != redis.Nil {
+			return "", dequeueError(ctx, err)
+		}
+	}
+}
+
+// dequeueError ErrEmpty if the deadline of ctx is reached while polling
+func dequeueError(ctx context.Context, err error) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return ErrEmpty
+	}
+	return fmt.Errorf("failed to dequeue task, error: %w", err)
+}
+
+func (q *RedisQueue) popFair(ctx context.Context, p Priority) (string, error) {
+	reliable := 0
+	if q.reliable {
+		reliable = 1
+	}
+	now := time.Now()
+	keys := []string{q.laneKey(p), q.ownersKey(p), q.processingKey(), q.ownerKeyPrefix(p), q.runningKeyPrefix()}
+	return fairPopScript.Run(ctx, q.client, keys, q.maxRunning, now.UnixMilli(),
+		now.Add(q.visibilityTimeout).UnixMilli(), fairMoveBatchSize, reliable).Text()
+}
+
+// refreshesSlots whether the consumer refreshes the running slots of its tasks, in reliable
+// mode slots expire with the lease instead
+func (q *RedisQueue) refreshesSlots() bool {
+	return q.fair && q.maxRunning > 0 && !q.reliable
+}
+
+// holdSlot remember the running slot of the task, so it's refreshed until the task is done
+func (q *RedisQueue) holdSlot(task Task) {
+	if !q.refreshesSlots() {
+		return
+	}
+	q.mu.Lock()
+	q.running[task.GetID()] = ownerOf(task)
+	q.mu.Unlock()
+}
+
+// releaseSlot free the running slot of the task
+func (q *RedisQueue) releaseSlot(ctx context.Context, task Task) {
+	if !q.fair || q.maxRunning <= 0 {
+		return
+	}
+	q.mu.Lock()
+	delete(q.running, task.GetID())
+	q.mu.Unlock()
+	if err := q.client.ZRem(ctx, q.runningKeyPrefix()+ownerOf(task), task.GetID()).Err(); err != nil {
+		log.Printf("failed to release running slot, taskID: %s, error: %v", task.GetID(), err)
+	}
+}
+
+// refreshSlots extend the deadline of the running slots held by the consumer
+func (q *RedisQueue) refreshSlots(ctx context.Context) error {
+	q.mu.Lock()
+	running := make(map[string]string, len(q.running))
+	for id, owner := range q.running {
+		running[id] = owner
+	}
+	q.mu.Unlock()
+	if len(running) == 0 {
+		return nil
+	}
+
+	deadline := time.Now().Add(q.visibilityTimeout)
+	_, err := q.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for id, owner := range running {
+			key := q.runningKeyPrefix() + owner
+			// XX: slots released meanwhile are not added back
+			pipe.ZAddXX(ctx, key, redis.Z{Score: float64(deadline.UnixMilli()), Member: id})
+			pipe.PExpireAt(ctx, key, deadline)
+		}
+		return nil
+	})
+	return err
+}
+
+// ownerKeys sub-queues with waiting tasks
+func (q *RedisQueue) ownerKeys(ctx context.Context) ([]string, error) {
+	var keys []string
+	for _, p := range priorities {
+		owners, err := q.client.LRange(ctx, q.ownersKey(p), 0, -1).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list owners, error: %w", err)
+		}
+		for _, owner := range owners {
+			keys = append(keys, q.ownerKeyPrefix(p)+owner)
+		}
+	}
+	return keys, nil
+}
+
+// fairLaneSizes size of each lane including the sub-queues
+func (q *RedisQueue) fairLaneSizes(ctx context.Context) (map[Priority]int64, error) {
+	sizes := make(map[Priority]int64, len(priorities))
+	for _, p := range priorities {
+		size, err := fairSizeScript.Run(ctx, q.client, []string{q.laneKey(p), q.ownersKey(p), q.ownerKeyPrefix(p)}).Int64()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get lane sizes, error: %w", err)
+		}
+		sizes[p] = size
+	}
+	return sizes, nil
+}
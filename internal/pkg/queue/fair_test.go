@@ -0,0 +1,147 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// OwnerMockTask 带提交用户的测试任务
+type OwnerMockTask struct {
+	ID    string `json:"id"`
+	Owner string `json:"owner"`
+}
+
+func (t *OwnerMockTask) GetID() string    { return t.ID }
+func (t *OwnerMockTask) GetOwner() string { return t.Owner }
+
+func init() {
+	Register("owner_mock", 1, func() Task { return &OwnerMockTask{} })
+}
+
+type fairQueue interface {
+	Queue
+	Remover
+	LaneSizes(ctx context.Context) (map[Priority]int64, error)
+}
+
+// testFairShare 各用户轮流出队，单个用户同时执行的任务数不超过 2
+func testFairShare(t *testing.T, q fairQueue) {
+	ctx := context.Background()
+	for _, task := range []*OwnerMockTask{
+		{ID: "a1", Owner: "a"}, {ID: "a2", Owner: "a"}, {ID: "a3", Owner: "a"}, {ID: "a4", Owner: "a"},
+		{ID: "b1", Owner: "b"}, {ID: "c1", Owner: "c"},
+	} {
+		require.NoError(t, q.Enqueue(ctx, task))
+	}
+
+	dequeue := func() (Task, error) {
+		ctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		defer cancel()
+		return q.Dequeue(ctx)
+	}
+
+	var got []string
+	for i := 0; i < 4; i++ {
+		task, err := dequeue()
+		require.NoError(t, err)
+		got = append(got, task.GetID())
+	}
+	assert.Equal(t, []string{"a1", "b1", "c1", "a2"}, got)
+
+	// 等待中的任务包括各用户子队列中的任务
+	sizes, err := q.LaneSizes(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), sizes[PriorityNormal])
+
+	// a 已有 2 个任务在执行
+	_, err = dequeue()
+	assert.ErrorIs(t, err, ErrEmpty)
+
+	require.NoError(t, q.Ack(ctx, &OwnerMockTask{ID: "a1", Owner: "a"}))
+	task, err := dequeue()
+	require.NoError(t, err)
+	assert.Equal(t, "a3", task.GetID())
+
+	removed, err := q.Remove(ctx, "a4")
+	require.NoError(t, err)
+	assert.True(t, removed)
+
+	// 释放的任务重新排队，并归还执行名额
+	require.NoError(t, q.Release(ctx, task))
+	task, err = dequeue()
+	require.NoError(t, err)
+	assert.Equal(t, "a3", task.GetID())
+}
+
+func TestFairShare(t *testing.T) {
+	t.Run("List", func(t *testing.T) {
+		client, cleanup := setupTestRedis(t)
+		defer cleanup()
+		testFairShare(t, NewRedisQueue(client, "fair_queue", WithFairShare(2)))
+	})
+
+	t.Run("Reliable", func(t *testing.T) {
+		client, cleanup := setupTestRedis(t)
+		defer cleanup()
+		q := NewRedisQueue(client, "fair_queue", WithFairShare(2), WithReliable("consumer1", time.Minute))
+		testFairShare(t, q)
+
+		processing, err := client.LLen(context.Background(), q.processingKey()).Result()
+		require.NoError(t, err)
+		assert.Equal(t, int64(4), processing)
+	})
+
+	t.Run("Memory", func(t *testing.T) {
+		q, err := NewMemoryQueue(WithFairShare(2))
+		require.NoError(t, err)
+		testFairShare(t, q)
+	})
+}
+
+// TestFairShareSlotRefresh 非可靠模式下执行中任务的名额由消费者续期，不会因超时被释放
+func TestFairShareSlotRefresh(t *testing.T) {
+	client, cleanup := setupTestRedis(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	q := NewRedisQueue(client, "fair_queue", WithFairShare(1), WithVisibilityTimeout(100*time.Millisecond))
+	for _, id := range []string{"a1", "a2"} {
+		require.NoError(t, q.Enqueue(ctx, &OwnerMockTask{ID: id, Owner: "a"}))
+	}
+
+	dequeue := func() (Task, error) {
+		ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+		return q.Dequeue(ctx)
+	}
+
+	task, err := dequeue()
+	require.NoError(t, err)
+	assert.Equal(t, "a1", task.GetID())
+
+	// 超过 visibility timeout 仍在执行，续期后名额仍被占用
+	for i := 0; i < 3; i++ {
+		time.Sleep(60 * time.Millisecond)
+		require.NoError(t, q.refreshSlots(ctx))
+	}
+	_, err = dequeue()
+	assert.ErrorIs(t, err, ErrEmpty)
+
+	// 确认后释放名额，不再续期
+	require.NoError(t, q.Ack(ctx, task))
+	require.NoError(t, q.refreshSlots(ctx))
+	task, err = dequeue()
+	require.NoError(t, err)
+	assert.Equal(t, "a2", task.GetID())
+
+	// 消费者崩溃（不再续期）时名额在超时后释放
+	require.NoError(t, q.Enqueue(ctx, &OwnerMockTask{ID: "a3", Owner: "a"}))
+	time.Sleep(120 * time.Millisecond)
+	task, err = dequeue()
+	require.NoError(t, err)
+	assert.Equal(t, "a3", task.GetID())
+}
@@ -0,0 +1,709 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/xmualex2023/i18n-translation/internal/pkg/metrics"
+)
+
+var ErrFull = errors.New("queue is full")
+
+// memoryEntry message of the memory queue
+type memoryEntry struct {
+	Raw      json.RawMessage `json:"message"`
+	Priority Priority        `json:"priority"`
+	Owner    string          `json:"owner,omitempty"`
+	RunAt    time.Time       `json:"run_at,omitempty"` // delayed messages only
+}
+
+// memorySnapshot persisted state of the memory queue
+type memorySnapshot struct {
+	Ready    map[Priority][]*memoryEntry `json:"ready"`
+	Inflight []*memoryEntry              `json:"inflight"`
+	Delayed  []*memoryEntry              `json:"delayed"`
+	Dead     []*DeadLetter               `json:"dead"`
+}
+
+// memoryFlush write of the memory queue state, done is closed once it's finished
+type memoryFlush struct {
+	done chan struct{}
+	err  error
+}
+
+func newMemoryFlush() *memoryFlush {
+	return &memoryFlush{done: make(chan struct{})}
+}
+
+// wait wait until the write is finished
+func (f *memoryFlush) wait() error {
+	<-f.done
+	return f.err
+}
+
+// flushed finished write, returned when persistence is disabled
+var flushed = func() *memoryFlush {
+	f := newMemoryFlush()
+	close(f.done)
+	return f
+}()
+
+// MemoryQueue in-process queue implementation for single binary deployments.
+// Capacity bounds ready tasks, Enqueue fails with ErrFull once reached. If a persist path is set,
+// the state is written to the file in the background, changes made while a write is in progress
+// are batched into the next one. Enqueue and Schedule return once the task is written, and
+// tasks in flight when the process stopped are returned to the queue by Recover on the next
+// start. The process is the only consumer, so tasks in flight are never reaped.
+type MemoryQueue struct {
+	registry    *Registry
+	retryCount  int
+	retryDelay  time.Duration
+	capacity    int
+	persistPath string
+	lanes       *laneSelector
+	fair        bool
+	maxRunning  int
+
+	mu        sync.Mutex
+	ready     map[Priority][]*memoryEntry
+	inflight  map[string]*memoryEntry // task id -> entry
+	recovered []*memoryEntry          // in flight when the process stopped
+	delayed   []*memoryEntry          // sorted by run at
+	dead      []*DeadLetter           // newest first
+	signal    chan struct{}           // closed and replaced when tasks become ready
+	running   map[string]int          // owner -> tasks in flight, fair mode only
+	owners    map[Priority][]string   // owners of each lane in round robin order, fair mode only
+	dirty     bool                    // changed since the last write started
+	flushing  bool                    // the writer goroutine is running
+	current   *memoryFlush            // write in progress
+	next      *memoryFlush            // write including the latest changes
+}
+
+// WithCapacity set max ready tasks of MemoryQueue, 0 means unbounded
+func WithCapacity(capacity int) Option {
+	return func(o *options) {
+		o.capacity = capacity
+	}
+}
+
+// WithPersistence persist MemoryQueue state to the file
+func WithPersistence(path string) Option {
+	return func(o *options) {
+		o.persistPath = path
+	}
+}
+
+// NewMemoryQueue create memory queue, state is loaded from the persist file if it exists
+func NewMemoryQueue(opts ...Option) (*MemoryQueue, error) {
+	o := newOptions(opts)
+	q := &MemoryQueue{
+		registry:    o.registry,
+		retryCount:  o.retryCount,
+		retryDelay:  o.retryDelay,
+		capacity:    o.capacity,
+		persistPath: o.persistPath,
+		lanes:       &laneSelector{weights: o.weights},
+		fair:        o.fair,
+		maxRunning:  o.maxRunning,
+		ready:       make(map[Priority][]*memoryEntry),
+		inflight:    make(map[string]*memoryEntry),
+		signal:      make(chan struct{}),
+		running:     make(map[string]int),
+		owners:      make(map[Priority][]string),
+		next:        newMemoryFlush(),
+	}
+
+	if err := q.load(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+func (q *MemoryQueue) entry(task Task) (*memoryEntry, error) {
+	data, err := q.registry.Encode(task)
+	if err != nil {
+		return nil, err
+	}
+	return &memoryEntry{Raw: data, Priority: priorityOf(task), Owner: ownerOf(task)}, nil
+}
+
+func (q *MemoryQueue) size() int {
+	n := 0
+	for _, entries := range q.ready {
+		n += len(entries)
+	}
+	return n
+}
+
+// push add entries to the tail of their lanes and wake up waiting consumers, q.mu must be held
+func (q *MemoryQueue) push(entries ...*memoryEntry) {
+	for _, e := range entries {
+		e.RunAt = time.Time{}
+		q.ready[e.Priority] = append(q.ready[e.Priority], e)
+	}
+	if len(entries) > 0 {
+		q.wake()
+	}
+}
+
+// wake wake up consumers waiting for tasks, q.mu must be held
+func (q *MemoryQueue) wake() {
+	close(q.signal)
+	q.signal = make(chan struct{})
+}
+
+// Enqueue add task to the lane of its priority, it returns once the task is written
+func (q *MemoryQueue) Enqueue(ctx context.Context, task Task) error {
+	e, err := q.entry(task)
+	if err != nil {
+		return err
+	}
+
+	q.mu.Lock()
+	if q.capacity > 0 && q.size() >= q.capacity {
+		q.mu.Unlock()
+		return fmt.Errorf("%w, capacity: %d", ErrFull, q.capacity)
+	}
+	q.push(e)
+	f := q.changed()
+	q.mu.Unlock()
+	return f.wait()
+}
+
+// Dequeue get task by weighted priority, blocks until a task is available or the deadline of
+// ctx is reached, in which case ErrEmpty is returned
+func (q *MemoryQueue) Dequeue(ctx context.Context) (Task, error) {
+	for {
+		q.mu.Lock()
+		e := q.pop()
+		signal := q.signal
+		if e == nil {
+			q.mu.Unlock()
+			select {
+			case <-signal:
+				continue
+			case <-ctx.Done():
+				if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+					return nil, ErrEmpty
+				}
+				return nil, ctx.Err()
+			}
+		}
+
+		task, err := q.registry.Decode(e.Raw)
+		if err != nil {
+			// undecodable message would be redelivered forever, drop it
+			log.Printf("drop undecodable task, message: %s, error: %v", e.Raw, err)
+			q.changed()
+			q.mu.Unlock()
+			return nil, err
+		}
+
+		q.inflight[task.GetID()] = e
+		if q.fair {
+			q.running[e.Owner]++
+		}
+		q.changed()
+		q.mu.Unlock()
+		return task, nil
+	}
+}
+
+// pop remove the head of the lane picked by weighted priority, in fair mode the oldest entry
+// of the next owner of the lane round robin, q.mu must be held
+func (q *MemoryQueue) pop() *memoryEntry {
+	for _, p := range q.lanes.next() {
+		entries := q.ready[p]
+		i := 0
+		if q.fair {
+			i = q.pickFair(p)
+		}
+		if i < 0 || i >= len(entries) {
+			continue
+		}
+
+		e := entries[i]
+		if i == 0 {
+			q.ready[p] = entries[1:]
+		} else {
+			q.ready[p] = append(entries[:i], entries[i+1:]...)
+		}
+		return e
+	}
+	return nil
+}
+
+// pickFair index of the oldest entry of the first owner in the round robin order of the lane
+// which is below its concurrency cap, -1 if none. The picked owner moves to the end, owners
+// without entries leave and new owners join at the end.
+func (q *MemoryQueue) pickFair(p Priority) int {
+	var arrived []string
+	oldest := make(map[string]int)
+	for i, e := range q.ready[p] {
+		if _, ok := oldest[e.Owner]; !ok {
+			oldest[e.Owner] = i
+			arrived = append(arrived, e.Owner)
+		}
+	}
+
+	var owners []string
+	joined := make(map[string]bool)
+	for _, owner := range q.owners[p] {
+		if _, ok := oldest[owner]; ok {
+			owners = append(owners, owner)
+			joined[owner] = true
+		}
+	}
+	for _, owner := range arrived {
+		if !joined[owner] {
+			owners = append(owners, owner)
+		}
+	}
+	q.owners[p] = owners
+
+	for i, owner := range owners {
+		if q.maxRunning <= 0 || q.running[owner] < q.maxRunning {
+			q.owners[p] = append(append(owners[:i:i], owners[i+1:]...), owner)
+			return oldest[owner]
+		}
+	}
+	return -1
+}
+
+func (q *MemoryQueue) takeInflight(task Task) (*memoryEntry, error) {
+	e, ok := q.inflight[task.GetID()]
+	if !ok {
+		return nil, fmt.Errorf("task not in flight, taskID: %s", task.GetID())
+	}
+	delete(q.inflight, task.GetID())
+	q.releaseSlot(e)
+	return e, nil
+}
+
+// releaseSlot free the running slot of the entry, consumers waiting for the owner are woken
+// up, q.mu must be held
+func (q *MemoryQueue) releaseSlot(e *memoryEntry) {
+	if !q.fair {
+		return
+	}
+	if q.running[e.Owner]--; q.running[e.Owner] <= 0 {
+		delete(q.running, e.Owner)
+	}
+	if q.maxRunning > 0 {
+		q.wake()
+	}
+}
+
+// Ack acknowledge task
+func (q *MemoryQueue) Ack(ctx context.Context, task Task) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if _, err := q.takeInflight(task); err != nil {
+		return err
+	}
+	q.changed()
+	return nil
+}
+
+// Nack retry task with exponential backoff, or move it to the dead letter queue once its
+// retries are exhausted
+func (q *MemoryQueue) Nack(ctx context.Context, task Task, cause error) (bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if _, err := q.takeInflight(task); err != nil {
+		return false, err
+	}
+
+	delay, retry := nextRetry(task, q.retryCount, q.retryDelay)
+	if retry {
+		e, err := q.entry(task)
+		if err != nil {
+			return false, err
+		}
+		q.delay(e, time.Now().Add(delay))
+		q.changed()
+		return false, nil
+	}
+
+	errMsg := ""
+	if cause != nil {
+		errMsg = cause.Error()
+	}
+	data, err := q.registry.Encode(task)
+	if err != nil {
+		return false, err
+	}
+	q.dead = append([]*DeadLetter{{
+		ID:       task.GetID(),
+		Message:  data,
+		Error:    errMsg,
+		FailedAt: time.Now(),
+	}}, q.dead...)
+
+	metrics.IncDeadLetter()
+	q.changed()
+	return true, nil
+}
+
+// Release return task to the head of its lane, capacity is not enforced
+func (q *MemoryQueue) Release(ctx context.Context, task Task) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	e, err := q.takeInflight(task)
+	if err != nil {
+		return err
+	}
+	q.ready[e.Priority] = append([]*memoryEntry{e}, q.ready[e.Priority]...)
+	q.wake()
+	q.changed()
+	return nil
+}
+
+// delay insert entry into the delay queue keeping it sorted, q.mu must be held
+func (q *MemoryQueue) delay(e *memoryEntry, runAt time.Time) {
+	e.RunAt = runAt
+	i := sort.Search(len(q.delayed), func(i int) bool { return q.delayed[i].RunAt.After(runAt) })
+	q.delayed = append(q.delayed, nil)
+	copy(q.delayed[i+1:], q.delayed[i:])
+	q.delayed[i] = e
+}
+
+// Remove remove task waiting in the lanes or the delay queue
+func (q *MemoryQueue) Remove(ctx context.Context, taskID string) (bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, p := range priorities {
+		if i := q.indexOf(q.ready[p], taskID); i >= 0 {
+			q.ready[p] = append(q.ready[p][:i], q.ready[p][i+1:]...)
+			q.changed()
+			return true, nil
+		}
+	}
+	if i := q.indexOf(q.delayed, taskID); i >= 0 {
+		q.delayed = append(q.delayed[:i], q.delayed[i+1:]...)
+		q.changed()
+		return true, nil
+	}
+	return false, nil
+}
+
+// indexOf index of the entry of the task, -1 if not found
+func (q *MemoryQueue) indexOf(entries []*memoryEntry, taskID string) int {
+	for i, e := range entries {
+		task, err := q.registry.Decode(e.Raw)
+		if err == nil && task.GetID() == taskID {
+			return i
+		}
+	}
+	return -1
+}
+
+// Recover return tasks in flight when the process stopped to the queue
+func (q *MemoryQueue) Recover(ctx context.Context) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	n := len(q.recovered)
+	q.push(q.recovered...)
+	q.recovered = nil
+	q.changed()
+	return n, nil
+}
+
+// RunReaper no-op, the process is the only consumer of the queue, so a task in flight is
+// still running however long it takes, and tasks left in flight by a previous run are
+// returned by Recover
+func (q *MemoryQueue) RunReaper(ctx context.Context, interval time.Duration) {}
+
+// Schedule add task to the delay queue, tasks due already are enqueued directly. It returns
+// once the task is written.
+func (q *MemoryQueue) Schedule(ctx context.Context, task Task, runAt time.Time) error {
+	if !runAt.After(time.Now()) {
+		return q.Enqueue(ctx, task)
+	}
+
+	e, err := q.entry(task)
+	if err != nil {
+		return err
+	}
+
+	q.mu.Lock()
+	q.delay(e, runAt)
+	f := q.changed()
+	q.mu.Unlock()
+	return f.wait()
+}
+
+// ScheduledTasks list scheduled tasks, the earliest first
+func (q *MemoryQueue) ScheduledTasks(ctx context.Context, offset, limit int64) ([]*ScheduledTask, int64, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	total := int64(len(q.delayed))
+	tasks := make([]*ScheduledTask, 0, limit)
+	for i := offset; i < total && i < offset+limit; i++ {
+		e := q.delayed[i]
+		task, err := q.registry.Decode(e.Raw)
+		if err != nil {
+			log.Printf("skip undecodable scheduled task, error: %v", err)
+			continue
+		}
+		tasks = append(tasks, &ScheduledTask{ID: task.GetID(), RunAt: e.RunAt, Message: e.Raw})
+	}
+	return tasks, total, nil
+}
+
+// CancelScheduled remove scheduled task
+func (q *MemoryQueue) CancelScheduled(ctx context.Context, taskID string) (bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if i := q.indexOf(q.delayed, taskID); i >= 0 {
+		q.delayed = append(q.delayed[:i], q.delayed[i+1:]...)
+		q.changed()
+		return true, nil
+	}
+	return false, nil
+}
+
+// PromoteDue move due tasks from the delay queue into their lanes, capacity is not enforced
+// as the tasks were accepted already
+func (q *MemoryQueue) PromoteDue(ctx context.Context) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	n := sort.Search(len(q.delayed), func(i int) bool { return q.delayed[i].RunAt.After(now) })
+	if n == 0 {
+		return 0, nil
+	}
+	q.push(q.delayed[:n]...)
+	q.delayed = q.delayed[n:]
+	q.changed()
+	return n, nil
+}
+
+// RunScheduler promote due tasks periodically until ctx is done
+func (q *MemoryQueue) RunScheduler(ctx context.Context, interval time.Duration) {
+	runPromoter(ctx, interval, q.PromoteDue)
+}
+
+// DeadLetters list dead letters, newest first
+func (q *MemoryQueue) DeadLetters(ctx context.Context, offset, limit int64) ([]*DeadLetter, int64, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	total := int64(len(q.dead))
+	if offset >= total {
+		return []*DeadLetter{}, total, nil
+	}
+	end := offset + limit
+	if end > total {
+		end = total
+	}
+	letters := make([]*DeadLetter, end-offset)
+	copy(letters, q.dead[offset:end])
+	return letters, total, nil
+}
+
+// RequeueDeadLetter move dead letter of the task back to the queue with attempts reset
+func (q *MemoryQueue) RequeueDeadLetter(ctx context.Context, taskID string) (Task, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i, letter := range q.dead {
+		if letter.ID != taskID {
+			continue
+		}
+
+		task, err := q.registry.Decode(letter.Message)
+		if err != nil {
+			return nil, err
+		}
+		if rt, ok := task.(RetryableTask); ok {
+			rt.SetAttempts(0)
+		}
+		e, err := q.entry(task)
+		if err != nil {
+			return nil, err
+		}
+
+		q.dead = append(q.dead[:i], q.dead[i+1:]...)
+		q.push(e)
+		q.changed()
+		return task, nil
+	}
+	return nil, nil
+}
+
+// PurgeDeadLetters remove all dead letters
+func (q *MemoryQueue) PurgeDeadLetters(ctx context.Context) (int64, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	n := int64(len(q.dead))
+	q.dead = nil
+	q.changed()
+	return n, nil
+}
+
+// LaneSizes size of each lane
+func (q *MemoryQueue) LaneSizes(ctx context.Context) (map[Priority]int64, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	sizes := make(map[Priority]int64, len(priorities))
+	for _, p := range priorities {
+		sizes[p] = int64(len(q.ready[p]))
+	}
+	return sizes, nil
+}
+
+// changed update metrics and schedule a write of the state, q.mu must be held. The returned
+// write includes the change, write errors are logged.
+func (q *MemoryQueue) changed() *memoryFlush {
+	for _, p := range priorities {
+		metrics.SetQueueSize(string(p), len(q.ready[p]))
+	}
+	metrics.SetScheduledTasks(len(q.delayed))
+
+	if q.persistPath == "" {
+		return flushed
+	}
+	q.dirty = true
+	if !q.flushing {
+		q.flushing = true
+		go q.flushLoop()
+	}
+	return q.next
+}
+
+// flushLoop write the state until no changes are left, all changes made during a write are
+// written by the next one
+func (q *MemoryQueue) flushLoop() {
+	for {
+		q.mu.Lock()
+		if !q.dirty {
+			q.flushing = false
+			q.current = nil
+			q.mu.Unlock()
+			return
+		}
+		f := q.next
+		q.current, q.next, q.dirty = f, newMemoryFlush(), false
+		data, err := q.snapshot()
+		q.mu.Unlock()
+
+		if err == nil {
+			err = q.write(data)
+		}
+		if err != nil {
+			log.Printf("failed to persist memory queue, error: %v", err)
+		}
+		f.err = err
+		close(f.done)
+	}
+}
+
+// Flush wait until the changes made so far are written, it should be called before the
+// process exits
+func (q *MemoryQueue) Flush() error {
+	q.mu.Lock()
+	f := flushed
+	switch {
+	case q.dirty:
+		f = q.next
+	case q.flushing:
+		f = q.current
+	}
+	q.mu.Unlock()
+	return f.wait()
+}
+
+// snapshot encode the state, q.mu must be held
+func (q *MemoryQueue) snapshot() ([]byte, error) {
+	snapshot := memorySnapshot{
+		Ready:    q.ready,
+		Inflight: append(make([]*memoryEntry, 0, len(q.inflight)+len(q.recovered)), q.recovered...),
+		Delayed:  q.delayed,
+		Dead:     q.dead,
+	}
+	for _, e := range q.inflight {
+		snapshot.Inflight = append(snapshot.Inflight, e)
+	}
+
+	data, err := json.Marshal(&snapshot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal queue state, error: %w", err)
+	}
+	return data, nil
+}
+
+// write write the state to a temp file and rename it
+func (q *MemoryQueue) write(data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(q.persistPath), filepath.Base(q.persistPath)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to persist queue state, error: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to persist queue state, error: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to persist queue state, error: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to persist queue state, error: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), q.persistPath); err != nil {
+		return fmt.Errorf("failed to persist queue state, error: %w", err)
+	}
+	return nil
+}
+
+// load restore the state from the persist file
+func (q *MemoryQueue) load() error {
+	if q.persistPath == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(q.persistPath), 0o755); err != nil {
+		return fmt.Errorf("failed to create queue state dir, error: %w", err)
+	}
+
+	data, err := os.ReadFile(q.persistPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read queue state, error: %w", err)
+	}
+
+	var snapshot memorySnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return fmt.Errorf("failed to unmarshal queue state, error: %w", err)
+	}
+
+	if snapshot.Ready != nil {
+		q.ready = snapshot.Ready
+	}
+	q.recovered = snapshot.Inflight
+	q.delayed = snapshot.Delayed
+	sort.SliceStable(q.delayed, func(i, j int) bool { return q.delayed[i].RunAt.Before(q.delayed[j].RunAt) })
+	q.dead = snapshot.Dead
+	return nil
+}
@@ -0,0 +1,214 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryQueue(t *testing.T) {
+	ctx := context.Background()
+	q, err := NewMemoryQueue(WithCapacity(2), WithRetry(1, time.Millisecond))
+	require.NoError(t, err)
+
+	// 容量限制
+	require.NoError(t, q.Enqueue(ctx, &MockTask{ID: "1"}))
+	require.NoError(t, q.Enqueue(ctx, &PriorityMockTask{ID: "2", Priority: PriorityHigh}))
+	assert.True(t, errors.Is(q.Enqueue(ctx, &MockTask{ID: "3"}), ErrFull))
+
+	// 高优先级先出队
+	task, err := q.Dequeue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "2", task.GetID())
+	require.NoError(t, q.Ack(ctx, task))
+	assert.Error(t, q.Ack(ctx, task))
+
+	// 阻塞的消费者在入队后被唤醒
+	done := make(chan Task)
+	go func() {
+		task, _ := q.Dequeue(ctx)
+		task2, _ := q.Dequeue(ctx)
+		done <- task
+		done <- task2
+	}()
+	require.NoError(t, q.Enqueue(ctx, &RetryableMockTask{ID: "4"}))
+	assert.Equal(t, "1", (<-done).GetID())
+	retryable := <-done
+	assert.Equal(t, "4", retryable.GetID())
+
+	// 失败后进入延迟队列，重试耗尽后进入死信队列
+	dead, err := q.Nack(ctx, retryable, errors.New("boom"))
+	require.NoError(t, err)
+	assert.False(t, dead)
+	time.Sleep(5 * time.Millisecond)
+	n, err := q.PromoteDue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	retryable, err = q.Dequeue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, retryable.(*RetryableMockTask).Attempts)
+	dead, err = q.Nack(ctx, retryable, errors.New("boom"))
+	require.NoError(t, err)
+	assert.True(t, dead)
+
+	letters, total, err := q.DeadLetters(ctx, 0, 10)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), total)
+	assert.Equal(t, "4", letters[0].ID)
+	assert.Equal(t, "boom", letters[0].Error)
+
+	task, err = q.RequeueDeadLetter(ctx, "4")
+	require.NoError(t, err)
+	assert.Equal(t, 0, task.(*RetryableMockTask).Attempts)
+	sizes, err := q.LaneSizes(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), sizes[PriorityNormal])
+}
+
+// TestMemoryQueueNoReap 测试执行时间超过可见性超时的任务不会被再次投递
+func TestMemoryQueueNoReap(t *testing.T) {
+	ctx := context.Background()
+	q, err := NewMemoryQueue(WithVisibilityTimeout(time.Millisecond))
+	require.NoError(t, err)
+
+	// 空队列在超时后返回 ErrEmpty
+	timeoutCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	_, err = q.Dequeue(timeoutCtx)
+	cancel()
+	assert.ErrorIs(t, err, ErrEmpty)
+
+	require.NoError(t, q.Enqueue(ctx, &MockTask{ID: "1"}))
+	task, err := q.Dequeue(ctx)
+	require.NoError(t, err)
+
+	reapCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	q.RunReaper(reapCtx, time.Millisecond)
+	<-reapCtx.Done()
+	cancel()
+
+	timeoutCtx, cancel = context.WithTimeout(ctx, 20*time.Millisecond)
+	_, err = q.Dequeue(timeoutCtx)
+	cancel()
+	assert.ErrorIs(t, err, ErrEmpty)
+	require.NoError(t, q.Ack(ctx, task))
+}
+
+func TestMemoryQueuePersistence(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "queue.json")
+
+	q, err := NewMemoryQueue(WithPersistence(path))
+	require.NoError(t, err)
+	require.NoError(t, q.Enqueue(ctx, &MockTask{ID: "1"}))
+	require.NoError(t, q.Enqueue(ctx, &PriorityMockTask{ID: "2", Priority: PriorityLow}))
+	require.NoError(t, q.Schedule(ctx, &MockTask{ID: "3"}, time.Now().Add(time.Hour)))
+	task, err := q.Dequeue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "1", task.GetID())
+	require.NoError(t, q.Flush())
+
+	// 重启后恢复未确认、待处理和延迟的任务
+	q, err = NewMemoryQueue(WithPersistence(path))
+	require.NoError(t, err)
+	n, err := q.Recover(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	sizes, err := q.LaneSizes(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), sizes[PriorityNormal])
+	assert.Equal(t, int64(1), sizes[PriorityLow])
+
+	scheduled, total, err := q.ScheduledTasks(ctx, 0, 10)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), total)
+	assert.Equal(t, "3", scheduled[0].ID)
+
+	ok, err := q.CancelScheduled(ctx, "3")
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = q.Remove(ctx, "2")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	sizes, err = q.LaneSizes(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), sizes[PriorityLow])
+}
+
+func TestMemoryQueueRelease(t *testing.T) {
+	ctx := context.Background()
+	q, err := NewMemoryQueue()
+	require.NoError(t, err)
+
+	require.NoError(t, q.Enqueue(ctx, &RetryableMockTask{ID: "1"}))
+	require.NoError(t, q.Enqueue(ctx, &RetryableMockTask{ID: "2"}))
+	task, err := q.Dequeue(ctx)
+	require.NoError(t, err)
+
+	// 释放的任务回到队首，且不计入重试次数
+	require.NoError(t, q.Release(ctx, task))
+	assert.Error(t, q.Ack(ctx, task))
+	task, err = q.Dequeue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "1", task.GetID())
+	assert.Equal(t, 0, task.(*RetryableMockTask).Attempts)
+}
+
+// TestMemoryQueuePersistBatched 测试并发修改合并写入，Flush 后文件包含全部修改
+func TestMemoryQueuePersistBatched(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "queue.json")
+	q, err := NewMemoryQueue(WithPersistence(path))
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			assert.NoError(t, q.Enqueue(ctx, &MockTask{ID: fmt.Sprint(i)}))
+		}(i)
+	}
+	wg.Wait()
+	for i := 0; i < 10; i++ {
+		task, err := q.Dequeue(ctx)
+		require.NoError(t, err)
+		require.NoError(t, q.Ack(ctx, task))
+	}
+	require.NoError(t, q.Flush())
+
+	q, err = NewMemoryQueue(WithPersistence(path))
+	require.NoError(t, err)
+	sizes, err := q.LaneSizes(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(40), sizes[PriorityNormal])
+}
+
+// TestMemoryQueuePersistFailure 测试写入失败时已出队的任务仍然交给消费者执行
+func TestMemoryQueuePersistFailure(t *testing.T) {
+	ctx := context.Background()
+	dir := filepath.Join(t.TempDir(), "state")
+	q, err := NewMemoryQueue(WithPersistence(filepath.Join(dir, "queue.json")))
+	require.NoError(t, err)
+	require.NoError(t, q.Enqueue(ctx, &MockTask{ID: "1"}))
+
+	require.NoError(t, os.RemoveAll(dir))
+	task, err := q.Dequeue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "1", task.GetID())
+	require.NoError(t, q.Ack(ctx, task))
+	assert.Error(t, q.Flush())
+
+	// 新任务写入失败时返回错误
+	assert.Error(t, q.Enqueue(ctx, &MockTask{ID: "2"}))
+}
@@ -0,0 +1,148 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Priority task priority, each priority has its own lane
+type Priority string
+
+const (
+	PriorityHigh   Priority = "high"
+	PriorityNormal Priority = "normal"
+	PriorityLow    Priority = "low"
+)
+
+// priorities lanes ordered from high to low
+var priorities = []Priority{PriorityHigh, PriorityNormal, PriorityLow}
+
+// ParsePriority parse priority, empty means normal
+func ParsePriority(s string) (Priority, error) {
+	switch p := Priority(s); p {
+	case "":
+		return PriorityNormal, nil
+	case PriorityHigh, PriorityNormal, PriorityLow:
+		return p, nil
+	default:
+		return "", fmt.Errorf("invalid priority: %s", s)
+	}
+}
+
+// PrioritizedTask task with priority, tasks not implementing it go to the normal lane
+type PrioritizedTask interface {
+	Task
+	GetPriority() Priority
+}
+
+func priorityOf(task Task) Priority {
+	if pt, ok := task.(PrioritizedTask); ok {
+		if p, err := ParsePriority(string(pt.GetPriority())); err == nil {
+			return p
+		}
+	}
+	return PriorityNormal
+}
+
+// Weights dequeue weights of lanes, a lane with weight w is picked first w times out of the sum
+// of weights, so lower lanes still make progress while higher lanes are busy
+type Weights struct {
+	High   int
+	Normal int
+	Low    int
+}
+
+var defaultWeights = Weights{High: 6, Normal: 3, Low: 1}
+
+func (w Weights) of(p Priority) int {
+	switch p {
+	case PriorityHigh:
+		return w.High
+	case PriorityLow:
+		return w.Low
+	default:
+		return w.Normal
+	}
+}
+
+// laneKey redis list of the lane, the normal lane keeps the queue key for compatibility
+func (q *RedisQueue) laneKey(p Priority) string {
+	if p == PriorityNormal {
+		return q.queueKey
+	}
+	return q.queueKey + ":" + string(p)
+}
+
+func (q *RedisQueue) laneKeys() []string {
+	keys := make([]string, 0, len(priorities))
+	for _, p := range priorities {
+		keys = append(keys, q.laneKey(p))
+	}
+	return keys
+}
+
+// laneSelector pick lanes by smooth weighted round robin
+type laneSelector struct {
+	weights Weights
+	mu      sync.Mutex
+	current [3]int // indexed as priorities
+}
+
+// next lanes in dequeue order, the picked lane first and the rest from high to low
+func (s *laneSelector) next() []Priority {
+	s.mu.Lock()
+	picked, total := -1, 0
+	for i, p := range priorities {
+		w := s.weights.of(p)
+		total += w
+		s.current[i] += w
+		if w > 0 && (picked < 0 || s.current[i] > s.current[picked]) {
+			picked = i
+		}
+	}
+	if picked >= 0 {
+		s.current[picked] -= total
+	}
+	s.mu.Unlock()
+
+	if picked <= 0 {
+		return priorities
+	}
+	ordered := append([]Priority{priorities[picked]}, priorities[:picked]...)
+	return append(ordered, priorities[picked+1:]...)
+}
+
+// nextLanes lane keys in dequeue order
+func (q *RedisQueue) nextLanes() []string {
+	lanes := q.lanes.next()
+	keys := make([]string, 0, len(lanes))
+	for _, p := range lanes {
+		keys = append(keys, q.laneKey(p))
+	}
+	return keys
+}
+
+// LaneSizes size of each lane
+func (q *RedisQueue) LaneSizes(ctx context.Context) (map[Priority]int64, error) {
+	if q.fair {
+		return q.fairLaneSizes(ctx)
+	}
+
+	cmds := make([]*redis.IntCmd, len(priorities))
+	pipe := q.client.Pipeline()
+	for i, p := range priorities {
+		cmds[i] = pipe.LLen(ctx, q.laneKey(p))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("failed to get lane sizes, error: %w", err)
+	}
+
+	sizes := make(map[Priority]int64, len(priorities))
+	for i, p := range priorities {
+		sizes[p] = cmds[i].Val()
+	}
+	return sizes, nil
+}
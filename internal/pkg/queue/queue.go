@@ -2,79 +2,400 @@ package queue
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 	"github.com/xmualex2023/i18n-translation/internal/pkg/metrics"
 )
 
-// Task task interface
+var ErrEmpty = errors.New("queue is empty")
+
+// ErrLeaseLost the lease of a dequeued task expired and the task was delivered again
+var ErrLeaseLost = errors.New("lease of the task is lost")
+
+// Task task interface, concrete task types should be registered by Register
 type Task interface {
 	GetID() string
 }
 
+// RetryableTask task which records its failed attempts.
+// Tasks not implementing it are moved to the dead letter queue on first failure.
+type RetryableTask interface {
+	Task
+	GetAttempts() int
+	SetAttempts(attempts int)
+	// GetMaxRetries max retries of the task, 0 means the default of the queue
+	GetMaxRetries() int
+}
+
 // Queue queue interface
 type Queue interface {
 	Enqueue(ctx context.Context, task Task) error
 	Dequeue(ctx context.Context) (Task, error)
+	// Ack acknowledge the dequeued task is handled, it won't be delivered again
+	Ack(ctx context.Context, task Task) error
+	// Nack report the dequeued task failed, it is retried with backoff, or moved to the
+	// dead letter queue once its retries are exhausted, in which case true is returned
+	Nack(ctx context.Context, task Task, cause error) (bool, error)
+	// Release return the dequeued task to the head of the queue without counting an attempt,
+	// e.g. it was interrupted by shutdown
+	Release(ctx context.Context, task Task) error
+}
+
+// Backend queue backend with background maintenance
+type Backend interface {
+	Queue
+	// Recover return tasks left in flight by the previous run of the consumer, it should be
+	// called before consuming
+	Recover(ctx context.Context) (int, error)
+	// RunReaper return tasks unacknowledged for longer than the visibility timeout to the
+	// queue periodically until ctx is done
+	RunReaper(ctx context.Context, interval time.Duration)
+	// RunScheduler promote due delayed tasks periodically until ctx is done
+	RunScheduler(ctx context.Context, interval time.Duration)
+}
+
+// Remover queue which can remove tasks not delivered yet, including delayed ones.
+// Tasks in flight are not affected.
+type Remover interface {
+	Remove(ctx context.Context, taskID string) (bool, error)
+}
+
+// Flusher queue which writes its state in the background
+type Flusher interface {
+	// Flush wait until the changes made so far are written
+	Flush() error
+}
+
+// Extender queue which leases dequeued tasks for the visibility timeout
+type Extender interface {
+	// Extend renew the lease of a dequeued task, so it isn't delivered again while it's still
+	// being handled. ErrLeaseLost is returned if the lease expired already.
+	Extend(ctx context.Context, task Task) error
+}
+
+// ConsumerReporter queue which reports pending tasks of each consumer
+type ConsumerReporter interface {
+	Consumers(ctx context.Context) (map[string]int64, error)
 }
 
-// RedisQueue redis queue implementation
+// RedisQueue redis list queue implementation.
+// By default tasks are removed from redis once dequeued, in reliable mode tasks are moved into
+// a per-consumer processing list with a lease, and stay there until Ack or Nack. Tasks whose
+// lease expired, e.g. the consumer crashed, are returned to the queue by the reaper.
+// All keys share the hash tag of the queue key, so they're in a single redis cluster slot and
+// lua scripts may touch keys derived from the declared ones, e.g. processing lists.
 type RedisQueue struct {
 	client     *redis.Client
 	queueKey   string
+	registry   *Registry
 	retryCount int
 	retryDelay time.Duration
+
+	lanes       *laneSelector
+	delayed     *delayStore
+	deadLetters *deadLetterStore
+
+	// fair mode
+	fair       bool
+	maxRunning int
+	running    map[string]string // task id -> owner, slots refreshed by the consumer
+
+	// reliable mode
+	reliable          bool
+	consumer          string
+	visibilityTimeout time.Duration
+	mu                sync.Mutex
+	inflight          map[string]string // task id -> raw message
 }
 
-func NewRedisQueue(client *redis.Client, queueKey string) *RedisQueue {
+// options options shared by queue backends
+type options struct {
+	registry          *Registry
+	retryCount        int
+	retryDelay        time.Duration
+	weights           Weights
+	reliable          bool
+	consumer          string
+	visibilityTimeout time.Duration
+	maxLen            int64
+	capacity          int
+	persistPath       string
+	fair              bool
+	maxRunning        int
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{
+		registry:          DefaultRegistry,
+		retryCount:        3,
+		retryDelay:        5 * time.Second,
+		weights:           defaultWeights,
+		visibilityTimeout: 5 * time.Minute,
+		maxLen:            100000,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// Option queue option
+type Option func(*options)
+
+// WithRegistry set task type registry, DefaultRegistry is used by default
+func WithRegistry(registry *Registry) Option {
+	return func(o *options) {
+		o.registry = registry
+	}
+}
+
+// WithRetry set default max retries and the base delay of exponential backoff
+func WithRetry(count int, delay time.Duration) Option {
+	return func(o *options) {
+		o.retryCount = count
+		o.retryDelay = delay
+	}
+}
+
+// WithPriorityWeights set dequeue weights of priority lanes
+func WithPriorityWeights(weights Weights) Option {
+	return func(o *options) {
+		o.weights = weights
+	}
+}
+
+// WithReliable enable reliable mode of RedisQueue, consumer should be unique and stable
+// across restarts
+func WithReliable(consumer string, visibilityTimeout time.Duration) Option {
+	return func(o *options) {
+		o.reliable = true
+		o.consumer = consumer
+		o.visibilityTimeout = visibilityTimeout
+	}
+}
+
+// WithVisibilityTimeout set how long a dequeued task may stay unacknowledged before it's
+// delivered again
+func WithVisibilityTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.visibilityTimeout = timeout
+	}
+}
+
+// WithMaxLen set max length of StreamQueue streams, Enqueue fails with ErrFull once reached.
+// Zero means no limit.
+func WithMaxLen(maxLen int64) Option {
+	return func(o *options) {
+		o.maxLen = maxLen
+	}
+}
+
+func NewRedisQueue(client *redis.Client, queueKey string, opts ...Option) *RedisQueue {
+	o := newOptions(opts)
+	queueKey = hashTag(queueKey)
 	return &RedisQueue{
-		client:     client,
-		queueKey:   queueKey,
-		retryCount: 3,
-		retryDelay: 5 * time.Second,
+		client:            client,
+		queueKey:          queueKey,
+		registry:          o.registry,
+		retryCount:        o.retryCount,
+		retryDelay:        o.retryDelay,
+		lanes:             &laneSelector{weights: o.weights},
+		delayed:           &delayStore{client: client, registry: o.registry, key: queueKey + ":delayed"},
+		deadLetters:       &deadLetterStore{client: client, registry: o.registry, key: queueKey + ":dead"},
+		fair:              o.fair,
+		maxRunning:        o.maxRunning,
+		running:           make(map[string]string),
+		reliable:          o.reliable,
+		consumer:          o.consumer,
+		visibilityTimeout: o.visibilityTimeout,
+		inflight:          make(map[string]string),
 	}
 }
 
-// Enqueue add task to queue
+// hashTag wrap key in a redis cluster hash tag, unless it has one
+func hashTag(key string) string {
+	if i := strings.IndexByte(key, '{'); i >= 0 && strings.IndexByte(key[i+1:], '}') > 0 {
+		return key
+	}
+	return "{" + key + "}"
+}
+
+// Enqueue add task to the lane of its priority
 func (q *RedisQueue) Enqueue(ctx context.Context, task Task) error {
-	data, err := json.Marshal(task)
+	data, err := q.registry.Encode(task)
 	if err != nil {
-		return fmt.Errorf("failed to marshal task, error: %w", err)
+		return err
 	}
 
-	if err := q.client.LPush(ctx, q.queueKey, data).Err(); err != nil {
+	if err := q.client.LPush(ctx, q.laneKey(priorityOf(task)), data).Err(); err != nil {
 		return fmt.Errorf("failed to enqueue task, error: %w", err)
 	}
 
-	// update queue size
-	size, err := q.client.LLen(ctx, q.queueKey).Result()
-	if err == nil {
-		metrics.SetQueueSize(int(size))
-	}
+	q.updateQueueSize(ctx)
 
 	return nil
 }
 
-// Dequeue get task from queue
+// Dequeue get task from queue by weighted priority, blocks until a task is available or
+// the deadline of ctx is reached, in which case ErrEmpty is returned
 func (q *RedisQueue) Dequeue(ctx context.Context) (Task, error) {
-	result, err := q.client.BRPop(ctx, 0, q.queueKey).Result()
+	if q.reliable {
+		return q.dequeueReliable(ctx)
+	}
+	if q.fair {
+		raw, err := q.moveFair(ctx)
+		if err != nil {
+			return nil, err
+		}
+		q.updateQueueSize(ctx)
+		task, err := q.registry.Decode([]byte(raw))
+		if err != nil {
+			return nil, err
+		}
+		q.holdSlot(task)
+		return task, nil
+	}
+
+	timeout, err := blockTimeout(ctx)
 	if err != nil {
+		return nil, err
+	}
+
+	// BRPOP pops from the first non-empty lane
+	result, err := q.client.BRPop(ctx, timeout, q.nextLanes()...).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, ErrEmpty
+		}
 		return nil, fmt.Errorf("failed to dequeue task, error: %w", err)
 	}
 
-	// update queue size
-	size, err := q.client.LLen(ctx, q.queueKey).Result()
-	if err == nil {
-		metrics.SetQueueSize(int(size))
+	q.updateQueueSize(ctx)
+
+	return q.registry.Decode([]byte(result[1]))
+}
+
+// Ack acknowledge task, only frees the running slot if not in reliable mode
+func (q *RedisQueue) Ack(ctx context.Context, task Task) error {
+	q.releaseSlot(ctx, task)
+	if !q.reliable {
+		return nil
+	}
+
+	raw, ok := q.takeInflight(task)
+	if !ok {
+		return fmt.Errorf("task not in flight, taskID: %s", task.GetID())
+	}
+
+	if err := ackScript.Run(ctx, q.client, []string{q.processingKey(), q.leaseKey()}, raw, q.leaseMember(raw)).Err(); err != nil {
+		return fmt.Errorf("failed to ack task, taskID: %s, error: %w", task.GetID(), err)
+	}
+	return nil
+}
+
+// Remove remove task waiting in the lanes or the delay queue
+func (q *RedisQueue) Remove(ctx context.Context, taskID string) (bool, error) {
+	keys := q.laneKeys()
+	if q.fair {
+		ownerKeys, err := q.ownerKeys(ctx)
+		if err != nil {
+			return false, err
+		}
+		keys = append(keys, ownerKeys...)
+	}
+	for _, key := range keys {
+		removed, err := q.removeFromLane(ctx, key, taskID)
+		if err != nil || removed {
+			q.updateQueueSize(ctx)
+			return removed, err
+		}
+	}
+	return q.delayed.cancel(ctx, taskID)
+}
+
+func (q *RedisQueue) removeFromLane(ctx context.Context, key, taskID string) (bool, error) {
+	for start := int64(0); ; start += scanBatchSize {
+		members, err := q.client.LRange(ctx, key, start, start+scanBatchSize-1).Result()
+		if err != nil {
+			return false, fmt.Errorf("failed to list queued tasks, error: %w", err)
+		}
+
+		for _, raw := range members {
+			task, err := q.registry.Decode([]byte(raw))
+			if err != nil || task.GetID() != taskID {
+				continue
+			}
+
+			removed, err := q.client.LRem(ctx, key, 1, raw).Result()
+			if err != nil {
+				return false, fmt.Errorf("failed to remove task, taskID: %s, error: %w", taskID, err)
+			}
+			// 0 if dequeued concurrently
+			return removed > 0, nil
+		}
+
+		if len(members) < scanBatchSize {
+			return false, nil
+		}
 	}
+}
 
-	var task Task
-	if err := json.Unmarshal([]byte(result[1]), &task); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal task, error: %w", err)
+// Release return task to the head of its lane
+func (q *RedisQueue) Release(ctx context.Context, task Task) error {
+	q.releaseSlot(ctx, task)
+	lane := q.laneKey(priorityOf(task))
+	if !q.reliable {
+		data, err := q.registry.Encode(task)
+		if err != nil {
+			return err
+		}
+		if err := q.client.RPush(ctx, lane, data).Err(); err != nil {
+			return fmt.Errorf("failed to release task, taskID: %s, error: %w", task.GetID(), err)
+		}
+		q.updateQueueSize(ctx)
+		return nil
 	}
 
-	return task, nil
+	raw, ok := q.takeInflight(task)
+	if !ok {
+		return fmt.Errorf("task not in flight, taskID: %s", task.GetID())
+	}
+	if err := releaseScript.Run(ctx, q.client, []string{q.processingKey(), q.leaseKey(), lane}, raw, q.leaseMember(raw)).Err(); err != nil {
+		return fmt.Errorf("failed to release task, taskID: %s, error: %w", task.GetID(), err)
+	}
+	q.updateQueueSize(ctx)
+	return nil
+}
+
+func (q *RedisQueue) updateQueueSize(ctx context.Context) {
+	sizes, err := q.LaneSizes(ctx)
+	if err != nil {
+		return
+	}
+	for p, size := range sizes {
+		metrics.SetQueueSize(string(p), int(size))
+	}
+}
+
+// blockTimeout timeout of blocking commands derived from ctx deadline, 0 means block forever.
+// Blocking commands don't follow ctx deadline, and only support timeouts in whole seconds.
+func blockTimeout(ctx context.Context) (time.Duration, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0, nil
+	}
+	timeout := time.Until(deadline).Truncate(time.Second)
+	if timeout < time.Second {
+		timeout = time.Second
+	}
+	return timeout, nil
 }
@@ -21,6 +21,33 @@ func (t *MockTask) GetID() string {
 	return t.ID
 }
 
+// RetryableMockTask 记录重试次数的测试任务
+type RetryableMockTask struct {
+	ID         string `json:"id"`
+	Attempts   int    `json:"attempts"`
+	MaxRetries int    `json:"max_retries"`
+}
+
+func (t *RetryableMockTask) GetID() string            { return t.ID }
+func (t *RetryableMockTask) GetAttempts() int         { return t.Attempts }
+func (t *RetryableMockTask) SetAttempts(attempts int) { t.Attempts = attempts }
+func (t *RetryableMockTask) GetMaxRetries() int       { return t.MaxRetries }
+
+// PriorityMockTask 带优先级的测试任务
+type PriorityMockTask struct {
+	ID       string   `json:"id"`
+	Priority Priority `json:"priority"`
+}
+
+func (t *PriorityMockTask) GetID() string         { return t.ID }
+func (t *PriorityMockTask) GetPriority() Priority { return t.Priority }
+
+func init() {
+	Register("mock", 1, func() Task { return &MockTask{} })
+	Register("priority_mock", 1, func() Task { return &PriorityMockTask{} })
+	Register("retryable_mock", 1, func() Task { return &RetryableMockTask{} })
+}
+
 // setupTestRedis 创建测试用的 Redis 实例
 func setupTestRedis(t *testing.T) (*redis.Client, func()) {
 	mr, err := miniredis.Run()
@@ -156,7 +183,10 @@ func TestNewRedisQueue(t *testing.T) {
 
 	queue := NewRedisQueue(client, "test_queue")
 	assert.NotNil(t, queue)
-	assert.Equal(t, "test_queue", queue.queueKey)
+	// 所有 key 位于同一个 hash tag 下，已有 hash tag 的 key 保持不变
+	assert.Equal(t, "{test_queue}", queue.queueKey)
+	assert.Equal(t, "{test_queue}:processing:", queue.processingKeyPrefix())
+	assert.Equal(t, "app:{tasks}", NewRedisQueue(client, "app:{tasks}").queueKey)
 	assert.Equal(t, 3, queue.retryCount)
 	assert.Equal(t, 5*time.Second, queue.retryDelay)
 }
@@ -192,3 +222,403 @@ func TestQueueSize(t *testing.T) {
 		assert.Equal(t, int64(i-1), size)
 	}
 }
+
+// TestReliableQueue 测试可靠模式下的确认、重新入队和租约回收
+func TestReliableQueue(t *testing.T) {
+	client, cleanup := setupTestRedis(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	queue := NewRedisQueue(client, "test_queue",
+		WithReliable("consumer1", 50*time.Millisecond), WithRetry(3, 10*time.Millisecond))
+
+	countOf := func(key string) int64 {
+		n, err := client.LLen(ctx, key).Result()
+		require.NoError(t, err)
+		return n
+	}
+	leases := func() int64 {
+		n, err := client.ZCard(ctx, queue.leaseKey()).Result()
+		require.NoError(t, err)
+		return n
+	}
+
+	// 出队后任务进入 processing 列表并持有租约
+	require.NoError(t, queue.Enqueue(ctx, &MockTask{ID: "task1"}))
+	task, err := queue.Dequeue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "task1", task.GetID())
+	assert.Equal(t, int64(0), countOf(queue.queueKey))
+	assert.Equal(t, int64(1), countOf(queue.processingKey()))
+	assert.Equal(t, int64(1), leases())
+
+	// 确认后移除
+	require.NoError(t, queue.Ack(ctx, task))
+	assert.Equal(t, int64(0), countOf(queue.processingKey()))
+	assert.Equal(t, int64(0), leases())
+
+	// Nack 后进入延迟队列，退避时间到期后重新入队
+	require.NoError(t, queue.Enqueue(ctx, &RetryableMockTask{ID: "task2"}))
+	task, err = queue.Dequeue(ctx)
+	require.NoError(t, err)
+	deadLettered, err := queue.Nack(ctx, task, fmt.Errorf("mock error"))
+	require.NoError(t, err)
+	assert.False(t, deadLettered)
+	assert.Equal(t, int64(0), countOf(queue.queueKey))
+	assert.Equal(t, int64(0), countOf(queue.processingKey()))
+	assert.Equal(t, int64(0), leases())
+	delayed, err := client.ZCard(ctx, queue.delayed.key).Result()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), delayed)
+	time.Sleep(20 * time.Millisecond)
+	n, err := queue.PromoteDue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, int64(1), countOf(queue.queueKey))
+	assert.Equal(t, int64(0), countOf(queue.processingKey()))
+	assert.Equal(t, int64(0), leases())
+
+	// 租约过期后被回收
+	task, err = queue.Dequeue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "task2", task.GetID())
+	assert.Equal(t, 1, task.(*RetryableMockTask).Attempts)
+	time.Sleep(60 * time.Millisecond)
+	n, err = queue.ReapExpired(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, int64(1), countOf(queue.queueKey))
+	assert.Equal(t, int64(0), countOf(queue.processingKey()))
+	assert.Equal(t, int64(0), leases())
+
+	// 重启后恢复 processing 列表中的任务
+	_, err = queue.Dequeue(ctx)
+	require.NoError(t, err)
+	restarted := NewRedisQueue(client, "test_queue", WithReliable("consumer1", time.Minute))
+	n, err = restarted.Recover(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, int64(1), countOf(queue.queueKey))
+	assert.Equal(t, int64(0), leases())
+}
+
+// TestReliableQueueExtend 测试续租后任务不会被回收，租约已被回收时返回 ErrLeaseLost
+func TestReliableQueueExtend(t *testing.T) {
+	client, cleanup := setupTestRedis(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	queue := NewRedisQueue(client, "test_queue", WithReliable("consumer1", 50*time.Millisecond))
+
+	require.NoError(t, queue.Enqueue(ctx, &MockTask{ID: "task1"}))
+	task, err := queue.Dequeue(ctx)
+	require.NoError(t, err)
+
+	// 每次续租都推迟到期时间，总时长超过租约时间也不会被回收
+	for i := 0; i < 3; i++ {
+		time.Sleep(30 * time.Millisecond)
+		require.NoError(t, queue.Extend(ctx, task))
+		n, err := queue.ReapExpired(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 0, n)
+	}
+
+	// 停止续租后被回收，再续租返回 ErrLeaseLost
+	time.Sleep(60 * time.Millisecond)
+	n, err := queue.ReapExpired(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.ErrorIs(t, queue.Extend(ctx, task), ErrLeaseLost)
+
+	// 非可靠模式没有租约
+	plain := NewRedisQueue(client, "plain_queue")
+	require.NoError(t, plain.Enqueue(ctx, &MockTask{ID: "task2"}))
+	task, err = plain.Dequeue(ctx)
+	require.NoError(t, err)
+	assert.NoError(t, plain.Extend(ctx, task))
+}
+
+// TestDeadLetter 测试重试耗尽后进入死信队列，以及死信的查看、重新入队和清空
+func TestDeadLetter(t *testing.T) {
+	client, cleanup := setupTestRedis(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	queue := NewRedisQueue(client, "test_queue",
+		WithReliable("consumer1", time.Minute), WithRetry(3, time.Millisecond))
+
+	// 任务自身的重试次数优先于队列默认值
+	require.NoError(t, queue.Enqueue(ctx, &RetryableMockTask{ID: "task1", MaxRetries: 1}))
+	task, err := queue.Dequeue(ctx)
+	require.NoError(t, err)
+	deadLettered, err := queue.Nack(ctx, task, fmt.Errorf("first error"))
+	require.NoError(t, err)
+	assert.False(t, deadLettered)
+
+	time.Sleep(5 * time.Millisecond)
+	_, err = queue.PromoteDue(ctx)
+	require.NoError(t, err)
+	task, err = queue.Dequeue(ctx)
+	require.NoError(t, err)
+	deadLettered, err = queue.Nack(ctx, task, fmt.Errorf("second error"))
+	require.NoError(t, err)
+	assert.True(t, deadLettered)
+
+	// 不支持重试的任务第一次失败即进入死信队列
+	require.NoError(t, queue.Enqueue(ctx, &MockTask{ID: "task2"}))
+	task, err = queue.Dequeue(ctx)
+	require.NoError(t, err)
+	deadLettered, err = queue.Nack(ctx, task, fmt.Errorf("mock error"))
+	require.NoError(t, err)
+	assert.True(t, deadLettered)
+
+	letters, total, err := queue.DeadLetters(ctx, 0, 10)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), total)
+	require.Len(t, letters, 2)
+	assert.Equal(t, "task2", letters[0].ID)
+	assert.Equal(t, "task1", letters[1].ID)
+	assert.Equal(t, "second error", letters[1].Error)
+
+	// 重新入队后重试次数清零
+	requeued, err := queue.RequeueDeadLetter(ctx, "task1")
+	require.NoError(t, err)
+	require.NotNil(t, requeued)
+	task, err = queue.Dequeue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "task1", task.GetID())
+	assert.Equal(t, 0, task.(*RetryableMockTask).Attempts)
+
+	requeued, err = queue.RequeueDeadLetter(ctx, "not_exist")
+	require.NoError(t, err)
+	assert.Nil(t, requeued)
+
+	purged, err := queue.PurgeDeadLetters(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), purged)
+	_, total, err = queue.DeadLetters(ctx, 0, 10)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), total)
+}
+
+// TestDeadLetterTake 测试按任务 id 取出死信，跨多个扫描批次，id 为前缀的其他任务不受影响
+func TestDeadLetterTake(t *testing.T) {
+	client, cleanup := setupTestRedis(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	store := &deadLetterStore{client: client, registry: DefaultRegistry, key: "dead"}
+	for i := 0; i < 2*takeChunkSize+10; i++ {
+		entry, err := store.entry(&RetryableMockTask{ID: fmt.Sprintf("task%d", i), Attempts: 3}, fmt.Errorf("mock error"))
+		require.NoError(t, err)
+		require.NoError(t, client.LPush(ctx, store.key, entry).Err())
+	}
+
+	// 最早的死信位于列表末尾
+	task, err := store.take(ctx, "task1")
+	require.NoError(t, err)
+	require.NotNil(t, task)
+	assert.Equal(t, "task1", task.GetID())
+	assert.Equal(t, 0, task.(*RetryableMockTask).Attempts)
+
+	task, err = store.take(ctx, "task1")
+	require.NoError(t, err)
+	assert.Nil(t, task)
+	task, err = store.take(ctx, "task10")
+	require.NoError(t, err)
+	require.NotNil(t, task)
+	assert.Equal(t, "task10", task.GetID())
+
+	purged, err := store.purge(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2*takeChunkSize+8), purged)
+	assert.Equal(t, int64(0), client.Exists(ctx, store.key).Val())
+}
+
+// TestPriorityLanes 测试按权重从各优先级队列出队，低优先级不会被饿死
+func TestPriorityLanes(t *testing.T) {
+	for _, reliable := range []bool{false, true} {
+		t.Run(fmt.Sprintf("reliable=%v", reliable), func(t *testing.T) {
+			client, cleanup := setupTestRedis(t)
+			defer cleanup()
+
+			ctx := context.Background()
+			opts := []Option{WithPriorityWeights(Weights{High: 6, Normal: 3, Low: 1})}
+			if reliable {
+				opts = append(opts, WithReliable("consumer1", time.Minute))
+			}
+			queue := NewRedisQueue(client, "test_queue", opts...)
+
+			for _, p := range priorities {
+				for i := 0; i < 10; i++ {
+					task := &PriorityMockTask{ID: fmt.Sprintf("%s%d", p, i), Priority: p}
+					require.NoError(t, queue.Enqueue(ctx, task))
+				}
+			}
+
+			sizes, err := queue.LaneSizes(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, map[Priority]int64{PriorityHigh: 10, PriorityNormal: 10, PriorityLow: 10}, sizes)
+
+			// 一轮 10 次出队按 6:3:1 分配
+			counts := map[Priority]int{}
+			for i := 0; i < 10; i++ {
+				task, err := queue.Dequeue(ctx)
+				require.NoError(t, err)
+				counts[task.(*PriorityMockTask).Priority]++
+			}
+			assert.Equal(t, map[Priority]int{PriorityHigh: 6, PriorityNormal: 3, PriorityLow: 1}, counts)
+
+			// 高优先级为空时其他队列继续出队
+			for i := 0; i < 20; i++ {
+				_, err := queue.Dequeue(ctx)
+				require.NoError(t, err)
+			}
+			sizes, err = queue.LaneSizes(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, map[Priority]int64{PriorityHigh: 0, PriorityNormal: 0, PriorityLow: 0}, sizes)
+		})
+	}
+}
+
+// TestPriorityRecover 测试可靠模式下回收的任务回到原优先级队列
+func TestPriorityRecover(t *testing.T) {
+	client, cleanup := setupTestRedis(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	queue := NewRedisQueue(client, "test_queue", WithReliable("consumer1", 10*time.Millisecond))
+
+	require.NoError(t, queue.Enqueue(ctx, &PriorityMockTask{ID: "high", Priority: PriorityHigh}))
+	require.NoError(t, queue.Enqueue(ctx, &PriorityMockTask{ID: "low", Priority: PriorityLow}))
+	_, err := queue.Dequeue(ctx)
+	require.NoError(t, err)
+	_, err = queue.Dequeue(ctx)
+	require.NoError(t, err)
+
+	time.Sleep(20 * time.Millisecond)
+	n, err := queue.ReapExpired(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	sizes, err := queue.LaneSizes(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, map[Priority]int64{PriorityHigh: 1, PriorityNormal: 0, PriorityLow: 1}, sizes)
+
+	// 重启恢复同样回到原优先级队列
+	_, err = queue.Dequeue(ctx)
+	require.NoError(t, err)
+	restarted := NewRedisQueue(client, "test_queue", WithReliable("consumer1", time.Minute))
+	n, err = restarted.Recover(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	sizes, err = queue.LaneSizes(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, map[Priority]int64{PriorityHigh: 1, PriorityNormal: 0, PriorityLow: 1}, sizes)
+}
+
+// TestScheduler 测试延迟任务的调度、查看、取消和到期入队
+func TestScheduler(t *testing.T) {
+	client, cleanup := setupTestRedis(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	queue := NewRedisQueue(client, "test_queue")
+
+	// 已到期的任务直接入队
+	require.NoError(t, queue.Schedule(ctx, &MockTask{ID: "now"}, time.Now().Add(-time.Second)))
+	task, err := queue.Dequeue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "now", task.GetID())
+
+	runAt := time.Now().Add(30 * time.Millisecond)
+	require.NoError(t, queue.Schedule(ctx, &PriorityMockTask{ID: "soon", Priority: PriorityHigh}, runAt))
+	require.NoError(t, queue.Schedule(ctx, &MockTask{ID: "later"}, time.Now().Add(time.Hour)))
+	require.NoError(t, queue.Schedule(ctx, &MockTask{ID: "cancelled"}, time.Now().Add(time.Hour)))
+
+	scheduled, total, err := queue.ScheduledTasks(ctx, 0, 10)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), total)
+	require.Len(t, scheduled, 3)
+	assert.Equal(t, "soon", scheduled[0].ID)
+	assert.Equal(t, runAt.UnixMilli(), scheduled[0].RunAt.UnixMilli())
+
+	ok, err := queue.CancelScheduled(ctx, "cancelled")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = queue.CancelScheduled(ctx, "cancelled")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	// 未到期不会入队
+	n, err := queue.PromoteDue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	time.Sleep(40 * time.Millisecond)
+	n, err = queue.PromoteDue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	sizes, err := queue.LaneSizes(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), sizes[PriorityHigh])
+
+	_, total, err = queue.ScheduledTasks(ctx, 0, 10)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), total)
+}
+
+// TestRemove 测试移除尚未出队的任务
+func TestRemove(t *testing.T) {
+	client, cleanup := setupTestRedis(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	queue := NewRedisQueue(client, "test_queue")
+
+	require.NoError(t, queue.Enqueue(ctx, &MockTask{ID: "1"}))
+	require.NoError(t, queue.Enqueue(ctx, &PriorityMockTask{ID: "2", Priority: PriorityLow}))
+	require.NoError(t, queue.Schedule(ctx, &MockTask{ID: "3"}, time.Now().Add(time.Hour)))
+
+	for _, id := range []string{"2", "3"} {
+		ok, err := queue.Remove(ctx, id)
+		require.NoError(t, err)
+		assert.True(t, ok, id)
+	}
+	ok, err := queue.Remove(ctx, "2")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	sizes, err := queue.LaneSizes(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, map[Priority]int64{PriorityHigh: 0, PriorityNormal: 1, PriorityLow: 0}, sizes)
+	_, total, err := queue.ScheduledTasks(ctx, 0, 10)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), total)
+}
+
+// TestRelease 测试释放的任务回到队首并释放租约
+func TestRelease(t *testing.T) {
+	client, cleanup := setupTestRedis(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	queue := NewRedisQueue(client, "test_queue", WithReliable("consumer1", time.Minute))
+
+	require.NoError(t, queue.Enqueue(ctx, &MockTask{ID: "1"}))
+	require.NoError(t, queue.Enqueue(ctx, &MockTask{ID: "2"}))
+	task, err := queue.Dequeue(ctx)
+	require.NoError(t, err)
+	require.NoError(t, queue.Release(ctx, task))
+
+	n, err := client.LLen(ctx, queue.processingKey()).Result()
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), n)
+	n, err = client.ZCard(ctx, queue.leaseKey()).Result()
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), n)
+
+	task, err = queue.Dequeue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "1", task.GetID())
+}
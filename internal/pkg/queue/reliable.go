@@ -0,0 +1,305 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// lease members are "<consumer>\n<raw message>", raw messages are compact JSON without newlines
+
+// ackScript KEYS: processing, leases; ARGV: raw, lease member
+var ackScript = redis.NewScript(`
+redis.call('LREM', KEYS[1], 1, ARGV[1])
+return redis.call('ZREM', KEYS[2], ARGV[2])
+`)
+
+// retryScript move the message from the processing list to the delay queue
+// KEYS: processing, leases, delayed; ARGV: raw, lease member, new raw, run at
+var retryScript = redis.NewScript(`
+redis.call('LREM', KEYS[1], 1, ARGV[1])
+redis.call('ZREM', KEYS[2], ARGV[2])
+return redis.call('ZADD', KEYS[3], ARGV[4], ARGV[3])
+`)
+
+// deadLetterScript KEYS: processing, leases, dead letters; ARGV: raw, lease member, dead letter
+var deadLetterScript = redis.NewScript(`
+redis.call('LREM', KEYS[1], 1, ARGV[1])
+redis.call('ZREM', KEYS[2], ARGV[2])
+return redis.call('LPUSH', KEYS[3], ARGV[3])
+`)
+
+// releaseScript move the message from the processing list back to the head of its lane
+// KEYS: processing, leases, lane; ARGV: raw, lease member
+var releaseScript = redis.NewScript(`
+redis.call('LREM', KEYS[1], 1, ARGV[1])
+redis.call('ZREM', KEYS[2], ARGV[2])
+return redis.call('RPUSH', KEYS[3], ARGV[1])
+`)
+
+// extendScript push the deadline of a lease unless it was reaped already
+// KEYS: leases; ARGV: lease member, deadline
+var extendScript = redis.NewScript(`
+if not redis.call('ZSCORE', KEYS[1], ARGV[1]) then
+	return 0
+end
+redis.call('ZADD', KEYS[1], ARGV[2], ARGV[1])
+return 1
+`)
+
+// laneLua lane of a raw message by the priority of its envelope
+const laneLua = `
+local function lane(raw, normal, high, low)
+	local ok, env = pcall(cjson.decode, raw)
+	if ok and type(env) == 'table' then
+		if env.priority == 'high' then
+			return high
+		elseif env.priority == 'low' then
+			return low
+		end
+	end
+	return normal
+end
+`
+
+// reapScript KEYS: leases, normal lane, high lane, low lane; ARGV: now, processing key prefix, limit.
+// Processing lists of the consumers are derived from the prefix, which has the hash tag of the
+// declared keys, so they're in the same slot.
+var reapScript = redis.NewScript(laneLua + `
+local members = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, tonumber(ARGV[3]))
+for _, member in ipairs(members) do
+	local i = string.find(member, '\n', 1, true)
+	local raw = string.sub(member, i + 1)
+	redis.call('LREM', ARGV[2] .. string.sub(member, 1, i - 1), 1, raw)
+	redis.call('ZREM', KEYS[1], member)
+	redis.call('RPUSH', lane(raw, KEYS[2], KEYS[3], KEYS[4]), raw)
+end
+return #members
+`)
+
+// recoverScript KEYS: processing, leases, normal lane, high lane, low lane; ARGV: consumer
+var recoverScript = redis.NewScript(laneLua + `
+local count = 0
+local raw = redis.call('LPOP', KEYS[1])
+while raw do
+	redis.call('ZREM', KEYS[2], ARGV[1] .. '\n' .. raw)
+	redis.call('RPUSH', lane(raw, KEYS[3], KEYS[4], KEYS[5]), raw)
+	count = count + 1
+	raw = redis.call('LPOP', KEYS[1])
+end
+return count
+`)
+
+const (
+	reapBatchSize = 100
+
+	// laneWaitTimeout max time to block on a single lane before checking the other lanes again
+	laneWaitTimeout = time.Second
+)
+
+func (q *RedisQueue) processingKeyPrefix() string {
+	return q.queueKey + ":processing:"
+}
+
+func (q *RedisQueue) processingKey() string {
+	return q.processingKeyPrefix() + q.consumer
+}
+
+func (q *RedisQueue) leaseKey() string {
+	return q.queueKey + ":leases"
+}
+
+func (q *RedisQueue) leaseMember(raw string) string {
+	return q.consumer + "\n" + raw
+}
+
+// dequeueReliable move task into the processing list of the consumer and lease it
+func (q *RedisQueue) dequeueReliable(ctx context.Context) (Task, error) {
+	raw, err := q.moveReliable(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(q.visibilityTimeout)
+	if err := q.client.ZAdd(ctx, q.leaseKey(), redis.Z{Score: float64(deadline.UnixMilli()), Member: q.leaseMember(raw)}).Err(); err != nil {
+		// still in the processing list, will be recovered after restart
+		return nil, fmt.Errorf("failed to lease task, error: %w", err)
+	}
+
+	q.updateQueueSize(ctx)
+
+	task, err := q.registry.Decode([]byte(raw))
+	if err != nil {
+		// undecodable message would be redelivered forever, drop it
+		log.Printf("drop undecodable task, message: %s, error: %v", raw, err)
+		if ackErr := ackScript.Run(ctx, q.client, []string{q.processingKey(), q.leaseKey()}, raw, q.leaseMember(raw)).Err(); ackErr != nil {
+			log.Printf("failed to drop undecodable task, error: %v", ackErr)
+		}
+		return nil, err
+	}
+
+	q.mu.Lock()
+	q.inflight[task.GetID()] = raw
+	q.mu.Unlock()
+
+	return task, nil
+}
+
+// moveReliable move a message from the lanes by weighted priority into the processing list.
+// BLMOVE only watches a single list, so it blocks on the picked lane for a short while and
+// checks all lanes again.
+func (q *RedisQueue) moveReliable(ctx context.Context) (string, error) {
+	if q.fair {
+		return q.moveFair(ctx)
+	}
+
+	for {
+		lanes := q.nextLanes()
+		for _, lane := range lanes {
+			raw, err := q.client.LMove(ctx, lane, q.processingKey(), "RIGHT", "LEFT").Result()
+			if err == nil {
+				return raw, nil
+			}
+			if err != redis.Nil {
+				return "", fmt.Errorf("failed to dequeue task, error: %w", err)
+			}
+		}
+
+		timeout, err := laneWait(ctx)
+		if err != nil {
+			return "", err
+		}
+
+		raw, err := q.client.BLMove(ctx, lanes[0], q.processingKey(), "RIGHT", "LEFT", timeout).Result()
+		if err == nil {
+			return raw, nil
+		}
+		if err != redis.Nil {
+			return "", fmt.Errorf("failed to dequeue task, error: %w", err)
+		}
+	}
+}
+
+// laneWait how long to block on a single lane before checking all lanes again, ErrEmpty once
+// the deadline of ctx is reached
+func laneWait(ctx context.Context) (time.Duration, error) {
+	if deadline, ok := ctx.Deadline(); ok && !time.Now().Before(deadline) {
+		return 0, ErrEmpty
+	}
+	timeout, err := blockTimeout(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if timeout == 0 || timeout > laneWaitTimeout {
+		timeout = laneWaitTimeout
+	}
+	return timeout, nil
+}
+
+func (q *RedisQueue) takeInflight(task Task) (string, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	raw, ok := q.inflight[task.GetID()]
+	delete(q.inflight, task.GetID())
+	return raw, ok
+}
+
+// Extend push the lease deadline of a dequeued task to the visibility timeout from now, no-op
+// unless in reliable mode
+func (q *RedisQueue) Extend(ctx context.Context, task Task) error {
+	if !q.reliable {
+		return nil
+	}
+
+	q.mu.Lock()
+	raw, ok := q.inflight[task.GetID()]
+	q.mu.Unlock()
+	if !ok {
+		// acknowledged already
+		return nil
+	}
+
+	deadline := strconv.FormatInt(time.Now().Add(q.visibilityTimeout).UnixMilli(), 10)
+	extended, err := extendScript.Run(ctx, q.client, []string{q.leaseKey()}, q.leaseMember(raw), deadline).Int()
+	if err != nil {
+		return fmt.Errorf("failed to extend lease, error: %w", err)
+	}
+	if extended == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+// Recover return tasks left in the processing list of the consumer to the queue,
+// e.g. dequeued before a crash but not leased. It should be called before consuming.
+func (q *RedisQueue) Recover(ctx context.Context) (int, error) {
+	if !q.reliable {
+		return 0, nil
+	}
+
+	keys := append([]string{q.processingKey(), q.leaseKey()}, q.reapLaneKeys()...)
+	count, err := recoverScript.Run(ctx, q.client, keys, q.consumer).Int()
+	if err != nil {
+		return 0, fmt.Errorf("failed to recover tasks, error: %w", err)
+	}
+	return count, nil
+}
+
+// reapLaneKeys lane keys in the order expected by lua scripts: normal, high, low
+func (q *RedisQueue) reapLaneKeys() []string {
+	return []string{q.laneKey(PriorityNormal), q.laneKey(PriorityHigh), q.laneKey(PriorityLow)}
+}
+
+// ReapExpired return tasks whose lease expired to the head of their lanes
+func (q *RedisQueue) ReapExpired(ctx context.Context) (int, error) {
+	total := 0
+	for {
+		now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+		n, err := reapScript.Run(ctx, q.client, append([]string{q.leaseKey()}, q.reapLaneKeys()...), now, q.processingKeyPrefix(), reapBatchSize).Int()
+		if err != nil {
+			return total, fmt.Errorf("failed to reap expired tasks, error: %w", err)
+		}
+		total += n
+		if n < reapBatchSize {
+			return total, nil
+		}
+	}
+}
+
+// RunReaper reap expired tasks periodically until ctx is done. In fair mode without reliable
+// mode, it refreshes the running slots of the consumer instead.
+func (q *RedisQueue) RunReaper(ctx context.Context, interval time.Duration) {
+	if !q.reliable && !q.refreshesSlots() {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if !q.reliable {
+				if err := q.refreshSlots(ctx); err != nil {
+					log.Printf("failed to refresh running slots, error: %v", err)
+				}
+				continue
+			}
+			n, err := q.ReapExpired(ctx)
+			if err != nil {
+				log.Printf("failed to reap expired tasks, error: %v", err)
+				continue
+			}
+			if n > 0 {
+				log.Printf("returned %d expired tasks to queue", n)
+				q.updateQueueSize(ctx)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
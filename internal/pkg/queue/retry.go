@@ -0,0 +1,119 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/xmualex2023/i18n-translation/internal/pkg/metrics"
+)
+
+const maxRetryDelay = 10 * time.Minute
+
+// nextRetry record the failed attempt on the task, and return the backoff before retrying it,
+// or false if its retries are exhausted. Tasks not implementing RetryableTask are never retried.
+func nextRetry(task Task, defaultRetries int, baseDelay time.Duration) (time.Duration, bool) {
+	rt, ok := task.(RetryableTask)
+	if !ok {
+		return 0, false
+	}
+
+	attempts := rt.GetAttempts() + 1
+	rt.SetAttempts(attempts)
+	maxRetries := rt.GetMaxRetries()
+	if maxRetries <= 0 {
+		maxRetries = defaultRetries
+	}
+	if attempts > maxRetries {
+		return 0, false
+	}
+
+	delay := baseDelay << uint(attempts-1)
+	if delay <= 0 || delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	return delay, true
+}
+
+// Nack retry task with exponential backoff, or move it to the dead letter queue once
+// its retries are exhausted
+func (q *RedisQueue) Nack(ctx context.Context, task Task, cause error) (bool, error) {
+	q.releaseSlot(ctx, task)
+	var raw string
+	if q.reliable {
+		var ok bool
+		if raw, ok = q.takeInflight(task); !ok {
+			return false, fmt.Errorf("task not in flight, taskID: %s", task.GetID())
+		}
+	}
+
+	delay, ok := nextRetry(task, q.retryCount, q.retryDelay)
+	if !ok {
+		return true, q.deadLetter(ctx, task, raw, cause)
+	}
+	return false, q.retry(ctx, task, raw, delay)
+}
+
+// retry move task to the delay queue, it's promoted into its lane once the backoff elapsed
+func (q *RedisQueue) retry(ctx context.Context, task Task, raw string, delay time.Duration) error {
+	runAt := time.Now().Add(delay)
+	if !q.reliable {
+		return q.delayed.add(ctx, task, runAt)
+	}
+
+	data, err := q.registry.Encode(task)
+	if err != nil {
+		return err
+	}
+
+	err = retryScript.Run(ctx, q.client, []string{q.processingKey(), q.leaseKey(), q.delayed.key},
+		raw, q.leaseMember(raw), data, strconv.FormatInt(runAt.UnixMilli(), 10)).Err()
+	if err != nil {
+		return fmt.Errorf("failed to retry task, taskID: %s, error: %w", task.GetID(), err)
+	}
+	q.delayed.updateSize(ctx)
+	return nil
+}
+
+func (q *RedisQueue) deadLetter(ctx context.Context, task Task, raw string, cause error) error {
+	entry, err := q.deadLetters.entry(task, cause)
+	if err != nil {
+		return err
+	}
+
+	if q.reliable {
+		err = deadLetterScript.Run(ctx, q.client, []string{q.processingKey(), q.leaseKey(), q.deadLetters.key},
+			raw, q.leaseMember(raw), entry).Err()
+	} else {
+		err = q.client.LPush(ctx, q.deadLetters.key, entry).Err()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to move task to dead letter queue, taskID: %s, error: %w", task.GetID(), err)
+	}
+
+	metrics.IncDeadLetter()
+	return nil
+}
+
+// DeadLetters list dead letters, newest first
+func (q *RedisQueue) DeadLetters(ctx context.Context, offset, limit int64) ([]*DeadLetter, int64, error) {
+	return q.deadLetters.list(ctx, offset, limit)
+}
+
+// RequeueDeadLetter move dead letter of the task back to the queue with attempts reset
+func (q *RedisQueue) RequeueDeadLetter(ctx context.Context, taskID string) (Task, error) {
+	task, err := q.deadLetters.take(ctx, taskID)
+	if err != nil || task == nil {
+		return nil, err
+	}
+	if err := q.Enqueue(ctx, task); err != nil {
+		return nil, err
+	}
+	return task, nil
+}
+
+// PurgeDeadLetters remove all dead letters
+func (q *RedisQueue) PurgeDeadLetters(ctx context.Context) (int64, error) {
+	return q.deadLetters.purge(ctx)
+}
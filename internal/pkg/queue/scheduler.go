@@ -0,0 +1,198 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/xmualex2023/i18n-translation/internal/pkg/metrics"
+)
+
+// ScheduledTask task waiting in the delay queue
+type ScheduledTask struct {
+	ID      string          `json:"id"`
+	RunAt   time.Time       `json:"run_at"`
+	Message json.RawMessage `json:"message"` // envelope of the task
+}
+
+// Scheduler queue which supports delayed tasks
+type Scheduler interface {
+	// Schedule add task to the delay queue, it's moved into the ready queue at runAt
+	Schedule(ctx context.Context, task Task, runAt time.Time) error
+	// ScheduledTasks list scheduled tasks, the earliest first
+	ScheduledTasks(ctx context.Context, offset, limit int64) ([]*ScheduledTask, int64, error)
+	// CancelScheduled remove scheduled task, false if the task is not scheduled
+	CancelScheduled(ctx context.Context, taskID string) (bool, error)
+}
+
+// promoteScript KEYS: delayed, normal lane, high lane, low lane; ARGV: now, limit
+var promoteScript = redis.NewScript(laneLua + `
+local members = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, tonumber(ARGV[2]))
+for _, raw in ipairs(members) do
+	redis.call('ZREM', KEYS[1], raw)
+	redis.call('LPUSH', lane(raw, KEYS[2], KEYS[3], KEYS[4]), raw)
+end
+return #members
+`)
+
+const (
+	promoteBatchSize = 100
+	scanBatchSize    = 100
+)
+
+// delayStore redis sorted set of delayed messages scored by run time in ms, shared by queue backends
+type delayStore struct {
+	client   *redis.Client
+	registry *Registry
+	key      string
+}
+
+func (s *delayStore) add(ctx context.Context, task Task, runAt time.Time) error {
+	data, err := s.registry.Encode(task)
+	if err != nil {
+		return err
+	}
+
+	if err := s.client.ZAdd(ctx, s.key, redis.Z{Score: float64(runAt.UnixMilli()), Member: data}).Err(); err != nil {
+		return fmt.Errorf("failed to schedule task, taskID: %s, error: %w", task.GetID(), err)
+	}
+
+	s.updateSize(ctx)
+	return nil
+}
+
+func (s *delayStore) list(ctx context.Context, offset, limit int64) ([]*ScheduledTask, int64, error) {
+	total, err := s.client.ZCard(ctx, s.key).Result()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count scheduled tasks, error: %w", err)
+	}
+
+	members, err := s.client.ZRangeWithScores(ctx, s.key, offset, offset+limit-1).Result()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list scheduled tasks, error: %w", err)
+	}
+
+	tasks := make([]*ScheduledTask, 0, len(members))
+	for _, m := range members {
+		raw := m.Member.(string)
+		task, err := s.registry.Decode([]byte(raw))
+		if err != nil {
+			log.Printf("skip undecodable scheduled task, error: %v", err)
+			continue
+		}
+		tasks = append(tasks, &ScheduledTask{
+			ID:      task.GetID(),
+			RunAt:   time.UnixMilli(int64(m.Score)),
+			Message: json.RawMessage(raw),
+		})
+	}
+	return tasks, total, nil
+}
+
+// cancel remove scheduled task, the set is scanned as task ids are in payloads
+func (s *delayStore) cancel(ctx context.Context, taskID string) (bool, error) {
+	for start := int64(0); ; start += scanBatchSize {
+		members, err := s.client.ZRange(ctx, s.key, start, start+scanBatchSize-1).Result()
+		if err != nil {
+			return false, fmt.Errorf("failed to list scheduled tasks, error: %w", err)
+		}
+
+		for _, raw := range members {
+			task, err := s.registry.Decode([]byte(raw))
+			if err != nil || task.GetID() != taskID {
+				continue
+			}
+
+			removed, err := s.client.ZRem(ctx, s.key, raw).Result()
+			if err != nil {
+				return false, fmt.Errorf("failed to cancel scheduled task, taskID: %s, error: %w", taskID, err)
+			}
+			s.updateSize(ctx)
+			// 0 if promoted concurrently
+			return removed > 0, nil
+		}
+
+		if len(members) < scanBatchSize {
+			return false, nil
+		}
+	}
+}
+
+// promote move due messages with script, whose KEYS[1] is the delay set and ARGV are now and limit
+func (s *delayStore) promote(ctx context.Context, script *redis.Script, keys []string, args ...interface{}) (int, error) {
+	total := 0
+	for {
+		now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+		argv := append([]interface{}{now, promoteBatchSize}, args...)
+		n, err := script.Run(ctx, s.client, append([]string{s.key}, keys...), argv...).Int()
+		if err != nil {
+			return total, fmt.Errorf("failed to promote due tasks, error: %w", err)
+		}
+		total += n
+		if n < promoteBatchSize {
+			if total > 0 {
+				s.updateSize(ctx)
+			}
+			return total, nil
+		}
+	}
+}
+
+func (s *delayStore) updateSize(ctx context.Context) {
+	size, err := s.client.ZCard(ctx, s.key).Result()
+	if err == nil {
+		metrics.SetScheduledTasks(int(size))
+	}
+}
+
+// runPromoter call promote periodically until ctx is done
+func runPromoter(ctx context.Context, interval time.Duration, promote func(context.Context) (int, error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := promote(ctx); err != nil {
+				log.Printf("failed to promote due tasks, error: %v", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Schedule add task to the delay queue, tasks due already are enqueued directly
+func (q *RedisQueue) Schedule(ctx context.Context, task Task, runAt time.Time) error {
+	if !runAt.After(time.Now()) {
+		return q.Enqueue(ctx, task)
+	}
+	return q.delayed.add(ctx, task, runAt)
+}
+
+// ScheduledTasks list scheduled tasks, the earliest first
+func (q *RedisQueue) ScheduledTasks(ctx context.Context, offset, limit int64) ([]*ScheduledTask, int64, error) {
+	return q.delayed.list(ctx, offset, limit)
+}
+
+// CancelScheduled remove scheduled task
+func (q *RedisQueue) CancelScheduled(ctx context.Context, taskID string) (bool, error) {
+	return q.delayed.cancel(ctx, taskID)
+}
+
+// PromoteDue move due tasks from the delay queue into their lanes
+func (q *RedisQueue) PromoteDue(ctx context.Context) (int, error) {
+	n, err := q.delayed.promote(ctx, promoteScript, q.reapLaneKeys())
+	if n > 0 {
+		q.updateQueueSize(ctx)
+	}
+	return n, err
+}
+
+// RunScheduler promote due tasks periodically until ctx is done
+func (q *RedisQueue) RunScheduler(ctx context.Context, interval time.Duration) {
+	runPromoter(ctx, interval, q.PromoteDue)
+}
@@ -0,0 +1,673 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/xmualex2023/i18n-translation/internal/pkg/metrics"
+)
+
+const streamMessageField = "message"
+
+// streamEnqueueScript KEYS: stream; ARGV: max len, message. Returns 0 if the stream is full.
+// Streams are never trimmed, finished messages are deleted by Ack and Nack instead.
+var streamEnqueueScript = redis.NewScript(`
+local maxLen = tonumber(ARGV[1])
+if maxLen > 0 and redis.call('XLEN', KEYS[1]) >= maxLen then
+	return 0
+end
+redis.call('XADD', KEYS[1], '*', 'message', ARGV[2])
+return 1
+`)
+
+// streamPromoteScript KEYS: delayed, normal stream, high stream, low stream; ARGV: now, limit.
+// Accepted tasks are promoted even if the stream is full.
+var streamPromoteScript = redis.NewScript(laneLua + `
+local members = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, tonumber(ARGV[2]))
+for _, raw in ipairs(members) do
+	redis.call('ZREM', KEYS[1], raw)
+	redis.call('XADD', lane(raw, KEYS[2], KEYS[3], KEYS[4]), '*', 'message', raw)
+end
+return #members
+`)
+
+// streamExtendScript reset the idle time of a message pending on the consumer, messages claimed
+// by other consumers in the meantime are left to them
+// KEYS: stream; ARGV: group, consumer, message id
+var streamExtendScript = redis.NewScript(`
+local pending = redis.call('XPENDING', KEYS[1], ARGV[1], ARGV[3], ARGV[3], 1)
+if #pending == 0 or pending[1][2] ~= ARGV[2] then
+	return 0
+end
+redis.call('XCLAIM', KEYS[1], ARGV[1], ARGV[2], 0, ARGV[3], 'JUSTID')
+return 1
+`)
+
+// streamMessage message delivered to the consumer
+type streamMessage struct {
+	stream string
+	id     string
+}
+
+// StreamQueue redis streams queue implementation with a consumer group.
+// Each priority lane is a stream, delivered messages stay pending in the group until Ack or
+// Nack, which also delete them from the stream, so streams only hold unfinished work. Messages
+// pending for longer than the visibility timeout are claimed back by the reaper with XAUTOCLAIM.
+// Like RedisQueue, all keys share the hash tag of the queue key, so scripts and transactions
+// touching several of them work on Redis Cluster.
+type StreamQueue struct {
+	client            *redis.Client
+	queueKey          string
+	group             string
+	consumer          string
+	registry          *Registry
+	retryCount        int
+	retryDelay        time.Duration
+	visibilityTimeout time.Duration
+	maxLen            int64
+
+	lanes       *laneSelector
+	delayed     *delayStore
+	deadLetters *deadLetterStore
+
+	mu         sync.Mutex
+	groupReady bool
+	inflight   map[string]streamMessage // task id -> message
+}
+
+// NewStreamQueue create stream queue, consumer should be unique in the group and stable
+// across restarts
+func NewStreamQueue(client *redis.Client, queueKey, group, consumer string, opts ...Option) *StreamQueue {
+	o := newOptions(opts)
+	queueKey = hashTag(queueKey)
+	return &StreamQueue{
+		client:            client,
+		queueKey:          queueKey,
+		group:             group,
+		consumer:          consumer,
+		registry:          o.registry,
+		retryCount:        o.retryCount,
+		retryDelay:        o.retryDelay,
+		visibilityTimeout: o.visibilityTimeout,
+		maxLen:            o.maxLen,
+		lanes:             &laneSelector{weights: o.weights},
+		delayed:           &delayStore{client: client, registry: o.registry, key: queueKey + ":stream:delayed"},
+		deadLetters:       &deadLetterStore{client: client, registry: o.registry, key: queueKey + ":stream:dead"},
+		inflight:          make(map[string]streamMessage),
+	}
+}
+
+// streamKey stream of the lane, separate from list keys so both backends can coexist
+func (q *StreamQueue) streamKey(p Priority) string {
+	if p == PriorityNormal {
+		return q.queueKey + ":stream"
+	}
+	return q.queueKey + ":stream:" + string(p)
+}
+
+// streamKeys stream keys in the order expected by lua scripts: normal, high, low
+func (q *StreamQueue) streamKeys() []string {
+	return []string{q.streamKey(PriorityNormal), q.streamKey(PriorityHigh), q.streamKey(PriorityLow)}
+}
+
+// ensureGroup create consumer group on all streams once
+func (q *StreamQueue) ensureGroup(ctx context.Context) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.groupReady {
+		return nil
+	}
+
+	for _, stream := range q.streamKeys() {
+		err := q.client.XGroupCreateMkStream(ctx, stream, q.group, "0").Err()
+		if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+			return fmt.Errorf("failed to create consumer group, stream: %s, error: %w", stream, err)
+		}
+	}
+	q.groupReady = true
+	return nil
+}
+
+// Enqueue add task to the stream of its priority, ErrFull is returned once the stream holds
+// max len unfinished messages
+func (q *StreamQueue) Enqueue(ctx context.Context, task Task) error {
+	data, err := q.registry.Encode(task)
+	if err != nil {
+		return err
+	}
+
+	added, err := streamEnqueueScript.Run(ctx, q.client, []string{q.streamKey(priorityOf(task))}, q.maxLen, data).Int()
+	if err != nil {
+		return fmt.Errorf("failed to enqueue task, error: %w", err)
+	}
+	if added == 0 {
+		return fmt.Errorf("%w, max len: %d", ErrFull, q.maxLen)
+	}
+
+	q.updateQueueSize(ctx)
+	return nil
+}
+
+// Dequeue read a new message from the streams by weighted priority, blocks until a task is
+// available or the deadline of ctx is reached, in which case ErrEmpty is returned
+func (q *StreamQueue) Dequeue(ctx context.Context) (Task, error) {
+	if err := q.ensureGroup(ctx); err != nil {
+		return nil, err
+	}
+
+	msg, stream, err := q.read(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	q.updateQueueSize(ctx)
+
+	raw, _ := msg.Values[streamMessageField].(string)
+	task, err := q.registry.Decode([]byte(raw))
+	if err != nil {
+		// undecodable message would be redelivered forever, drop it
+		log.Printf("drop undecodable task, message: %s, error: %v", raw, err)
+		if ackErr := q.remove(ctx, streamMessage{stream: stream, id: msg.ID}); ackErr != nil {
+			log.Printf("failed to drop undecodable task, error: %v", ackErr)
+		}
+		return nil, err
+	}
+
+	q.mu.Lock()
+	q.inflight[task.GetID()] = streamMessage{stream: stream, id: msg.ID}
+	q.mu.Unlock()
+
+	return task, nil
+}
+
+// read read a message from the lanes in weighted order. XREADGROUP returns messages from every
+// stream that has one, so it blocks on the picked lane only for a short while and checks all
+// lanes again.
+func (q *StreamQueue) read(ctx context.Context) (*redis.XMessage, string, error) {
+	for {
+		lanes := q.lanes.next()
+		for _, p := range lanes {
+			msg, err := q.readStream(ctx, q.streamKey(p), -1)
+			if msg != nil || err != nil {
+				return msg, q.streamKey(p), err
+			}
+		}
+
+		// XREADGROUP blocks in milliseconds, unlike list commands
+		timeout := laneWaitTimeout
+		if deadline, ok := ctx.Deadline(); ok {
+			remaining := time.Until(deadline)
+			if remaining < time.Millisecond {
+				return nil, "", ErrEmpty
+			}
+			if remaining < timeout {
+				timeout = remaining
+			}
+		}
+
+		stream := q.streamKey(lanes[0])
+		msg, err := q.readStream(ctx, stream, timeout)
+		if msg != nil || err != nil {
+			return msg, stream, err
+		}
+	}
+}
+
+// readStream read a new message from the stream, block < 0 means don't block
+func (q *StreamQueue) readStream(ctx context.Context, stream string, block time.Duration) (*redis.XMessage, error) {
+	result, err := q.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    q.group,
+		Consumer: q.consumer,
+		Streams:  []string{stream, ">"},
+		Count:    1,
+		Block:    block,
+	}).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return nil, ErrEmpty
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to dequeue task, error: %w", err)
+	}
+	if len(result) == 0 || len(result[0].Messages) == 0 {
+		return nil, nil
+	}
+	return &result[0].Messages[0], nil
+}
+
+// remove acknowledge and delete the message
+func (q *StreamQueue) remove(ctx context.Context, msg streamMessage) error {
+	_, err := q.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		return q.removeIn(ctx, pipe, msg)
+	})
+	return err
+}
+
+func (q *StreamQueue) removeIn(ctx context.Context, pipe redis.Pipeliner, msg streamMessage) error {
+	pipe.XAck(ctx, msg.stream, q.group, msg.id)
+	pipe.XDel(ctx, msg.stream, msg.id)
+	return nil
+}
+
+func (q *StreamQueue) takeInflight(task Task) (streamMessage, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	msg, ok := q.inflight[task.GetID()]
+	delete(q.inflight, task.GetID())
+	return msg, ok
+}
+
+// Ack acknowledge task and delete it from the stream
+func (q *StreamQueue) Ack(ctx context.Context, task Task) error {
+	msg, ok := q.takeInflight(task)
+	if !ok {
+		return fmt.Errorf("task not in flight, taskID: %s", task.GetID())
+	}
+
+	if err := q.remove(ctx, msg); err != nil {
+		return fmt.Errorf("failed to ack task, taskID: %s, error: %w", task.GetID(), err)
+	}
+	return nil
+}
+
+// Nack retry task with exponential backoff through the delay queue, or move it to the dead
+// letter queue once its retries are exhausted
+func (q *StreamQueue) Nack(ctx context.Context, task Task, cause error) (bool, error) {
+	msg, ok := q.takeInflight(task)
+	if !ok {
+		return false, fmt.Errorf("task not in flight, taskID: %s", task.GetID())
+	}
+
+	delay, retry := nextRetry(task, q.retryCount, q.retryDelay)
+	if retry {
+		data, err := q.registry.Encode(task)
+		if err != nil {
+			return false, err
+		}
+
+		_, err = q.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.ZAdd(ctx, q.delayed.key, redis.Z{Score: float64(time.Now().Add(delay).UnixMilli()), Member: data})
+			return q.removeIn(ctx, pipe, msg)
+		})
+		if err != nil {
+			return false, fmt.Errorf("failed to retry task, taskID: %s, error: %w", task.GetID(), err)
+		}
+		q.delayed.updateSize(ctx)
+		return false, nil
+	}
+
+	entry, err := q.deadLetters.entry(task, cause)
+	if err != nil {
+		return false, err
+	}
+	_, err = q.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.LPush(ctx, q.deadLetters.key, entry)
+		return q.removeIn(ctx, pipe, msg)
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to move task to dead letter queue, taskID: %s, error: %w", task.GetID(), err)
+	}
+
+	metrics.IncDeadLetter()
+	return true, nil
+}
+
+// Release add task to its stream again as a new message, streams have no head to return to
+func (q *StreamQueue) Release(ctx context.Context, task Task) error {
+	msg, ok := q.takeInflight(task)
+	if !ok {
+		return fmt.Errorf("task not in flight, taskID: %s", task.GetID())
+	}
+
+	data, err := q.registry.Encode(task)
+	if err != nil {
+		return err
+	}
+	xmsg := redis.XMessage{ID: msg.id, Values: map[string]interface{}{streamMessageField: string(data)}}
+	if err := q.requeue(ctx, msg.stream, []redis.XMessage{xmsg}, []string{msg.id}); err != nil {
+		return fmt.Errorf("failed to release task, taskID: %s, error: %w", task.GetID(), err)
+	}
+	q.updateQueueSize(ctx)
+	return nil
+}
+
+// requeue add messages to the streams again as new messages, and delete the old ones. It's
+// not limited by max len, the messages are in the stream already. Messages deleted from the
+// stream, i.e. removed on cancellation, are only acknowledged.
+func (q *StreamQueue) requeue(ctx context.Context, stream string, msgs []redis.XMessage, ids []string) error {
+	_, err := q.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, msg := range msgs {
+			raw, ok := msg.Values[streamMessageField].(string)
+			if !ok {
+				continue
+			}
+			pipe.XAdd(ctx, &redis.XAddArgs{
+				Stream: stream,
+				Values: []interface{}{streamMessageField, raw},
+			})
+		}
+		if len(ids) > 0 {
+			pipe.XAck(ctx, stream, q.group, ids...)
+			pipe.XDel(ctx, stream, ids...)
+		}
+		return nil
+	})
+	return err
+}
+
+// Recover return messages pending on the consumer, e.g. delivered before a crash, to the
+// streams. It should be called before consuming.
+func (q *StreamQueue) Recover(ctx context.Context) (int, error) {
+	if err := q.ensureGroup(ctx); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, stream := range q.streamKeys() {
+		for {
+			pending, err := q.client.XPendingExt(ctx, &redis.XPendingExtArgs{
+				Stream:   stream,
+				Group:    q.group,
+				Start:    "-",
+				End:      "+",
+				Count:    reapBatchSize,
+				Consumer: q.consumer,
+			}).Result()
+			if err != nil && err != redis.Nil {
+				return count, fmt.Errorf("failed to list pending messages, error: %w", err)
+			}
+			if len(pending) == 0 {
+				break
+			}
+
+			ids := make([]string, 0, len(pending))
+			for _, p := range pending {
+				ids = append(ids, p.ID)
+			}
+			msgs, err := q.client.XClaim(ctx, &redis.XClaimArgs{
+				Stream:   stream,
+				Group:    q.group,
+				Consumer: q.consumer,
+				Messages: ids,
+			}).Result()
+			if err != nil {
+				return count, fmt.Errorf("failed to claim pending messages, error: %w", err)
+			}
+			if err := q.requeue(ctx, stream, msgs, ids); err != nil {
+				return count, fmt.Errorf("failed to recover tasks, error: %w", err)
+			}
+			count += len(msgs)
+		}
+	}
+	return count, nil
+}
+
+// Extend reset the idle time of a dequeued message, so ReapExpired of any consumer leaves it
+// alone for another visibility timeout
+func (q *StreamQueue) Extend(ctx context.Context, task Task) error {
+	q.mu.Lock()
+	msg, ok := q.inflight[task.GetID()]
+	q.mu.Unlock()
+	if !ok {
+		// acknowledged already
+		return nil
+	}
+
+	extended, err := streamExtendScript.Run(ctx, q.client, []string{msg.stream}, q.group, q.consumer, msg.id).Int()
+	if err != nil {
+		return fmt.Errorf("failed to extend lease, error: %w", err)
+	}
+	if extended == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+// ReapExpired claim messages pending on any consumer for longer than the visibility timeout,
+// and return them to the streams
+func (q *StreamQueue) ReapExpired(ctx context.Context) (int, error) {
+	if err := q.ensureGroup(ctx); err != nil {
+		return 0, err
+	}
+
+	total := 0
+	for _, stream := range q.streamKeys() {
+		start := "0-0"
+		for {
+			msgs, next, err := q.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+				Stream:   stream,
+				Group:    q.group,
+				Consumer: q.consumer,
+				MinIdle:  q.visibilityTimeout,
+				Start:    start,
+				Count:    reapBatchSize,
+			}).Result()
+			if err != nil {
+				return total, fmt.Errorf("failed to claim expired messages, error: %w", err)
+			}
+
+			ids := make([]string, 0, len(msgs))
+			for _, msg := range msgs {
+				ids = append(ids, msg.ID)
+			}
+			if err := q.requeue(ctx, stream, msgs, ids); err != nil {
+				return total, fmt.Errorf("failed to reap expired tasks, error: %w", err)
+			}
+			total += len(msgs)
+
+			if next == "0-0" || next == "" {
+				break
+			}
+			start = next
+		}
+	}
+	return total, nil
+}
+
+// RunReaper reap expired messages and report pending counts periodically until ctx is done
+func (q *StreamQueue) RunReaper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			n, err := q.ReapExpired(ctx)
+			if err != nil {
+				log.Printf("failed to reap expired tasks, error: %v", err)
+				continue
+			}
+			if n > 0 {
+				log.Printf("returned %d expired tasks to queue", n)
+				q.updateQueueSize(ctx)
+			}
+			q.updatePending(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Schedule add task to the delay queue, tasks due already are enqueued directly
+func (q *StreamQueue) Schedule(ctx context.Context, task Task, runAt time.Time) error {
+	if !runAt.After(time.Now()) {
+		return q.Enqueue(ctx, task)
+	}
+	return q.delayed.add(ctx, task, runAt)
+}
+
+// Remove remove task not delivered yet from the streams or the delay queue
+func (q *StreamQueue) Remove(ctx context.Context, taskID string) (bool, error) {
+	for _, stream := range q.streamKeys() {
+		removed, err := q.removeFromStream(ctx, stream, taskID)
+		if err != nil || removed {
+			q.updateQueueSize(ctx)
+			return removed, err
+		}
+	}
+	return q.delayed.cancel(ctx, taskID)
+}
+
+func (q *StreamQueue) removeFromStream(ctx context.Context, stream, taskID string) (bool, error) {
+	start := "-"
+	for {
+		msgs, err := q.client.XRangeN(ctx, stream, start, "+", scanBatchSize).Result()
+		if err != nil {
+			return false, fmt.Errorf("failed to list queued tasks, error: %w", err)
+		}
+
+		for _, msg := range msgs {
+			raw, _ := msg.Values[streamMessageField].(string)
+			task, err := q.registry.Decode([]byte(raw))
+			if err != nil || task.GetID() != taskID {
+				continue
+			}
+
+			// delivered messages stay in the stream until acknowledged, leave them to the consumer
+			pending, err := q.client.XPendingExt(ctx, &redis.XPendingExtArgs{
+				Stream: stream,
+				Group:  q.group,
+				Start:  msg.ID,
+				End:    msg.ID,
+				Count:  1,
+			}).Result()
+			if err != nil && err != redis.Nil {
+				return false, fmt.Errorf("failed to get pending tasks, error: %w", err)
+			}
+			if len(pending) > 0 {
+				continue
+			}
+
+			removed, err := q.client.XDel(ctx, stream, msg.ID).Result()
+			if err != nil {
+				return false, fmt.Errorf("failed to remove task, taskID: %s, error: %w", taskID, err)
+			}
+			return removed > 0, nil
+		}
+
+		if len(msgs) < scanBatchSize {
+			return false, nil
+		}
+		start = "(" + msgs[len(msgs)-1].ID
+	}
+}
+
+// ScheduledTasks list scheduled tasks, the earliest first
+func (q *StreamQueue) ScheduledTasks(ctx context.Context, offset, limit int64) ([]*ScheduledTask, int64, error) {
+	return q.delayed.list(ctx, offset, limit)
+}
+
+// CancelScheduled remove scheduled task
+func (q *StreamQueue) CancelScheduled(ctx context.Context, taskID string) (bool, error) {
+	return q.delayed.cancel(ctx, taskID)
+}
+
+// PromoteDue move due tasks from the delay queue into their streams
+func (q *StreamQueue) PromoteDue(ctx context.Context) (int, error) {
+	n, err := q.delayed.promote(ctx, streamPromoteScript, q.streamKeys())
+	if n > 0 {
+		q.updateQueueSize(ctx)
+	}
+	return n, err
+}
+
+// RunScheduler promote due tasks periodically until ctx is done
+func (q *StreamQueue) RunScheduler(ctx context.Context, interval time.Duration) {
+	runPromoter(ctx, interval, q.PromoteDue)
+}
+
+// DeadLetters list dead letters, newest first
+func (q *StreamQueue) DeadLetters(ctx context.Context, offset, limit int64) ([]*DeadLetter, int64, error) {
+	return q.deadLetters.list(ctx, offset, limit)
+}
+
+// RequeueDeadLetter move dead letter of the task back to the queue with attempts reset
+func (q *StreamQueue) RequeueDeadLetter(ctx context.Context, taskID string) (Task, error) {
+	task, err := q.deadLetters.take(ctx, taskID)
+	if err != nil || task == nil {
+		return nil, err
+	}
+	if err := q.Enqueue(ctx, task); err != nil {
+		return nil, err
+	}
+	return task, nil
+}
+
+// PurgeDeadLetters remove all dead letters
+func (q *StreamQueue) PurgeDeadLetters(ctx context.Context) (int64, error) {
+	return q.deadLetters.purge(ctx)
+}
+
+// Consumers pending message count of each consumer in the group
+func (q *StreamQueue) Consumers(ctx context.Context) (map[string]int64, error) {
+	if err := q.ensureGroup(ctx); err != nil {
+		return nil, err
+	}
+
+	consumers := make(map[string]int64)
+	for _, stream := range q.streamKeys() {
+		pending, err := q.client.XPending(ctx, stream, q.group).Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get pending messages, error: %w", err)
+		}
+		for consumer, n := range pending.Consumers {
+			consumers[consumer] += n
+		}
+	}
+	return consumers, nil
+}
+
+// LaneSizes count of undelivered messages of each lane
+func (q *StreamQueue) LaneSizes(ctx context.Context) (map[Priority]int64, error) {
+	sizes := make(map[Priority]int64, len(priorities))
+	for _, p := range priorities {
+		stream := q.streamKey(p)
+		length, err := q.client.XLen(ctx, stream).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get stream length, error: %w", err)
+		}
+		pending, err := q.client.XPending(ctx, stream, q.group).Result()
+		if err != nil && err != redis.Nil {
+			return nil, fmt.Errorf("failed to get pending messages, error: %w", err)
+		}
+		if pending != nil {
+			length -= pending.Count
+		}
+		if length < 0 {
+			length = 0
+		}
+		sizes[p] = length
+	}
+	return sizes, nil
+}
+
+func (q *StreamQueue) updateQueueSize(ctx context.Context) {
+	sizes, err := q.LaneSizes(ctx)
+	if err != nil {
+		return
+	}
+	for p, size := range sizes {
+		metrics.SetQueueSize(string(p), int(size))
+	}
+}
+
+func (q *StreamQueue) updatePending(ctx context.Context) {
+	consumers, err := q.Consumers(ctx)
+	if err != nil {
+		return
+	}
+	for consumer, n := range consumers {
+		metrics.SetQueuePending(consumer, int(n))
+	}
+}
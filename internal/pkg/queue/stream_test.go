@@ -0,0 +1,219 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestStreamQueue 测试 Stream 队列的出队、确认、重试和死信
+func TestStreamQueue(t *testing.T) {
+	client, cleanup := setupTestRedis(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	queue := NewStreamQueue(client, "test_queue", "workers", "consumer1", WithRetry(1, 10*time.Millisecond))
+	// 所有 key 位于同一个 hash tag 下
+	assert.Equal(t, []string{"{test_queue}:stream", "{test_queue}:stream:high", "{test_queue}:stream:low"}, queue.streamKeys())
+	assert.Equal(t, "{test_queue}:stream:delayed", queue.delayed.key)
+	assert.Equal(t, "{test_queue}:stream:dead", queue.deadLetters.key)
+
+	pending := func() int64 {
+		consumers, err := queue.Consumers(ctx)
+		require.NoError(t, err)
+		return consumers["consumer1"]
+	}
+	streamLen := func() int64 {
+		n, err := client.XLen(ctx, queue.streamKey(PriorityNormal)).Result()
+		require.NoError(t, err)
+		return n
+	}
+
+	// 出队后消息处于 pending 状态，确认后从 stream 删除
+	require.NoError(t, queue.Enqueue(ctx, &MockTask{ID: "task1"}))
+	task, err := queue.Dequeue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "task1", task.GetID())
+	assert.Equal(t, int64(1), pending())
+	require.NoError(t, queue.Ack(ctx, task))
+	assert.Equal(t, int64(0), pending())
+	assert.Equal(t, int64(0), streamLen())
+
+	// 空队列在 ctx 超时后返回 ErrEmpty
+	timeoutCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	_, err = queue.Dequeue(timeoutCtx)
+	cancel()
+	assert.ErrorIs(t, err, ErrEmpty)
+
+	// Nack 后进入延迟队列，到期后重新入队
+	require.NoError(t, queue.Enqueue(ctx, &RetryableMockTask{ID: "task2"}))
+	task, err = queue.Dequeue(ctx)
+	require.NoError(t, err)
+	deadLettered, err := queue.Nack(ctx, task, fmt.Errorf("first error"))
+	require.NoError(t, err)
+	assert.False(t, deadLettered)
+	assert.Equal(t, int64(0), pending())
+	assert.Equal(t, int64(0), streamLen())
+
+	time.Sleep(20 * time.Millisecond)
+	n, err := queue.PromoteDue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	// 重试耗尽后进入死信队列
+	task, err = queue.Dequeue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, task.(*RetryableMockTask).Attempts)
+	deadLettered, err = queue.Nack(ctx, task, fmt.Errorf("second error"))
+	require.NoError(t, err)
+	assert.True(t, deadLettered)
+	letters, total, err := queue.DeadLetters(ctx, 0, 10)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), total)
+	assert.Equal(t, "second error", letters[0].Error)
+	assert.Equal(t, int64(0), pending())
+}
+
+// TestStreamQueueReap 测试超时未确认的消息被回收，以及重启后恢复
+func TestStreamQueueReap(t *testing.T) {
+	client, cleanup := setupTestRedis(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	consumer1 := NewStreamQueue(client, "test_queue", "workers", "consumer1", WithVisibilityTimeout(20*time.Millisecond))
+	consumer2 := NewStreamQueue(client, "test_queue", "workers", "consumer2", WithVisibilityTimeout(20*time.Millisecond))
+
+	require.NoError(t, consumer1.Enqueue(ctx, &PriorityMockTask{ID: "task1", Priority: PriorityHigh}))
+	_, err := consumer1.Dequeue(ctx)
+	require.NoError(t, err)
+
+	// 未超时不会被回收
+	n, err := consumer2.ReapExpired(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	// 超时后由其他消费者回收，回到原优先级的 stream
+	time.Sleep(30 * time.Millisecond)
+	n, err = consumer2.ReapExpired(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	sizes, err := consumer2.LaneSizes(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), sizes[PriorityHigh])
+
+	task, err := consumer2.Dequeue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "task1", task.GetID())
+
+	// 重启后恢复本消费者未确认的消息
+	restarted := NewStreamQueue(client, "test_queue", "workers", "consumer2")
+	n, err = restarted.Recover(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	consumers, err := restarted.Consumers(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), consumers["consumer2"])
+
+	task, err = restarted.Dequeue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "task1", task.GetID())
+	require.NoError(t, restarted.Ack(ctx, task))
+}
+
+// TestStreamQueueExtend 测试续租重置消息的空闲时间，已被其他消费者回收的消息不会被抢回
+func TestStreamQueueExtend(t *testing.T) {
+	client, cleanup := setupTestRedis(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	consumer1 := NewStreamQueue(client, "test_queue", "workers", "consumer1", WithVisibilityTimeout(50*time.Millisecond))
+	consumer2 := NewStreamQueue(client, "test_queue", "workers", "consumer2", WithVisibilityTimeout(50*time.Millisecond))
+
+	require.NoError(t, consumer1.Enqueue(ctx, &MockTask{ID: "task1"}))
+	task, err := consumer1.Dequeue(ctx)
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		time.Sleep(30 * time.Millisecond)
+		require.NoError(t, consumer1.Extend(ctx, task))
+		n, err := consumer2.ReapExpired(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 0, n)
+	}
+	consumers, err := consumer2.Consumers(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), consumers["consumer1"])
+
+	// 停止续租后被回收并重新投递给 consumer2
+	time.Sleep(60 * time.Millisecond)
+	n, err := consumer2.ReapExpired(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	_, err = consumer2.Dequeue(ctx)
+	require.NoError(t, err)
+	assert.ErrorIs(t, consumer1.Extend(ctx, task), ErrLeaseLost)
+	consumers, err = consumer2.Consumers(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), consumers["consumer2"])
+	assert.Equal(t, int64(0), consumers["consumer1"])
+}
+
+// TestStreamQueueRemove 测试移除尚未投递的消息，已投递的消息不受影响
+func TestStreamQueueRemove(t *testing.T) {
+	client, cleanup := setupTestRedis(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	queue := NewStreamQueue(client, "test_queue", "workers", "consumer1")
+
+	require.NoError(t, queue.Enqueue(ctx, &MockTask{ID: "1"}))
+	require.NoError(t, queue.Enqueue(ctx, &MockTask{ID: "2"}))
+	task, err := queue.Dequeue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "1", task.GetID())
+
+	ok, err := queue.Remove(ctx, "1")
+	require.NoError(t, err)
+	assert.False(t, ok)
+	ok, err = queue.Remove(ctx, "2")
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	n, err := client.XLen(ctx, queue.streamKey(PriorityNormal)).Result()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	require.NoError(t, queue.Ack(ctx, task))
+}
+
+// TestStreamQueueMaxLen 测试 stream 满时拒绝入队，已有任务（包括执行中的）不会被裁剪
+func TestStreamQueueMaxLen(t *testing.T) {
+	client, cleanup := setupTestRedis(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	queue := NewStreamQueue(client, "test_queue", "workers", "consumer1", WithMaxLen(2))
+
+	require.NoError(t, queue.Enqueue(ctx, &MockTask{ID: "1"}))
+	require.NoError(t, queue.Enqueue(ctx, &MockTask{ID: "2"}))
+	assert.ErrorIs(t, queue.Enqueue(ctx, &MockTask{ID: "3"}), ErrFull)
+
+	// 执行中的任务仍然占用容量，重新入队不受限制
+	task, err := queue.Dequeue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "1", task.GetID())
+	assert.ErrorIs(t, queue.Enqueue(ctx, &MockTask{ID: "3"}), ErrFull)
+	require.NoError(t, queue.Release(ctx, task))
+
+	// 确认后释放容量
+	for _, id := range []string{"2", "1"} {
+		task, err = queue.Dequeue(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, id, task.GetID())
+		require.NoError(t, queue.Ack(ctx, task))
+	}
+	require.NoError(t, queue.Enqueue(ctx, &MockTask{ID: "3"}))
+}
@@ -0,0 +1,37 @@
+package util
+
+import "sync"
+
+// EWMA exponentially weighted moving average, safe for concurrent use
+type EWMA struct {
+	alpha float64
+
+	mu    sync.Mutex
+	value float64
+	init  bool
+}
+
+// NewEWMA create moving average, alpha in (0, 1] is the weight of new samples
+func NewEWMA(alpha float64) *EWMA {
+	return &EWMA{alpha: alpha}
+}
+
+// Add add sample, the first sample initializes the average
+func (e *EWMA) Add(sample float64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if !e.init {
+		e.value = sample
+		e.init = true
+		return
+	}
+	e.value += e.alpha * (sample - e.value)
+}
+
+// Value current average, 0 if there is no sample yet
+func (e *EWMA) Value() float64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.value
+}
@@ -0,0 +1,211 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+const (
+	HeaderSignature = "X-Webhook-Signature"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+
+	// maxResponseBody response body drained so the connection can be reused
+	maxResponseBody = 1024
+)
+
+var (
+	// ErrUnexpectedStatus the endpoint didn't answer with 2xx
+	ErrUnexpectedStatus = errors.New("unexpected webhook response status")
+	// ErrForbiddenAddress the endpoint resolves to a loopback, private, link-local or other
+	// internal address
+	ErrForbiddenAddress = errors.New("webhook address is not allowed")
+)
+
+// forbiddenNetworks networks webhooks must not be sent to, IPv4-mapped IPv6 addresses are
+// matched by the IPv4 networks
+var forbiddenNetworks = mustParseCIDRs(
+	"0.0.0.0/8",      // "this" network
+	"10.0.0.0/8",     // private
+	"100.64.0.0/10",  // shared address space (CGNAT), used by cloud metadata and service meshes
+	"127.0.0.0/8",    // loopback
+	"169.254.0.0/16", // link-local, cloud metadata
+	"172.16.0.0/12",  // private
+	"192.0.0.0/24",   // IETF protocol assignments
+	"192.168.0.0/16", // private
+	"198.18.0.0/15",  // benchmarking
+	"224.0.0.0/4",    // multicast
+	"240.0.0.0/4",    // reserved, broadcast
+	"::/128",         // unspecified
+	"::1/128",        // loopback
+	"64:ff9b::/96",   // NAT64, reaches embedded IPv4 addresses
+	"64:ff9b:1::/48", // local-use NAT64
+	"fc00::/7",       // unique local
+	"fe80::/10",      // link-local
+	"ff00::/8",       // multicast
+)
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+// IsForbiddenIP whether webhooks must not be sent to the ip, internal services are not
+// reachable through user registered urls
+func IsForbiddenIP(ip net.IP) bool {
+	for _, network := range forbiddenNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// guardAddress dialer control rejecting forbidden addresses, it runs after DNS resolution
+// so host names pointing to internal addresses are rejected as well
+func guardAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrForbiddenAddress, address)
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || IsForbiddenIP(ip) {
+		return fmt.Errorf("%w: %s", ErrForbiddenAddress, host)
+	}
+	return nil
+}
+
+// Sign HMAC-SHA256 signature of "<timestamp>.<body>", the timestamp is signed as well so
+// receivers can reject replayed requests
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify whether the signature matches the payload
+func Verify(secret string, timestamp int64, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
+
+// GenerateSecret random signing secret
+func GenerateSecret() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret, error: %w", err)
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// Backoff delay before the attempt-th retry (from 1), doubled every attempt up to max
+func Backoff(attempt int, base, max time.Duration) time.Duration {
+	delay := base
+	for i := 1; i < attempt && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	return delay
+}
+
+// Request webhook event to deliver
+type Request struct {
+	URL        string
+	Secret     string
+	Event      string
+	DeliveryID string
+	Body       []byte
+}
+
+// Response response of the endpoint, the body is not kept
+type Response struct {
+	StatusCode int
+	Duration   time.Duration
+}
+
+// Sender post signed events to webhook endpoints
+type Sender struct {
+	client *http.Client
+}
+
+// NewSender create sender, each delivery attempt is limited by timeout. Requests to loopback,
+// private and link-local addresses are refused.
+func NewSender(timeout time.Duration) *Sender {
+	return newSender(timeout, guardAddress)
+}
+
+// newSender create sender with the dialer control, nil allows all addresses
+func newSender(timeout time.Duration, control func(network, address string, c syscall.RawConn) error) *Sender {
+	dialer := &net.Dialer{Timeout: timeout, Control: control}
+	return &Sender{
+		client: &http.Client{
+			Timeout: timeout,
+			// no proxy, the guard checks the address actually dialed
+			Transport: &http.Transport{
+				DialContext:         dialer.DialContext,
+				ForceAttemptHTTP2:   true,
+				MaxIdleConns:        100,
+				IdleConnTimeout:     90 * time.Second,
+				TLSHandshakeTimeout: 10 * time.Second,
+			},
+			// redirects are not followed, the endpoint is the one registered
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// Send post the event, the response is returned along with ErrUnexpectedStatus for non-2xx status
+func (s *Sender) Send(ctx context.Context, req *Request) (*Response, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, req.URL, bytes.NewReader(req.Body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create webhook request, error: %w", err)
+	}
+	timestamp := time.Now().Unix()
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("User-Agent", "i18n-translation-webhook")
+	httpReq.Header.Set(HeaderEvent, req.Event)
+	httpReq.Header.Set(HeaderDelivery, req.DeliveryID)
+	httpReq.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	httpReq.Header.Set(HeaderSignature, Sign(req.Secret, timestamp, req.Body))
+
+	start := time.Now()
+	httpResp, err := s.client.Do(httpReq)
+	if err != nil {
+		return &Response{Duration: time.Since(start)}, fmt.Errorf("failed to send webhook, error: %w", err)
+	}
+	defer httpResp.Body.Close()
+
+	io.Copy(io.Discard, io.LimitReader(httpResp.Body, maxResponseBody))
+	resp := &Response{
+		StatusCode: httpResp.StatusCode,
+		Duration:   time.Since(start),
+	}
+	if httpResp.StatusCode < 200 || httpResp.StatusCode >= 300 {
+		return resp, fmt.Errorf("%w: %d", ErrUnexpectedStatus, httpResp.StatusCode)
+	}
+	return resp, nil
+}
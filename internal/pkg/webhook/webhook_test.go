@@ -0,0 +1,122 @@
+package webhook
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSend(t *testing.T) {
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		timestamp, err := strconv.ParseInt(r.Header.Get(HeaderTimestamp), 10, 64)
+		require.NoError(t, err)
+
+		// 接收方用共享密钥校验签名
+		assert.True(t, Verify("secret", timestamp, body, r.Header.Get(HeaderSignature)))
+		assert.False(t, Verify("other", timestamp, body, r.Header.Get(HeaderSignature)))
+		assert.Equal(t, "task.completed", r.Header.Get(HeaderEvent))
+		assert.Equal(t, "d1", r.Header.Get(HeaderDelivery))
+
+		w.WriteHeader(status)
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	// 测试服务监听在回环地址，不启用地址检查
+	sender := newSender(time.Second, nil)
+	req := &Request{URL: srv.URL, Secret: "secret", Event: "task.completed", DeliveryID: "d1", Body: []byte(`{"a":1}`)}
+	resp, err := sender.Send(context.Background(), req)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// 非 2xx 响应视为失败，响应内容仍然返回
+	status = http.StatusBadGateway
+	resp, err = sender.Send(context.Background(), req)
+	assert.ErrorIs(t, err, ErrUnexpectedStatus)
+	require.NotNil(t, resp)
+	assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+}
+
+func TestSendRefusesInternalAddress(t *testing.T) {
+	var called bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer srv.Close()
+
+	sender := NewSender(time.Second)
+	for _, url := range []string{
+		srv.URL,
+		strings.Replace(srv.URL, "127.0.0.1", "localhost", 1), // 域名解析后同样检查
+		"http://10.0.0.1/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://[::1]:8080/hook",
+		"http://0.0.0.0/hook",
+	} {
+		_, err := sender.Send(context.Background(), &Request{URL: url, Secret: "secret", Body: []byte(`{}`)})
+		assert.ErrorIs(t, err, ErrForbiddenAddress, url)
+	}
+	assert.False(t, called)
+}
+
+func TestIsForbiddenIP(t *testing.T) {
+	tests := []struct {
+		ip        string
+		forbidden bool
+	}{
+		{"0.0.0.0", true},
+		{"0.1.2.3", true},
+		{"10.1.2.3", true},
+		{"100.64.0.1", true},
+		{"100.100.100.200", true},
+		{"100.127.255.255", true},
+		{"100.128.0.1", false},
+		{"127.0.0.1", true},
+		{"127.1.2.3", true},
+		{"169.254.169.254", true},
+		{"172.16.0.1", true},
+		{"172.31.255.255", true},
+		{"172.32.0.1", false},
+		{"192.0.0.170", true},
+		{"192.168.1.1", true},
+		{"198.18.0.1", true},
+		{"224.0.0.1", true},
+		{"239.255.255.250", true},
+		{"240.0.0.1", true},
+		{"255.255.255.255", true},
+		{"::", true},
+		{"::1", true},
+		{"::ffff:127.0.0.1", true},
+		{"::ffff:10.0.0.1", true},
+		{"64:ff9b::a00:1", true},
+		{"64:ff9b::7f00:1", true},
+		{"64:ff9b::808:808", true},
+		{"64:ff9b:1::a00:1", true},
+		{"fd00::1", true},
+		{"fe80::1", true},
+		{"ff02::1", true},
+		{"8.8.8.8", false},
+		{"::ffff:8.8.8.8", false},
+		{"2001:4860:4860::8888", false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.forbidden, IsForbiddenIP(net.ParseIP(tt.ip)), tt.ip)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	assert.Equal(t, 10*time.Second, Backoff(1, 10*time.Second, time.Minute))
+	assert.Equal(t, 40*time.Second, Backoff(3, 10*time.Second, time.Minute))
+	assert.Equal(t, time.Minute, Backoff(10, 10*time.Second, time.Minute))
+}
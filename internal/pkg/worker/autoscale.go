@@ -0,0 +1,273 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/xmualex2023/i18n-translation/internal/pkg/metrics"
+	"github.com/xmualex2023/i18n-translation/internal/pkg/queue"
+)
+
+var ErrInvalidPoolSize = errors.New("invalid worker pool size")
+
+const (
+	// throughputAlpha weight of new samples in the throughput moving average
+	throughputAlpha = 0.3
+	// maxPoolSize upper limit of the max pool size set at runtime
+	maxPoolSize = 1000
+)
+
+// DepthReporter queue which reports the size of its lanes
+type DepthReporter interface {
+	LaneSizes(ctx context.Context) (map[queue.Priority]int64, error)
+}
+
+// LatencyReporter downstream service which reports its recent latency
+type LatencyReporter interface {
+	Latency() time.Duration
+}
+
+// AutoscaleSettings settings of Autoscaler
+type AutoscaleSettings struct {
+	Enabled  bool
+	Min      int
+	Max      int
+	Interval time.Duration // how often to evaluate
+	Cooldown time.Duration // min time between two changes
+	// TargetWait the pool is sized so that queued tasks start within this time
+	TargetWait time.Duration
+	// MaxLatency scaling up is paused while the LLM latency is above it, as more concurrency
+	// would only add load to a struggling provider. 0 means no limit.
+	MaxLatency time.Duration
+}
+
+// PoolStatus status of the worker pool
+type PoolStatus struct {
+	Size          int
+	Active        int
+	Min           int
+	Max           int
+	Autoscale     bool
+	Desired       int
+	QueueDepth    int64
+	EstimatedWait time.Duration
+	TaskDuration  time.Duration
+	LLMLatency    time.Duration
+	LastScaleAt   time.Time
+}
+
+// Autoscaler resize the worker pool between min and max by queue depth, estimated queue wait
+// time and LLM latency.
+//
+// By Little's law, draining a backlog of n tasks taking d each within the target wait t needs
+// n*d/t workers besides the busy ones. The wait is estimated as backlog / throughput, if it
+// exceeds the target the pool grows by at least one. The pool shrinks one worker at a time.
+type Autoscaler struct {
+	worker  *Worker
+	depth   DepthReporter
+	latency LatencyReporter
+
+	mu            sync.Mutex
+	settings      AutoscaleSettings
+	lastScaleAt   time.Time
+	lastTickAt    time.Time
+	lastProcessed int64
+	throughput    float64 // tasks per second, moving average
+	status        PoolStatus
+}
+
+// NewAutoscaler create autoscaler of the worker, latency may be nil
+func NewAutoscaler(w *Worker, depth DepthReporter, latency LatencyReporter, settings AutoscaleSettings) *Autoscaler {
+	return &Autoscaler{
+		worker:   w,
+		depth:    depth,
+		latency:  latency,
+		settings: settings,
+	}
+}
+
+// Run evaluate the pool size periodically until ctx is done, no-op if autoscaling is disabled
+func (a *Autoscaler) Run(ctx context.Context) {
+	if !a.settings.Enabled {
+		return
+	}
+
+	ticker := time.NewTicker(a.settings.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := a.Evaluate(ctx); err != nil {
+				log.Printf("failed to evaluate worker pool size, error: %v", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Evaluate resize the pool once by the current signals
+func (a *Autoscaler) Evaluate(ctx context.Context) error {
+	sizes, err := a.depth.LaneSizes(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get queue depth, error: %w", err)
+	}
+	var depth int64
+	for _, n := range sizes {
+		depth += n
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := time.Now()
+	processed := a.worker.Processed()
+	if !a.lastTickAt.IsZero() {
+		rate := float64(processed-a.lastProcessed) / now.Sub(a.lastTickAt).Seconds()
+		a.throughput += throughputAlpha * (rate - a.throughput)
+	}
+	a.lastTickAt, a.lastProcessed = now, processed
+
+	current := a.worker.Size()
+	desired, wait := a.desired(current, a.worker.Active(), depth)
+
+	a.status.QueueDepth = depth
+	a.status.EstimatedWait = wait
+	a.status.Desired = desired
+	metrics.SetQueueWaitEstimate(wait)
+	metrics.SetWorkerPoolSize("desired", desired)
+
+	if desired == current || now.Sub(a.lastScaleAt) < a.settings.Cooldown {
+		return nil
+	}
+
+	log.Printf("autoscale worker pool: %d -> %d, depth: %d, estimated wait: %v, task duration: %v, llm latency: %v",
+		current, desired, depth, wait.Round(time.Second), a.worker.AvgDuration().Round(time.Millisecond), a.llmLatency().Round(time.Millisecond))
+	a.resize(current, desired, "auto")
+	return nil
+}
+
+// desired desired pool size and the estimated queue wait time, a.mu must be held
+func (a *Autoscaler) desired(current, active int, depth int64) (int, time.Duration) {
+	s := a.settings
+
+	// estimated wait of a task queued now
+	var wait time.Duration
+	duration := a.worker.AvgDuration()
+	switch {
+	case depth == 0:
+	case a.throughput > 0:
+		wait = time.Duration(float64(depth) / a.throughput * float64(time.Second))
+	case duration > 0 && current > 0:
+		// nothing finished lately, estimate by task duration
+		wait = time.Duration(depth) * duration / time.Duration(current)
+	}
+
+	desired := current
+	if duration > 0 {
+		backlog := math.Ceil(float64(depth) * duration.Seconds() / s.TargetWait.Seconds())
+		desired = active + int(backlog)
+	}
+	// no task finished yet, grow while all workers are busy
+	busy := duration == 0 && active >= current
+	if depth > 0 && (wait > s.TargetWait || busy) && desired <= current {
+		desired = current + 1
+	}
+
+	if desired > current && s.MaxLatency > 0 && a.llmLatency() > s.MaxLatency {
+		desired = current
+	}
+	if desired < current {
+		desired = current - 1
+	}
+	return clamp(desired, s.Min, s.Max), wait
+}
+
+func (a *Autoscaler) llmLatency() time.Duration {
+	if a.latency == nil {
+		return 0
+	}
+	return a.latency.Latency()
+}
+
+// resize resize the worker pool and record the change, a.mu must be held
+func (a *Autoscaler) resize(current, size int, trigger string) {
+	a.worker.Resize(size)
+	a.lastScaleAt = time.Now()
+
+	direction := "up"
+	if size < current {
+		direction = "down"
+	}
+	metrics.IncWorkerScale(direction, trigger)
+}
+
+// Status current status of the pool
+func (a *Autoscaler) Status() PoolStatus {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	status := a.status
+	status.Size = a.worker.Size()
+	status.Active = a.worker.Active()
+	status.Min = a.settings.Min
+	status.Max = a.settings.Max
+	status.Autoscale = a.settings.Enabled
+	status.TaskDuration = a.worker.AvgDuration()
+	status.LLMLatency = a.llmLatency()
+	status.LastScaleAt = a.lastScaleAt
+	return status
+}
+
+// Update change bounds and size of the pool at runtime, zero values are left unchanged.
+// The size must be within the bounds whether autoscaling is enabled or not, the pool is
+// clamped into the new bounds, and a manual resize holds for one cooldown before the
+// autoscaler changes it again.
+func (a *Autoscaler) Update(size, min, max int) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if max > maxPoolSize {
+		return fmt.Errorf("%w: max %d above %d", ErrInvalidPoolSize, max, maxPoolSize)
+	}
+	if min == 0 {
+		min = a.settings.Min
+	}
+	if max == 0 {
+		max = a.settings.Max
+	}
+	if min < 1 || min > max {
+		return fmt.Errorf("%w: min %d, max %d", ErrInvalidPoolSize, min, max)
+	}
+
+	if size < 0 || size != 0 && (size < min || size > max) {
+		return fmt.Errorf("%w: size %d not in [%d, %d]", ErrInvalidPoolSize, size, min, max)
+	}
+
+	current := a.worker.Size()
+	if size == 0 {
+		size = current
+	}
+	a.settings.Min, a.settings.Max = min, max
+	size = clamp(size, min, max)
+	if size != current {
+		log.Printf("resize worker pool manually: %d -> %d", current, size)
+		a.resize(current, size, "manual")
+	}
+	return nil
+}
+
+func clamp(n, min, max int) int {
+	if n < min {
+		return min
+	}
+	if n > max {
+		return max
+	}
+	return n
+}
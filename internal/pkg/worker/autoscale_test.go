@@ -0,0 +1,118 @@
+package worker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmualex2023/i18n-translation/internal/pkg/queue"
+)
+
+type fakeDepth struct {
+	depth int64
+}
+
+func (f *fakeDepth) LaneSizes(ctx context.Context) (map[queue.Priority]int64, error) {
+	return map[queue.Priority]int64{queue.PriorityNormal: f.depth}, nil
+}
+
+type fakeLatency struct {
+	latency time.Duration
+}
+
+func (f *fakeLatency) Latency() time.Duration { return f.latency }
+
+func TestAutoscaler(t *testing.T) {
+	q, err := queue.NewMemoryQueue()
+	require.NoError(t, err)
+	w := NewWorker(q, func(ctx context.Context, task queue.Task) error { return nil })
+	defer w.Shutdown(context.Background())
+	w.Start(2)
+
+	depth := &fakeDepth{}
+	latency := &fakeLatency{}
+	a := NewAutoscaler(w, depth, latency, AutoscaleSettings{
+		Enabled:    true,
+		Min:        1,
+		Max:        10,
+		TargetWait: 10 * time.Second,
+		MaxLatency: 5 * time.Second,
+	})
+	ctx := context.Background()
+
+	// 尚无任务完成且有空闲工作器时不扩容
+	depth.depth = 5
+	require.NoError(t, a.Evaluate(ctx))
+	assert.Equal(t, 2, w.Size())
+
+	// 积压 20 个 2s 的任务，10s 内处理完需要 4 个工作器
+	w.duration.Add(2)
+	depth.depth = 20
+	require.NoError(t, a.Evaluate(ctx))
+	assert.Equal(t, 4, w.Size())
+	assert.Equal(t, 4, a.Status().Desired)
+
+	// 翻译服务延迟过高时暂停扩容
+	depth.depth = 100
+	latency.latency = 10 * time.Second
+	require.NoError(t, a.Evaluate(ctx))
+	assert.Equal(t, 4, w.Size())
+
+	// 队列为空时逐个缩容
+	depth.depth = 0
+	latency.latency = 0
+	require.NoError(t, a.Evaluate(ctx))
+	assert.Equal(t, 3, w.Size())
+
+	// 冷却时间内不调整
+	a.settings.Cooldown = time.Hour
+	require.NoError(t, a.Evaluate(ctx))
+	assert.Equal(t, 3, w.Size())
+}
+
+func TestAutoscalerUpdate(t *testing.T) {
+	q, err := queue.NewMemoryQueue()
+	require.NoError(t, err)
+	w := NewWorker(q, func(ctx context.Context, task queue.Task) error { return nil })
+	defer w.Shutdown(context.Background())
+	w.Start(2)
+
+	a := NewAutoscaler(w, &fakeDepth{}, nil, AutoscaleSettings{Enabled: true, Min: 1, Max: 5})
+
+	require.NoError(t, a.Update(4, 0, 0))
+	assert.Equal(t, 4, w.Size())
+	assert.ErrorIs(t, a.Update(6, 0, 0), ErrInvalidPoolSize)
+	assert.ErrorIs(t, a.Update(0, 3, 2), ErrInvalidPoolSize)
+
+	// 收紧范围时工作器数量随之调整
+	require.NoError(t, a.Update(0, 1, 3))
+	assert.Equal(t, 3, w.Size())
+	status := a.Status()
+	assert.Equal(t, 3, status.Max)
+	assert.False(t, status.LastScaleAt.IsZero())
+
+	assert.ErrorIs(t, a.Update(0, 0, maxPoolSize+1), ErrInvalidPoolSize)
+	assert.ErrorIs(t, a.Update(-1, 0, 0), ErrInvalidPoolSize)
+}
+
+// TestAutoscalerUpdateDisabled 测试未开启自动扩缩容时手动调整的数量同样受 min 和 max 限制
+func TestAutoscalerUpdateDisabled(t *testing.T) {
+	q, err := queue.NewMemoryQueue()
+	require.NoError(t, err)
+	w := NewWorker(q, func(ctx context.Context, task queue.Task) error { return nil })
+	defer w.Shutdown(context.Background())
+	w.Start(2)
+
+	a := NewAutoscaler(w, &fakeDepth{}, nil, AutoscaleSettings{Min: 1, Max: 5})
+
+	require.NoError(t, a.Update(5, 0, 0))
+	assert.Equal(t, 5, w.Size())
+	assert.ErrorIs(t, a.Update(1000000, 0, 0), ErrInvalidPoolSize)
+	assert.ErrorIs(t, a.Update(6, 0, 0), ErrInvalidPoolSize)
+	assert.Equal(t, 5, w.Size())
+
+	require.NoError(t, a.Update(0, 0, 3))
+	assert.Equal(t, 3, w.Size())
+}
@@ -0,0 +1,58 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// CancelBus broadcasts cancellation of running tasks to all workers
+type CancelBus interface {
+	Publish(ctx context.Context, taskID string) error
+	// Subscribe call handler with the id of each cancelled task until ctx is done
+	Subscribe(ctx context.Context, handler func(taskID string))
+}
+
+// RedisCancelBus cancel bus on redis pub/sub, cancellations published while a worker is
+// disconnected are lost
+type RedisCancelBus struct {
+	client  *redis.Client
+	channel string
+}
+
+func NewRedisCancelBus(client *redis.Client, channel string) *RedisCancelBus {
+	return &RedisCancelBus{
+		client:  client,
+		channel: channel,
+	}
+}
+
+// Publish publish cancellation of the task
+func (b *RedisCancelBus) Publish(ctx context.Context, taskID string) error {
+	if err := b.client.Publish(ctx, b.channel, taskID).Err(); err != nil {
+		return fmt.Errorf("failed to publish task cancellation, taskID: %s, error: %w", taskID, err)
+	}
+	return nil
+}
+
+// Subscribe call handler with cancelled task ids until ctx is done
+func (b *RedisCancelBus) Subscribe(ctx context.Context, handler func(taskID string)) {
+	pubsub := b.client.Subscribe(ctx, b.channel)
+	defer pubsub.Close()
+
+	ch := pubsub.Channel()
+	for {
+		select {
+		case msg, ok := <-ch:
+			if !ok {
+				log.Printf("task cancellation subscription closed, channel: %s", b.channel)
+				return
+			}
+			handler(msg.Payload)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
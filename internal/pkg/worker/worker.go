@@ -2,6 +2,7 @@ package worker
 
 import (
 	"context"
+	"errors"
 	"log"
 	"sync"
 	"sync/atomic"
@@ -9,79 +10,364 @@ import (
 
 	"github.com/xmualex2023/i18n-translation/internal/pkg/metrics"
 	"github.com/xmualex2023/i18n-translation/internal/pkg/queue"
+	"github.com/xmualex2023/i18n-translation/internal/pkg/util"
 )
 
-// Handler task handler function
+var (
+	// ErrTaskTimeout cause of the handler context when the task runs out of time
+	ErrTaskTimeout = errors.New("task timed out")
+	// ErrTaskCancelled cause of the handler context when the task is cancelled by Cancel
+	ErrTaskCancelled = errors.New("task cancelled")
+	// ErrWorkerStopped cause of the handler context when the worker is stopped
+	ErrWorkerStopped = errors.New("worker stopped")
+)
+
+// Handler task handler function, the context is cancelled with one of the causes above,
+// see context.Cause
 type Handler func(context.Context, queue.Task) error
 
+// DeadLetterHandler called when a failed task exhausted its retries
+type DeadLetterHandler func(ctx context.Context, task queue.Task, cause error)
+
+// RequeueHandler called before a task interrupted by shutdown is released back to the queue
+type RequeueHandler func(ctx context.Context, task queue.Task)
+
+const (
+	// interruptWait max time to wait for handlers to return once their contexts are cancelled
+	interruptWait = 5 * time.Second
+	// durationAlpha weight of new samples in the task duration moving average
+	durationAlpha = 0.2
+)
+
+// TimeoutTask task with its own time limit
+type TimeoutTask interface {
+	queue.Task
+	// GetTimeout time limit of the task, 0 means the default of the worker
+	GetTimeout() time.Duration
+}
+
 // Worker
 type Worker struct {
-	queue      queue.Queue
-	handler    Handler
-	stopChan   chan struct{}
-	wg         sync.WaitGroup
-	activeJobs int32
+	queue        queue.Queue
+	handler      Handler
+	onDeadLetter DeadLetterHandler
+	onRequeue    RequeueHandler
+	taskTimeout  time.Duration
+	leaseRenewal time.Duration
+	wg           sync.WaitGroup
+	activeJobs   int32
+	processed    int64      // tasks handled, for throughput
+	duration     *util.EWMA // seconds per task
+
+	// quit cancelled when the worker stops dequeuing
+	quit     context.Context
+	stopQuit context.CancelFunc
+	// ctx parent of handler contexts, cancelled once the drain period is over
+	ctx  context.Context
+	stop context.CancelCauseFunc
+
+	mu      sync.Mutex
+	running map[string]context.CancelCauseFunc // task id -> cancel of the handler context
+	runners []context.CancelFunc               // stop dequeuing of each runner goroutine
 }
 
 func NewWorker(queue queue.Queue, handler Handler) *Worker {
+	quit, stopQuit := context.WithCancel(context.Background())
+	ctx, stop := context.WithCancelCause(context.Background())
 	return &Worker{
 		queue:    queue,
 		handler:  handler,
-		stopChan: make(chan struct{}),
+		quit:     quit,
+		stopQuit: stopQuit,
+		ctx:      ctx,
+		stop:     stop,
+		duration: util.NewEWMA(durationAlpha),
+		running:  make(map[string]context.CancelCauseFunc),
+	}
+}
+
+// OnDeadLetter set handler of tasks moved to the dead letter queue, should be called before Start
+func (w *Worker) OnDeadLetter(handler DeadLetterHandler) {
+	w.onDeadLetter = handler
+}
+
+// OnRequeue set handler of tasks interrupted by shutdown, should be called before Start
+func (w *Worker) OnRequeue(handler RequeueHandler) {
+	w.onRequeue = handler
+}
+
+// SetTaskTimeout set default time limit of tasks, 0 means no limit, should be called before Start
+func (w *Worker) SetTaskTimeout(timeout time.Duration) {
+	w.taskTimeout = timeout
+}
+
+// SetLeaseRenewal set how often leases of running tasks are extended on queues implementing
+// queue.Extender, it should be well below the visibility timeout of the queue. 0 disables renewal,
+// should be called before Start.
+func (w *Worker) SetLeaseRenewal(interval time.Duration) {
+	w.leaseRenewal = interval
+}
+
+// Cancel cancel the handler context of the running task, false if it's not running here
+func (w *Worker) Cancel(taskID string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	cancel, ok := w.running[taskID]
+	if ok {
+		cancel(ErrTaskCancelled)
 	}
+	return ok
+}
+
+// ListenCancel cancel running tasks published on the bus until ctx is done
+func (w *Worker) ListenCancel(ctx context.Context, bus CancelBus) {
+	bus.Subscribe(ctx, func(taskID string) {
+		if w.Cancel(taskID) {
+			log.Printf("task cancelled, taskID: %s", taskID)
+		}
+	})
 }
 
 // Start start worker
 func (w *Worker) Start(workerCount int) {
-	for i := 0; i < workerCount; i++ {
+	w.Resize(workerCount)
+}
+
+// Resize change the number of runner goroutines. Removed runners stop dequeuing and exit once
+// their current tasks finish. No-op after Shutdown.
+func (w *Worker) Resize(workerCount int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.quit.Err() != nil {
+		return
+	}
+	for len(w.runners) < workerCount {
+		ctx, cancel := context.WithCancel(w.quit)
+		w.runners = append(w.runners, cancel)
 		w.wg.Add(1)
-		go w.run()
+		go w.run(ctx)
+	}
+	for len(w.runners) > workerCount {
+		last := len(w.runners) - 1
+		w.runners[last]()
+		w.runners = w.runners[:last]
 	}
+	metrics.SetWorkerPoolSize("current", len(w.runners))
+}
+
+// Size number of runner goroutines
+func (w *Worker) Size() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.runners)
 }
 
-// Stop stop worker
-func (w *Worker) Stop() {
-	close(w.stopChan)
-	w.wg.Wait()
+// Active number of tasks being handled
+func (w *Worker) Active() int {
+	return int(atomic.LoadInt32(&w.activeJobs))
+}
+
+// Processed number of tasks handled since start
+func (w *Worker) Processed() int64 {
+	return atomic.LoadInt64(&w.processed)
+}
+
+// AvgDuration moving average of task durations, 0 before the first task
+func (w *Worker) AvgDuration() time.Duration {
+	return time.Duration(w.duration.Value() * float64(time.Second))
+}
+
+// Shutdown stop dequeuing and wait for running tasks to finish until ctx is done, then cancel
+// their contexts. Interrupted tasks are released back to the queue without counting an attempt.
+func (w *Worker) Shutdown(ctx context.Context) {
+	w.mu.Lock()
+	w.stopQuit()
+	w.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return
+	case <-ctx.Done():
+	}
+
+	log.Printf("drain period is over, interrupt %d running tasks", atomic.LoadInt32(&w.activeJobs))
+	w.stop(ErrWorkerStopped)
+	select {
+	case <-done:
+	case <-time.After(interruptWait):
+		// reliable queues deliver the tasks again once their leases expire
+		log.Printf("%d tasks didn't stop in %v, leave them to the queue", atomic.LoadInt32(&w.activeJobs), interruptWait)
+	}
 }
 
-func (w *Worker) run() {
+// run dequeue and handle tasks until quit is done
+func (w *Worker) run(quit context.Context) {
 	defer w.wg.Done()
 
-	for {
-		select {
-		case <-w.stopChan:
-			return
-		default:
-			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-			task, err := w.queue.Dequeue(ctx)
-			cancel()
+	for quit.Err() == nil {
+		ctx, cancel := context.WithTimeout(quit, 5*time.Second)
+		task, err := w.queue.Dequeue(ctx)
+		cancel()
 
-			if err != nil {
+		if err != nil {
+			if !errors.Is(err, queue.ErrEmpty) && quit.Err() == nil {
 				log.Printf("failed to dequeue task, error: %v", err)
-				continue
 			}
+			continue
+		}
 
-			// update active jobs
-			atomic.AddInt32(&w.activeJobs, 1)
-			metrics.SetWorkerCount(int(atomic.LoadInt32(&w.activeJobs)))
+		// update active jobs
+		atomic.AddInt32(&w.activeJobs, 1)
+		metrics.SetWorkerCount(int(atomic.LoadInt32(&w.activeJobs)))
 
-			start := time.Now()
-			err = w.handler(context.Background(), task)
-			duration := time.Since(start)
+		start := time.Now()
+		cause, err := w.handle(task)
+		duration := time.Since(start)
 
-			// update metrics
-			status := "completed"
-			if err != nil {
-				status = "failed"
-				log.Printf("failed to handle task, error: %v", err)
+		// update metrics
+		status := "completed"
+		switch {
+		case err == nil:
+			w.ack(task)
+		case errors.Is(cause, ErrWorkerStopped):
+			status = "interrupted"
+			log.Printf("task interrupted by shutdown, requeue it, taskID: %s", task.GetID())
+			w.release(task)
+		case errors.Is(cause, ErrTaskCancelled), errors.Is(cause, ErrTaskTimeout):
+			// the handler records the outcome, cancelled and timed out tasks are not retried
+			status = "cancelled"
+			if errors.Is(cause, ErrTaskTimeout) {
+				status = "timeout"
+				log.Printf("task timed out, taskID: %s", task.GetID())
+			}
+			w.ack(task)
+		default:
+			status = "failed"
+			log.Printf("failed to handle task, taskID: %s, error: %v", task.GetID(), err)
+			w.nack(task, err)
+		}
+		metrics.IncTaskCounter(status)
+		metrics.ObserveTaskDuration(status, duration)
+		atomic.AddInt64(&w.processed, 1)
+		if status == "completed" || status == "failed" {
+			w.duration.Add(duration.Seconds())
+		}
+
+		// decrease active jobs
+		atomic.AddInt32(&w.activeJobs, -1)
+		metrics.SetWorkerCount(int(atomic.LoadInt32(&w.activeJobs)))
+	}
+}
+
+// handle run handler with a context cancelled by Cancel, Shutdown or the time limit of the task,
+// the cause is nil if the context wasn't cancelled
+func (w *Worker) handle(task queue.Task) (cause, err error) {
+	ctx, cancel := context.WithCancelCause(w.ctx)
+	defer cancel(nil)
+
+	timeout := w.taskTimeout
+	if tt, ok := task.(TimeoutTask); ok && tt.GetTimeout() > 0 {
+		timeout = tt.GetTimeout()
+	}
+	if timeout > 0 {
+		timer := time.AfterFunc(timeout, func() { cancel(ErrTaskTimeout) })
+		defer timer.Stop()
+	}
+
+	if extender, ok := w.queue.(queue.Extender); ok && w.leaseRenewal > 0 {
+		stopRenewal := w.renewLease(extender, task)
+		defer stopRenewal()
+	}
+
+	w.mu.Lock()
+	w.running[task.GetID()] = cancel
+	w.mu.Unlock()
+	defer func() {
+		w.mu.Lock()
+		delete(w.running, task.GetID())
+		w.mu.Unlock()
+	}()
+
+	err = w.handler(ctx, task)
+	return context.Cause(ctx), err
+}
+
+// renewLease extend the lease of the task periodically, so it isn't delivered again while the
+// handler runs, until the returned function is called
+func (w *Worker) renewLease(extender queue.Extender, task queue.Task) func() {
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+
+		ticker := time.NewTicker(w.leaseRenewal)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
 			}
-			metrics.IncTaskCounter(status)
-			metrics.ObserveTaskDuration(status, duration)
 
-			// decrease active jobs
-			atomic.AddInt32(&w.activeJobs, -1)
-			metrics.SetWorkerCount(int(atomic.LoadInt32(&w.activeJobs)))
+			ctx, cancel := context.WithTimeout(context.Background(), w.leaseRenewal)
+			err := extender.Extend(ctx, task)
+			cancel()
+			if errors.Is(err, queue.ErrLeaseLost) {
+				log.Printf("lease of running task is lost, it may be handled twice, taskID: %s", task.GetID())
+				return
+			}
+			if err != nil {
+				log.Printf("failed to extend lease, taskID: %s, error: %v", task.GetID(), err)
+			}
 		}
+	}()
+
+	return func() {
+		close(done)
+		<-exited
+	}
+}
+
+// ack acknowledge handled task
+func (w *Worker) ack(task queue.Task) {
+	if err := w.queue.Ack(context.Background(), task); err != nil {
+		log.Printf("failed to ack task, taskID: %s, error: %v", task.GetID(), err)
+	}
+}
+
+// release return interrupted task to the queue
+func (w *Worker) release(task queue.Task) {
+	ctx := context.Background()
+	if w.onRequeue != nil {
+		w.onRequeue(ctx, task)
+	}
+	if err := w.queue.Release(ctx, task); err != nil {
+		log.Printf("failed to requeue task, taskID: %s, error: %v", task.GetID(), err)
+	}
+}
+
+// nack report failed task to the queue, and notify dead letter handler if retries exhausted
+func (w *Worker) nack(task queue.Task, cause error) {
+	ctx := context.Background()
+	deadLettered, err := w.queue.Nack(ctx, task, cause)
+	if err != nil {
+		log.Printf("failed to nack task, taskID: %s, error: %v", task.GetID(), err)
+		return
+	}
+	if !deadLettered {
+		return
+	}
+
+	log.Printf("task retries exhausted, moved to dead letter queue, taskID: %s", task.GetID())
+	if w.onDeadLetter != nil {
+		w.onDeadLetter(ctx, task, cause)
 	}
 }
@@ -0,0 +1,167 @@
+package worker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmualex2023/i18n-translation/internal/pkg/queue"
+)
+
+// testTask 用于测试的任务实现
+type testTask struct {
+	ID      string        `json:"id"`
+	Timeout time.Duration `json:"timeout"`
+}
+
+func (t *testTask) GetID() string             { return t.ID }
+func (t *testTask) GetTimeout() time.Duration { return t.Timeout }
+
+func init() {
+	queue.Register("worker_test", 1, func() queue.Task { return &testTask{} })
+}
+
+// runTask 运行单个任务并返回处理函数 context 的 cause
+func runTask(t *testing.T, q *queue.MemoryQueue, task *testTask, causes chan error) error {
+	require.NoError(t, q.Enqueue(context.Background(), task))
+	select {
+	case cause := <-causes:
+		return cause
+	case <-time.After(time.Second):
+		t.Fatalf("task not handled, taskID: %s", task.ID)
+		return nil
+	}
+}
+
+// extendQueue 记录续租的队列
+type extendQueue struct {
+	*queue.MemoryQueue
+	extends chan string
+}
+
+func (q *extendQueue) Extend(ctx context.Context, task queue.Task) error {
+	q.extends <- task.GetID()
+	return nil
+}
+
+// TestWorkerLeaseRenewal 测试任务执行期间定期续租，结束后停止续租
+func TestWorkerLeaseRenewal(t *testing.T) {
+	mq, err := queue.NewMemoryQueue()
+	require.NoError(t, err)
+	q := &extendQueue{MemoryQueue: mq, extends: make(chan string, 100)}
+
+	release := make(chan struct{})
+	w := NewWorker(q, func(ctx context.Context, task queue.Task) error {
+		<-release
+		return nil
+	})
+	w.SetLeaseRenewal(10 * time.Millisecond)
+	w.Start(1)
+	defer w.Shutdown(context.Background())
+
+	require.NoError(t, q.Enqueue(context.Background(), &testTask{ID: "renew"}))
+	for i := 0; i < 3; i++ {
+		select {
+		case id := <-q.extends:
+			assert.Equal(t, "renew", id)
+		case <-time.After(time.Second):
+			t.Fatal("lease not extended")
+		}
+	}
+
+	// 任务确认后不再续租
+	close(release)
+	for w.Processed() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	for len(q.extends) > 0 {
+		<-q.extends
+	}
+	time.Sleep(30 * time.Millisecond)
+	assert.Empty(t, q.extends)
+}
+
+func TestWorkerContext(t *testing.T) {
+	q, err := queue.NewMemoryQueue()
+	require.NoError(t, err)
+
+	started := make(chan string, 1)
+	causes := make(chan error, 1)
+	w := NewWorker(q, func(ctx context.Context, task queue.Task) error {
+		started <- task.GetID()
+		<-ctx.Done()
+		causes <- context.Cause(ctx)
+		return ctx.Err()
+	})
+	requeued := make(chan string, 1)
+	w.OnRequeue(func(ctx context.Context, task queue.Task) {
+		requeued <- task.GetID()
+	})
+	w.SetTaskTimeout(time.Hour)
+	w.Start(1)
+
+	// 任务自身的超时优先于默认超时
+	cause := runTask(t, q, &testTask{ID: "timeout", Timeout: 20 * time.Millisecond}, causes)
+	assert.ErrorIs(t, cause, ErrTaskTimeout)
+	assert.Equal(t, "timeout", <-started)
+
+	// 取消执行中的任务
+	go func() {
+		id := <-started
+		assert.True(t, w.Cancel(id))
+	}()
+	cause = runTask(t, q, &testTask{ID: "cancel"}, causes)
+	assert.ErrorIs(t, cause, ErrTaskCancelled)
+	assert.False(t, w.Cancel("cancel"))
+
+	// 宽限期结束后中断执行中的任务，任务重新入队
+	require.NoError(t, q.Enqueue(context.Background(), &testTask{ID: "stop"}))
+	assert.Equal(t, "stop", <-started)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	w.Shutdown(ctx)
+	assert.ErrorIs(t, <-causes, ErrWorkerStopped)
+	assert.Equal(t, "stop", <-requeued)
+
+	sizes, err := q.LaneSizes(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), sizes[queue.PriorityNormal])
+	assert.Error(t, q.Ack(context.Background(), &testTask{ID: "stop"}))
+}
+
+func TestWorkerDrain(t *testing.T) {
+	q, err := queue.NewMemoryQueue()
+	require.NoError(t, err)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	w := NewWorker(q, func(ctx context.Context, task queue.Task) error {
+		close(started)
+		<-release
+		return ctx.Err()
+	})
+	w.Start(2)
+
+	require.NoError(t, q.Enqueue(context.Background(), &testTask{ID: "drain"}))
+	<-started
+
+	// 宽限期内完成的任务正常确认
+	done := make(chan struct{})
+	go func() {
+		w.Shutdown(context.Background())
+		close(done)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	<-done
+
+	// 停止后不再取新任务
+	require.NoError(t, q.Enqueue(context.Background(), &testTask{ID: "after"}))
+	time.Sleep(20 * time.Millisecond)
+	sizes, err := q.LaneSizes(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), sizes[queue.PriorityNormal])
+	assert.Error(t, q.Ack(context.Background(), &testTask{ID: "drain"}))
+}